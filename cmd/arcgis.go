@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/pdxrlj/tile_server/config"
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+var arcgisCmd = cobra.Command{
+	Use:   "arcgis",
+	Short: "export a tile folder as an ArcGIS compact cache",
+	Long:  "把已有的 z/x/y 瓦片目录导出为 ArcGIS compact cache v2 (bundle + conf.xml + conf.cdi)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := config.UnmarshalToConfig(&config.C)
+		if err != nil {
+			return err
+		}
+
+		tilesFolder, err := cmd.Flags().GetString("tiles_folder")
+		if err != nil {
+			return err
+		}
+
+		profile, err := pkgGdal.NewProfile(config.C.GetProfile(), config.C.GetTileSize())
+		if err != nil {
+			return err
+		}
+		layout, err := tile.NewLayout(config.C.GetLayout(), tile.StyleScheme(config.C.GetTileStyle()), profile)
+		if err != nil {
+			return err
+		}
+
+		return tile.ExportArcGISFolder(tilesFolder, config.C.GetOutFolder(), layout, profile, config.C.GetTileSize())
+	},
+}
+
+func init() {
+	arcgisCmd.Flags().StringP("tiles_folder", "t", "", "已有瓦片目录")
+	root.AddCommand(&arcgisCmd)
+}
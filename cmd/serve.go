@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+
+	"github.com/pdxrlj/tile_server/config"
+	"github.com/pdxrlj/tile_server/pkg/cache"
+	"github.com/pdxrlj/tile_server/pkg/metrics"
+	"github.com/pdxrlj/tile_server/pkg/server"
+)
+
+var serveCmd = cobra.Command{
+	Use:   "serve",
+	Short: "serve tiles over http",
+	Long:  "启动瓦片服务,/cog/{z}/{x}/{y}.{png|jpg}?path= 按请求实时渲染 server.data_root 下的源影像,支持 bidx/rescale/colormap_name/nodata/resampling/return_mask 参数;/wmts 与 /collections(OGC API - Tiles)发布 server.tilesets 中的瓦片集,dynamic 类型的瓦片集同时通过 /wms 发布;/layers 列出图层的 TileJSON,/{layer}/{z}/{x}/{y} 按图层读取瓦片,server.cache 开启后经过缓存,/cache/stats 查看命中统计;瓦片带 ETag/Last-Modified,支持 304 条件请求;server.metrics 开启后 /metrics 为 Prometheus 指标;server.access 配置 API 密钥(X-API-Key 请求头或 api_key 参数)、按密钥限流、可访问的图层和跨域来源",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := config.UnmarshalToConfig(&config.C)
+		if err != nil {
+			return err
+		}
+
+		options := []server.Option{
+			server.WithAddr(config.C.GetServerAddr()),
+			server.WithDataRoot(config.C.GetServerDataRoot()),
+			server.WithWorkers(config.C.GetServerWorkers()),
+			server.WithMaxRenderers(config.C.GetServerMaxRenderers()),
+			server.WithTileSize(config.C.GetTileSize()),
+			server.WithProfile(config.C.GetProfile()),
+			server.WithCacheControl(config.C.GetServerCacheControl()),
+			server.WithPprof(config.C.GetServerPprof()),
+			server.WithMetrics(config.C.GetServerMetrics()),
+		}
+		access := config.C.GetServerAccess()
+		if access.KeysFile != "" {
+			keys, err := config.LoadAPIKeys(access.KeysFile)
+			if err != nil {
+				return fmt.Errorf("load api keys %s: %w", access.KeysFile, err)
+			}
+			options = append(options, server.WithAPIKeys(apiKeys(keys)))
+		}
+		if len(access.CORSOrigins) > 0 {
+			options = append(options, server.WithCORSOrigins(access.CORSOrigins))
+		}
+		if c := config.C.GetServerCache(); c.MemoryMB > 0 || c.DiskDir != "" {
+			tileCache := cache.New(
+				cache.WithMemorySize(int64(c.MemoryMB)<<20),
+				cache.WithDisk(c.DiskDir, c.DiskTTL),
+			)
+			prometheus.MustRegister(metrics.NewCacheCollector(tileCache))
+			options = append(options, server.WithCache(tileCache))
+		}
+		s := server.New(options...)
+		defer s.Close()
+
+		tilesets := config.C.GetServerTilesets()
+		var layers []config.ServerTileset
+		if catalogFile := config.C.GetServerCatalog(); catalogFile != "" {
+			catalog, err := config.WatchCatalog(catalogFile, func(catalog *config.Catalog, err error) {
+				if err != nil {
+					log.Printf("解析图层目录失败:%s", err)
+					return
+				}
+				log.Printf("图层目录已修改,重新加载 %d 个图层", len(catalog.Layers))
+				if err := s.SyncTilesets(tilesetSources(tilesets, catalog.Layers)); err != nil {
+					log.Printf("重新加载图层失败:%s", err)
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("load catalog %s: %w", catalogFile, err)
+			}
+			layers = catalog.Layers
+		}
+		if err := s.SyncTilesets(tilesetSources(tilesets, layers)); err != nil {
+			return err
+		}
+		return s.ListenAndServe()
+	},
+}
+
+// tilesetSources 合并 server.tilesets 与图层目录中的图层,同名时图层目录优先
+func tilesetSources(groups ...[]config.ServerTileset) []server.TilesetSource {
+	var sources []server.TilesetSource
+	index := make(map[string]int)
+	for _, group := range groups {
+		for _, source := range group {
+			tilesetSource := server.TilesetSource{
+				Name:         source.Name,
+				Type:         source.Type,
+				Path:         source.Path,
+				MinZoom:      source.MinZoom,
+				MaxZoom:      source.MaxZoom,
+				CacheControl: source.CacheControl,
+				SrcSRS:       source.SrcSRS,
+				Georeference: source.Georeference,
+			}
+			// 同名图层只保留最后一个分组的配置,否则每次同步都会来回重新打开
+			if i, ok := index[source.Name]; ok && source.Name != "" {
+				sources[i] = tilesetSource
+				continue
+			}
+			index[source.Name] = len(sources)
+			sources = append(sources, tilesetSource)
+		}
+	}
+	return sources
+}
+
+func apiKeys(keys []config.APIKey) []server.APIKey {
+	apiKeys := make([]server.APIKey, 0, len(keys))
+	for _, key := range keys {
+		apiKeys = append(apiKeys, server.APIKey{
+			Key:    key.Key,
+			Name:   key.Name,
+			Rate:   key.Rate,
+			Burst:  key.Burst,
+			Layers: key.Layers,
+		})
+	}
+	return apiKeys
+}
+
+func init() {
+	serveCmd.Flags().String("addr", ":8080", "监听地址")
+	serveCmd.Flags().String("data_root", "", "path 参数允许访问的目录,为空时 /cog 不可用")
+	serveCmd.Flags().Int("workers", 4, "每个源文件的 GDAL 句柄数")
+	serveCmd.Flags().Int("max_renderers", 64, "/cog 同时打开的源文件数")
+	serveCmd.Flags().String("catalog", "", "图层目录文件,修改后自动重新加载")
+	serveCmd.Flags().Bool("pprof", false, "提供 /debug/pprof/ 性能分析接口")
+	serveCmd.Flags().Bool("metrics", false, "提供 /metrics Prometheus 指标")
+	serveCmd.Flags().String("keys_file", "", "API 密钥文件,为空时不校验密钥")
+	if err := config.ViperBindServeFlags(serveCmd); err != nil {
+		panic(err)
+	}
+	root.AddCommand(&serveCmd)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/pdxrlj/tile_server/config"
+	"github.com/pdxrlj/tile_server/pkg/metrics"
 	"github.com/pdxrlj/tile_server/pkg/tile"
 )
 
@@ -32,12 +33,33 @@ var root = cobra.Command{
 			}
 		}
 
+		if addr := config.C.GetMetricsAddr(); addr != "" {
+			// 切片耗时较长,期间可以通过该地址查看 /metrics 和 /debug/pprof/
+			listener := metrics.Serve(addr, config.C.GetPprof())
+			defer listener.Close()
+		}
+
 		if err := tile.NewTile(
 			tile.SetInputFilename(config.C.GetInputFilename()),
 			tile.SetTileStyle(config.C.GetTileStyle()),
 			tile.SetConcurrency(config.C.GetConcurrency()),
 			tile.SetZoomMaxMin(config.C.GetZoomMax(), config.C.GetZoomMin()),
 			tile.SetOutFolder(config.C.GetOutFolder()),
+			tile.SetSrcSRS(config.C.GetSrcSRS()),
+			tile.SetGeoreference(config.C.GetGeoreference()),
+			tile.SetTileSize(config.C.GetTileSize()),
+			tile.SetRetina(config.C.GetRetina()),
+			tile.SetCutline(config.C.GetCutline()),
+			tile.SetAreaOfInterest(areaOfInterest()...),
+			tile.SetWebViewer(config.C.GetWebViewer()...),
+			tile.SetProfile(config.C.GetProfile()),
+			tile.SetKML(config.C.GetKML()),
+			tile.SetLayout(config.C.GetLayout()),
+			tile.SetArcGIS(config.C.GetArcGIS()),
+			tile.SetPMTiles(config.C.GetPMTiles()),
+			tile.SetGeoPackage(config.C.GetGeoPackage()),
+			tile.SetCOG(config.C.GetCOG()),
+			tile.SetBuildOverviews(config.C.GetBuildOverviews()),
 		).GenerateGdalReadWindows().CuttingToImg().Close(); err != nil {
 			return err
 		}
@@ -46,6 +68,19 @@ var root = cobra.Command{
 	},
 }
 
+func areaOfInterest() []tile.AreaOfInterest {
+	areas := make([]tile.AreaOfInterest, 0, len(config.C.GetAoi()))
+	for _, aoi := range config.C.GetAoi() {
+		areas = append(areas, tile.AreaOfInterest{
+			ZoomMin:  aoi.ZoomMin,
+			ZoomMax:  aoi.ZoomMax,
+			Bbox:     aoi.Bbox,
+			Filename: aoi.Filename,
+		})
+	}
+	return areas
+}
+
 // Execute executes the root command.
 func Execute() error {
 	return root.Execute()
@@ -87,6 +122,22 @@ func CommandLine() {
 	root.PersistentFlags().IntP("zoom_min", "l", 0, "最小层级")
 	root.PersistentFlags().StringP("input_filename", "i", "", "输入文件")
 	root.PersistentFlags().StringP("out_folder", "o", "", "输出文件")
-	root.PersistentFlags().StringP("style", "s", "", "瓦片风格 tms/google 两种")
+	root.PersistentFlags().StringP("style", "s", "", "瓦片风格 tms/google 两种,tms 按 y 翻转输出 xyz 行号(从北往南),google 输出 TMS 行号")
 	root.PersistentFlags().IntP("concurrency", "c", 3, "并发数")
+	root.PersistentFlags().String("s_srs", "", "覆盖源坐标系 WKT/PROJ/EPSG:xxxx")
+	root.PersistentFlags().String("georeference", "auto", "地理参考方式 auto/gcp/tps/rpc")
+	root.PersistentFlags().Int("tile_size", 256, "瓦片大小 256/512")
+	root.PersistentFlags().Bool("retina", false, "同时生成 @2x 高清瓦片")
+	root.PersistentFlags().String("cutline", "", "裁切多边形 GeoJSON/Shapefile")
+	root.PersistentFlags().StringSliceP("webviewer", "w", nil, "预览页面 leaflet/openlayers/maplibre/all")
+	root.PersistentFlags().StringP("profile", "p", "mercator", "切片方案 mercator/geodetic")
+	root.PersistentFlags().Bool("kml", false, "生成 Google Earth KML super-overlay")
+	root.PersistentFlags().String("layout", "xyz", "瓦片路径布局 xyz/zyx/quadkey/arcgis 或模板 {z}/{x}/{y}")
+	root.PersistentFlags().Bool("arcgis", false, "导出 ArcGIS 紧凑缓存 bundle")
+	root.PersistentFlags().Bool("pmtiles", false, "打包为 PMTiles 单文件")
+	root.PersistentFlags().Bool("gpkg", false, "导出 GeoPackage 瓦片")
+	root.PersistentFlags().Bool("build_overviews", false, "源影像没有金字塔时先生成外部 .ovr")
+	root.PersistentFlags().String("cog", "", "切片前预处理为 COG: input 转换输入影像, vrt 转换重投影后的 VRT")
+	root.PersistentFlags().String("metrics_addr", "", "切片期间的指标监听地址,如 :9100")
+	root.PersistentFlags().Bool("pprof", false, "指标监听同时提供 /debug/pprof/")
 }
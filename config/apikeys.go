@@ -0,0 +1,36 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+)
+
+// APIKey 合作方密钥,rate 为每秒请求数,0 时不限流;layers 为空时可以访问所有图层
+type APIKey struct {
+	Key    string   `mapstructure:"key"`
+	Name   string   `mapstructure:"name"`
+	Rate   float64  `mapstructure:"rate"`
+	Burst  int      `mapstructure:"burst"`
+	Layers []string `mapstructure:"layers"`
+}
+
+// LoadAPIKeys 读取密钥文件
+//
+//	keys:
+//	  - key: 0123456789abcdef
+//	    name: partner-a
+//	    rate: 10
+//	    layers: [dom]
+func LoadAPIKeys(filename string) ([]APIKey, error) {
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	keys := struct {
+		Keys []APIKey `mapstructure:"keys"`
+	}{}
+	if err := v.Unmarshal(&keys); err != nil {
+		return nil, err
+	}
+	return keys.Keys, nil
+}
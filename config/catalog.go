@@ -0,0 +1,36 @@
+package config
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Catalog 图层目录,layers 与 server.tilesets 的格式相同
+//
+//	layers:
+//	  - name: dom
+//	    type: pmtiles
+//	    path: ./dom.pmtiles
+type Catalog struct {
+	Layers []ServerTileset `mapstructure:"layers"`
+}
+
+// WatchCatalog 读取图层目录文件,文件修改后重新解析并回调 onChange
+func WatchCatalog(filename string, onChange func(*Catalog, error)) (*Catalog, error) {
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{}
+	if err := v.Unmarshal(catalog); err != nil {
+		return nil, err
+	}
+
+	v.OnConfigChange(func(event fsnotify.Event) {
+		changed := &Catalog{}
+		onChange(changed, v.Unmarshal(changed))
+	})
+	v.WatchConfig()
+	return catalog, nil
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -8,16 +10,88 @@ import (
 var C *Config
 
 type Config struct {
-	Tile Tile
+	Tile   Tile
+	Server Server
+}
+
+// Server 瓦片服务配置
+type Server struct {
+	Addr     string `mapstructure:"addr"`
+	DataRoot string `mapstructure:"data_root"`
+	Workers  int    `mapstructure:"workers"`
+	// MaxRenderers /cog 同时打开的源文件数
+	MaxRenderers int `mapstructure:"max_renderers"`
+	// Tilesets 通过 WMTS 发布的瓦片集
+	Tilesets []ServerTileset `mapstructure:"tilesets"`
+	// Catalog 图层目录文件,修改后自动重新加载
+	Catalog string      `mapstructure:"catalog"`
+	Cache   ServerCache `mapstructure:"cache"`
+	// CacheControl 瓦片响应默认的 Cache-Control,图层可以单独配置 cache_control
+	CacheControl string       `mapstructure:"cache_control"`
+	Pprof        bool         `mapstructure:"pprof"`
+	Metrics      bool         `mapstructure:"metrics"`
+	Access       ServerAccess `mapstructure:"access"`
+}
+
+// ServerAccess 访问控制,keys_file 为空时不校验密钥
+type ServerAccess struct {
+	KeysFile    string   `mapstructure:"keys_file"`
+	CORSOrigins []string `mapstructure:"cors_origins"`
+}
+
+// ServerCache 瓦片缓存,memory_mb 为 0 且 disk_dir 为空时不缓存
+type ServerCache struct {
+	MemoryMB int           `mapstructure:"memory_mb"`
+	DiskDir  string        `mapstructure:"disk_dir"`
+	DiskTTL  time.Duration `mapstructure:"disk_ttl"`
+}
+
+// ServerTileset 瓦片集来源,type 为 dir/mbtiles/pmtiles/dynamic
+type ServerTileset struct {
+	Name         string `mapstructure:"name"`
+	Type         string `mapstructure:"type"`
+	Path         string `mapstructure:"path"`
+	MinZoom      int    `mapstructure:"min_zoom"`
+	MaxZoom      int    `mapstructure:"max_zoom"`
+	CacheControl string `mapstructure:"cache_control"`
+	// SrcSRS Georeference dynamic 类型覆盖源影像坐标系和地理参考方式
+	SrcSRS       string `mapstructure:"s_srs"`
+	Georeference string `mapstructure:"georeference"`
 }
 
 type Tile struct {
-	ZoomMax       int    `mapstructure:"zoom_max"`
-	ZoomMin       int    `mapstructure:"zoom_min"`
-	InputFilename string `mapstructure:"input_filename"`
-	OutFolder     string `mapstructure:"out_folder"`
-	Style         string `mapstructure:"style"`
-	Concurrency   int    `mapstructure:"concurrency"`
+	ZoomMax        int      `mapstructure:"zoom_max"`
+	ZoomMin        int      `mapstructure:"zoom_min"`
+	InputFilename  string   `mapstructure:"input_filename"`
+	OutFolder      string   `mapstructure:"out_folder"`
+	Style          string   `mapstructure:"style"`
+	Concurrency    int      `mapstructure:"concurrency"`
+	SrcSRS         string   `mapstructure:"s_srs"`
+	Georeference   string   `mapstructure:"georeference"`
+	TileSize       int      `mapstructure:"tile_size"`
+	Retina         bool     `mapstructure:"retina"`
+	Cutline        string   `mapstructure:"cutline"`
+	Aoi            []Aoi    `mapstructure:"aoi"`
+	WebViewer      []string `mapstructure:"webviewer"`
+	Profile        string   `mapstructure:"profile"`
+	KML            bool     `mapstructure:"kml"`
+	Layout         string   `mapstructure:"layout"`
+	ArcGIS         bool     `mapstructure:"arcgis"`
+	PMTiles        bool     `mapstructure:"pmtiles"`
+	GeoPackage     bool     `mapstructure:"gpkg"`
+	COG            string   `mapstructure:"cog"`
+	BuildOverviews bool     `mapstructure:"build_overviews"`
+	// MetricsAddr 切片期间的指标监听地址,为空时不监听
+	MetricsAddr string `mapstructure:"metrics_addr"`
+	Pprof       bool   `mapstructure:"pprof"`
+}
+
+// Aoi 按层级配置的兴趣区,bbox 为经纬度,filename 为 GeoJSON/Shapefile,都为空表示整幅影像
+type Aoi struct {
+	ZoomMin  int       `mapstructure:"zoom_min"`
+	ZoomMax  int       `mapstructure:"zoom_max"`
+	Bbox     []float64 `mapstructure:"bbox"`
+	Filename string    `mapstructure:"filename"`
 }
 
 func (a *Config) Marsh() error {
@@ -48,6 +122,74 @@ func (a *Config) GetConcurrency() int {
 	return a.Tile.Concurrency
 }
 
+func (a *Config) GetSrcSRS() string {
+	return a.Tile.SrcSRS
+}
+
+func (a *Config) GetGeoreference() string {
+	return a.Tile.Georeference
+}
+
+func (a *Config) GetTileSize() int {
+	return a.Tile.TileSize
+}
+
+func (a *Config) GetRetina() bool {
+	return a.Tile.Retina
+}
+
+func (a *Config) GetCutline() string {
+	return a.Tile.Cutline
+}
+
+func (a *Config) GetAoi() []Aoi {
+	return a.Tile.Aoi
+}
+
+func (a *Config) GetWebViewer() []string {
+	return a.Tile.WebViewer
+}
+
+func (a *Config) GetProfile() string {
+	return a.Tile.Profile
+}
+
+func (a *Config) GetKML() bool {
+	return a.Tile.KML
+}
+
+func (a *Config) GetLayout() string {
+	return a.Tile.Layout
+}
+
+func (a *Config) GetArcGIS() bool {
+	return a.Tile.ArcGIS
+}
+
+func (a *Config) GetPMTiles() bool {
+	return a.Tile.PMTiles
+}
+
+func (a *Config) GetGeoPackage() bool {
+	return a.Tile.GeoPackage
+}
+
+func (a *Config) GetCOG() string {
+	return a.Tile.COG
+}
+
+func (a *Config) GetBuildOverviews() bool {
+	return a.Tile.BuildOverviews
+}
+
+func (a *Config) GetMetricsAddr() string {
+	return a.Tile.MetricsAddr
+}
+
+func (a *Config) GetPprof() bool {
+	return a.Tile.Pprof
+}
+
 func ViperBindFlagsAlias(command cobra.Command) error {
 	err := viper.BindPFlag("tile.zoom_max", command.PersistentFlags().Lookup("zoom_max"))
 	if err != nil {
@@ -79,6 +221,175 @@ func ViperBindFlagsAlias(command cobra.Command) error {
 		return err
 	}
 
+	err = viper.BindPFlag("tile.s_srs", command.PersistentFlags().Lookup("s_srs"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.georeference", command.PersistentFlags().Lookup("georeference"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.tile_size", command.PersistentFlags().Lookup("tile_size"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.retina", command.PersistentFlags().Lookup("retina"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.cutline", command.PersistentFlags().Lookup("cutline"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.webviewer", command.PersistentFlags().Lookup("webviewer"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.profile", command.PersistentFlags().Lookup("profile"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.kml", command.PersistentFlags().Lookup("kml"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.layout", command.PersistentFlags().Lookup("layout"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.arcgis", command.PersistentFlags().Lookup("arcgis"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.pmtiles", command.PersistentFlags().Lookup("pmtiles"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.gpkg", command.PersistentFlags().Lookup("gpkg"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.cog", command.PersistentFlags().Lookup("cog"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.build_overviews", command.PersistentFlags().Lookup("build_overviews"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.metrics_addr", command.PersistentFlags().Lookup("metrics_addr"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("tile.pprof", command.PersistentFlags().Lookup("pprof"))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *Config) GetServerAddr() string {
+	return a.Server.Addr
+}
+
+func (a *Config) GetServerDataRoot() string {
+	return a.Server.DataRoot
+}
+
+func (a *Config) GetServerWorkers() int {
+	return a.Server.Workers
+}
+
+func (a *Config) GetServerMaxRenderers() int {
+	return a.Server.MaxRenderers
+}
+
+func (a *Config) GetServerTilesets() []ServerTileset {
+	return a.Server.Tilesets
+}
+
+func (a *Config) GetServerCatalog() string {
+	return a.Server.Catalog
+}
+
+func (a *Config) GetServerCache() ServerCache {
+	return a.Server.Cache
+}
+
+func (a *Config) GetServerCacheControl() string {
+	return a.Server.CacheControl
+}
+
+func (a *Config) GetServerPprof() bool {
+	return a.Server.Pprof
+}
+
+func (a *Config) GetServerMetrics() bool {
+	return a.Server.Metrics
+}
+
+func (a *Config) GetServerAccess() ServerAccess {
+	return a.Server.Access
+}
+
+// ViperBindServeFlags 绑定 serve 子命令的参数
+func ViperBindServeFlags(command cobra.Command) error {
+	err := viper.BindPFlag("server.addr", command.Flags().Lookup("addr"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("server.data_root", command.Flags().Lookup("data_root"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("server.workers", command.Flags().Lookup("workers"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("server.max_renderers", command.Flags().Lookup("max_renderers"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("server.catalog", command.Flags().Lookup("catalog"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("server.pprof", command.Flags().Lookup("pprof"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("server.metrics", command.Flags().Lookup("metrics"))
+	if err != nil {
+		return err
+	}
+
+	err = viper.BindPFlag("server.access.keys_file", command.Flags().Lookup("keys_file"))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
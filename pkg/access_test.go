@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/cache"
+	"github.com/pdxrlj/tile_server/pkg/server"
+)
+
+func TestAccessControl(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := server.New(
+		server.WithAPIKeys([]server.APIKey{
+			{Key: "all", Name: "internal"},
+			{Key: "partner", Name: "partner-a", Rate: 1, Burst: 2, Layers: []string{"dom"}},
+		}),
+		server.WithCORSOrigins([]string{"https://map.example.com"}),
+		server.WithLogger(slog.New(slog.NewJSONHandler(logs, nil))),
+	)
+	defer s.Close()
+	err := s.SyncTilesets([]server.TilesetSource{
+		{Name: "dom", Type: server.TilesetDir, Path: writeDirTileset(t)},
+		{Name: "dem", Type: server.TilesetMBTiles, Path: writeMBTiles(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, url string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request(http.MethodGet, "/dom/2/3/1.png", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("missing key status %d", rec.Code)
+	}
+	if rec := request(http.MethodGet, "/dom/2/3/1.png?api_key=wrong", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("invalid key status %d", rec.Code)
+	}
+	if rec := request(http.MethodGet, "/dem/1/1/0.png", map[string]string{"X-API-Key": "all"}); rec.Code != http.StatusOK {
+		t.Fatalf("unrestricted key status %d", rec.Code)
+	}
+
+	// partner-a 只能访问 dom,令牌桶容量为 2
+	partner := map[string]string{"X-API-Key": "partner"}
+	if rec := request(http.MethodGet, "/dem/1/1/0.png", partner); rec.Code != http.StatusForbidden {
+		t.Fatalf("layer not allowed status %d", rec.Code)
+	}
+	rec := request(http.MethodGet, "/layers", partner)
+	var layers []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &layers); err != nil || len(layers) != 1 || layers[0]["name"] != "dom" {
+		t.Fatalf("visible layers %s", rec.Body.String())
+	}
+	if rec := request(http.MethodGet, "/dom/2/3/1.png", partner); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("rate limited status %d retry-after %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	var entry struct {
+		Msg     string `json:"msg"`
+		Request struct {
+			Status int    `json:"status"`
+			Reason string `json:"reason"`
+			Key    string `json:"key"`
+			Path   string `json:"path"`
+		} `json:"request"`
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("rejected log lines %d: %s", len(lines), logs.String())
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Msg != "request rejected" || entry.Request.Status != http.StatusForbidden ||
+		entry.Request.Reason != "layer_not_allowed" || entry.Request.Key != "partner-a" || entry.Request.Path != "/dem/1/1/0.png" {
+		t.Fatalf("log entry %s", lines[2])
+	}
+}
+
+func TestAccessCORS(t *testing.T) {
+	s := server.New(
+		server.WithAPIKeys([]server.APIKey{{Key: "partner", Layers: []string{"dom"}}}),
+		server.WithCORSOrigins([]string{"https://map.example.com"}),
+		server.WithLogger(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))),
+	)
+	defer s.Close()
+	if err := s.SyncTilesets([]server.TilesetSource{{Name: "dom", Type: server.TilesetDir, Path: writeDirTileset(t)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/dom/2/3/1.png", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		req.Header.Set("Access-Control-Request-Headers", "X-API-Key")
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	// 预检请求不带密钥
+	rec := preflight("https://map.example.com")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://map.example.com" ||
+		!strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "X-API-Key") {
+		t.Fatalf("preflight status %d headers %v", rec.Code, rec.Header())
+	}
+	if rec := preflight("https://evil.example.com"); rec.Code != http.StatusForbidden {
+		t.Fatalf("disallowed origin status %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dom/2/3/1.png?api_key=partner", nil)
+	req.Header.Set("Origin", "https://map.example.com")
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://map.example.com" ||
+		!strings.Contains(rec.Header().Get("Access-Control-Expose-Headers"), "ETag") {
+		t.Fatalf("cors tile status %d headers %v", rec.Code, rec.Header())
+	}
+	// 限制了图层的密钥不能访问 /cog 任意文件
+	req = httptest.NewRequest(http.MethodGet, "/cog/0/0/0.png?path=a.tif&api_key=partner", nil)
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("cog status %d", rec.Code)
+	}
+}
+
+// 限制了图层的密钥不能访问服务内部状态,能力文档只列出密钥可以访问的图层
+func TestAccessRestrictedKey(t *testing.T) {
+	s := server.New(
+		server.WithAPIKeys([]server.APIKey{{Key: "all"}, {Key: "partner", Layers: []string{"dom"}}}),
+		server.WithCache(cache.New()),
+		server.WithMetrics(true),
+		server.WithPprof(true),
+		server.WithLogger(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))),
+	)
+	defer s.Close()
+	err := s.SyncTilesets([]server.TilesetSource{
+		{Name: "dom", Type: server.TilesetDir, Path: writeDirTileset(t)},
+		{Name: "dem", Type: server.TilesetMBTiles, Path: writeMBTiles(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/metrics", "/debug/pprof/", "/cache/stats"} {
+		if status, _ := get(t, s, path+"?api_key=partner"); status != http.StatusForbidden {
+			t.Fatalf("partner %s status %d", path, status)
+		}
+		if status, _ := get(t, s, path+"?api_key=all"); status != http.StatusOK {
+			t.Fatalf("unrestricted %s status %d", path, status)
+		}
+	}
+
+	for _, path := range []string{"/wmts?request=GetCapabilities&api_key=partner", "/wmts/1.0.0/WMTSCapabilities.xml?api_key=partner", "/tileMatrixSets?api_key=partner"} {
+		status, body := get(t, s, path)
+		if status != http.StatusOK || strings.Contains(body, "dem") {
+			t.Fatalf("%s status %d: %s", path, status, body)
+		}
+	}
+	if _, body := get(t, s, "/wmts?request=GetCapabilities&api_key=all"); !strings.Contains(body, "dem") {
+		t.Fatalf("unrestricted capabilities %s", body)
+	}
+
+	// 参数名大小写不同或重复时无法确定图层,密钥校验和接口可能读到不同的值
+	for _, path := range []string{
+		"/wmts?request=GetTile&LAYER=dom&layer=dem&tilematrixset=WebMercatorQuad&tilematrix=1&tilerow=0&tilecol=1&api_key=partner",
+		"/wms?request=GetMap&layers=dom&layers=dem&api_key=partner",
+	} {
+		if status, _ := get(t, s, path); status != http.StatusBadRequest {
+			t.Fatalf("%s status %d", path, status)
+		}
+	}
+}
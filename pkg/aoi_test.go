@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestAreaOfInterestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		aoi  tile.AreaOfInterest
+		err  error
+	}{
+		{"whole", tile.AreaOfInterest{}, nil},
+		{"bbox", tile.AreaOfInterest{Bbox: []float64{116, 39, 117, 40}}, nil},
+		{"file", tile.AreaOfInterest{Filename: "aoi.geojson"}, nil},
+		{"short bbox", tile.AreaOfInterest{Bbox: []float64{116, 39, 117}}, pkgGdal.ErrAreaOfInterest},
+		{"inverted bbox", tile.AreaOfInterest{Bbox: []float64{117, 39, 116, 40}}, pkgGdal.ErrAreaOfInterest},
+		{"out of range", tile.AreaOfInterest{Bbox: []float64{170, 80, 190, 95}}, pkgGdal.ErrAreaOfInterest},
+	}
+	for _, tt := range tests {
+		if err := tt.aoi.Validate(); !errors.Is(err, tt.err) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestAreasOfInterestZooms(t *testing.T) {
+	city := &tile.AreaOfInterest{ZoomMin: 10, ZoomMax: 14, Bbox: []float64{116, 39, 117, 40}}
+	block := &tile.AreaOfInterest{ZoomMin: 15, ZoomMax: 18, Filename: "block.geojson"}
+	world := &tile.AreaOfInterest{ZoomMin: 0, ZoomMax: 9}
+	areas := tile.AreasOfInterest{world, city, block}
+
+	tests := []struct {
+		z        int
+		covering int
+		whole    bool
+		// 最大层级为 18 时是否直接读源影像
+		fromSource bool
+	}{
+		{0, 1, true, false},
+		// 第 10 级只覆盖兴趣区,第 9 级不能由子瓦片合成
+		{9, 1, true, true},
+		{10, 1, false, false},
+		{14, 1, false, true},
+		{15, 1, false, false},
+		{18, 1, false, true},
+		{19, 0, false, true},
+	}
+	for _, tt := range tests {
+		if got := len(areas.Covering(tt.z)); got != tt.covering {
+			t.Errorf("z=%d: Covering = %d, want %d", tt.z, got, tt.covering)
+		}
+		if got := areas.WholeRaster(tt.z); got != tt.whole {
+			t.Errorf("z=%d: WholeRaster = %v, want %v", tt.z, got, tt.whole)
+		}
+		if got := areas.ReadFromSource(tt.z, 18); got != tt.fromSource {
+			t.Errorf("z=%d: ReadFromSource = %v, want %v", tt.z, got, tt.fromSource)
+		}
+	}
+
+	// 未配置兴趣区时所有层级都是整幅影像,只有最大层级读源影像
+	var none tile.AreasOfInterest
+	if !none.WholeRaster(5) || none.ReadFromSource(5, 18) || !none.ReadFromSource(18, 18) {
+		t.Error("empty AreasOfInterest")
+	}
+}
+
+func TestIntersectBounds(t *testing.T) {
+	tests := []struct {
+		a, b [4]float64
+		want [4]float64
+		ok   bool
+	}{
+		{[4]float64{0, 0, 10, 10}, [4]float64{5, 5, 20, 20}, [4]float64{5, 5, 10, 10}, true},
+		{[4]float64{0, 0, 10, 10}, [4]float64{2, 3, 4, 5}, [4]float64{2, 3, 4, 5}, true},
+		{[4]float64{0, 0, 10, 10}, [4]float64{10, 0, 20, 10}, [4]float64{10, 0, 10, 10}, false},
+		{[4]float64{0, 0, 10, 10}, [4]float64{20, 20, 30, 30}, [4]float64{20, 20, 10, 10}, false},
+	}
+	for _, tt := range tests {
+		got, ok := tile.IntersectBounds(tt.a, tt.b)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("IntersectBounds(%v, %v) = %v, %v, want %v, %v", tt.a, tt.b, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package arcgis
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Esri compact cache V2 https://github.com/Esri/raster-tiles-compactcache
+const (
+	// BundleSize 每个 bundle 包含 128x128 个瓦片
+	BundleSize  = 128
+	recordCount = BundleSize * BundleSize
+	headerSize  = 64
+	indexSize   = 8 * recordCount
+	// 索引中低 40 位为偏移,高 24 位为瓦片大小
+	offsetBits = 40
+	offsetMask = 1<<offsetBits - 1
+	maxOffset  = 1 << offsetBits
+)
+
+var (
+	ErrBundleHeader = errors.New("not a compact cache v2 bundle")
+	ErrBundleRange  = errors.New("tile is outside the bundle")
+	ErrBundleSize   = errors.New("bundle exceeds the 1 TB offset limit")
+)
+
+// Bundle 一个 bundle 文件的内容,Row/Col 为左上角瓦片的行列号
+type Bundle struct {
+	Level, Row, Col int
+	tiles           [recordCount][]byte
+}
+
+func NewBundle(level, row, col int) *Bundle {
+	return &Bundle{
+		Level: level,
+		Row:   row - row%BundleSize,
+		Col:   col - col%BundleSize,
+	}
+}
+
+// BundleFilename bundle 相对路径 L{level}/R{row}C{col}.bundle,行列号为 16 进制
+func BundleFilename(level, row, col int) string {
+	row, col = row-row%BundleSize, col-col%BundleSize
+	return filepath.Join(fmt.Sprintf("L%02d", level), fmt.Sprintf("R%04xC%04x.bundle", row, col))
+}
+
+func (b *Bundle) Filename() string {
+	return BundleFilename(b.Level, b.Row, b.Col)
+}
+
+// Set 设置瓦片数据,row/col 为全局行列号,行号从北往南
+func (b *Bundle) Set(row, col int, data []byte) error {
+	index, err := b.index(row, col)
+	if err != nil {
+		return err
+	}
+	b.tiles[index] = data
+	return nil
+}
+
+func (b *Bundle) index(row, col int) (int, error) {
+	r, c := row-b.Row, col-b.Col
+	if r < 0 || r >= BundleSize || c < 0 || c >= BundleSize {
+		return 0, ErrBundleRange
+	}
+	return r*BundleSize + c, nil
+}
+
+// WriteTo 依次写入 64 字节文件头、索引和带 4 字节长度前缀的瓦片数据
+func (b *Bundle) WriteTo(w io.Writer) (int64, error) {
+	index := make([]uint64, recordCount)
+	offset := int64(headerSize + indexSize)
+	maxTileSize := 0
+	for i, data := range b.tiles {
+		if len(data) == 0 {
+			continue
+		}
+		offset += 4
+		index[i] = uint64(offset) | uint64(len(data))<<offsetBits
+		offset += int64(len(data))
+		if len(data) > maxTileSize {
+			maxTileSize = len(data)
+		}
+	}
+	if offset >= maxOffset {
+		return 0, ErrBundleSize
+	}
+
+	bw := bufio.NewWriter(w)
+	header := []any{
+		int32(3),              // version
+		int32(recordCount),    // record count
+		int32(maxTileSize),    // maximum tile size
+		int32(5),              // offset byte count
+		int64(0),              // slack space
+		offset,                // file size
+		int64(40),             // user header offset
+		int32(20 + indexSize), // user header size
+		int32(3), int32(16),   // legacy
+		int32(recordCount), int32(5), // legacy
+		int32(indexSize), // index size
+	}
+	for _, field := range header {
+		if err := binary.Write(bw, binary.LittleEndian, field); err != nil {
+			return 0, err
+		}
+	}
+	if err := binary.Write(bw, binary.LittleEndian, index); err != nil {
+		return 0, err
+	}
+	for _, data := range b.tiles {
+		if len(data) == 0 {
+			continue
+		}
+		if err := binary.Write(bw, binary.LittleEndian, uint32(len(data))); err != nil {
+			return 0, err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	return offset, bw.Flush()
+}
+
+// WriteFile 写入 dir 下的 bundle 文件
+func (b *Bundle) WriteFile(dir string) error {
+	filename := filepath.Join(dir, b.Filename())
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := b.WriteTo(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadTile 从 bundle 中读取瓦片,row/col 为全局行列号,瓦片不存在时返回 nil
+func ReadTile(r io.ReaderAt, row, col int) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != 3 || binary.LittleEndian.Uint32(header[4:8]) != recordCount {
+		return nil, ErrBundleHeader
+	}
+
+	i := (row%BundleSize)*BundleSize + col%BundleSize
+	entry := make([]byte, 8)
+	if _, err := r.ReadAt(entry, int64(headerSize+8*i)); err != nil {
+		return nil, err
+	}
+	value := binary.LittleEndian.Uint64(entry)
+	size := int(value >> offsetBits)
+	if size == 0 {
+		return nil, nil
+	}
+
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, int64(value&offsetMask)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
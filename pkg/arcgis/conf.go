@@ -0,0 +1,149 @@
+package arcgis
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+const (
+	wktWebMercator = `PROJCS["WGS_1984_Web_Mercator_Auxiliary_Sphere",GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Mercator_Auxiliary_Sphere"],PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",0.0],PARAMETER["Standard_Parallel_1",0.0],PARAMETER["Auxiliary_Sphere_Type",0.0],UNIT["Meter",1.0],AUTHORITY["EPSG",3857]]`
+	wktWGS84       = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433],AUTHORITY["EPSG",4326]]`
+
+	dpi = 96
+	// 每英寸 0.0254 米
+	metersPerInch = 0.0254
+	// 赤道上每度的米数,经纬度缓存计算比例尺用
+	metersPerDegree = 2 * math.Pi * 6378137 / 360
+)
+
+var ErrCacheSRS = errors.New("arcgis cache only supports EPSG:3857 and EPSG:4326")
+
+// LOD 缓存层级
+type LOD struct {
+	LevelID    int
+	Scale      float64
+	Resolution float64
+}
+
+// CacheInfo conf.xml / conf.cdi 的内容
+type CacheInfo struct {
+	WKT              string
+	WKID             int
+	LatestWKID       int
+	Geographic       bool
+	OriginX, OriginY float64
+	TileSize         int
+	Format           string
+	LODs             []LOD
+	// 数据范围
+	XMin, YMin, XMax, YMax float64
+}
+
+// NewCacheInfo 根据坐标系、瓦片大小、各层级分辨率(下标为层级)和数据范围生成缓存信息
+func NewCacheInfo(epsg, tileSize int, resolutions []float64, xmin, ymin, xmax, ymax float64) (*CacheInfo, error) {
+	info := &CacheInfo{
+		TileSize: tileSize,
+		Format:   "PNG",
+		XMin:     xmin,
+		YMin:     ymin,
+		XMax:     xmax,
+		YMax:     ymax,
+	}
+	unit := 1.0
+	switch epsg {
+	case 3857:
+		info.WKT, info.WKID, info.LatestWKID = wktWebMercator, 102100, 3857
+		info.OriginX, info.OriginY = -math.Pi*6378137, math.Pi*6378137
+	case 4326:
+		info.WKT, info.WKID, info.LatestWKID = wktWGS84, 4326, 4326
+		info.OriginX, info.OriginY = -180, 90
+		info.Geographic = true
+		unit = metersPerDegree
+	default:
+		return nil, ErrCacheSRS
+	}
+	for level, resolution := range resolutions {
+		info.LODs = append(info.LODs, LOD{
+			LevelID:    level,
+			Scale:      resolution * unit * dpi / metersPerInch,
+			Resolution: resolution,
+		})
+	}
+	return info, nil
+}
+
+var confTemplate = template.Must(template.New("conf.xml").Parse(`<?xml version="1.0" encoding="utf-8"?>
+<CacheInfo xsi:type="typens:CacheInfo" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:typens="http://www.esri.com/schemas/ArcGIS/10.3">
+  <TileCacheInfo xsi:type="typens:TileCacheInfo">
+    <SpatialReference xsi:type="typens:{{if .Geographic}}GeographicCoordinateSystem{{else}}ProjectedCoordinateSystem{{end}}">
+      <WKT>{{.WKT}}</WKT>
+      <WKID>{{.WKID}}</WKID>
+      <LatestWKID>{{.LatestWKID}}</LatestWKID>
+    </SpatialReference>
+    <TileOrigin xsi:type="typens:PointN">
+      <X>{{.OriginX}}</X>
+      <Y>{{.OriginY}}</Y>
+    </TileOrigin>
+    <TileCols>{{.TileSize}}</TileCols>
+    <TileRows>{{.TileSize}}</TileRows>
+    <DPI>96</DPI>
+    <PreciseDPI>96</PreciseDPI>
+    <LODInfos xsi:type="typens:ArrayOfLODInfo">
+{{- range .LODs}}
+      <LODInfo xsi:type="typens:LODInfo">
+        <LevelID>{{.LevelID}}</LevelID>
+        <Scale>{{.Scale}}</Scale>
+        <Resolution>{{.Resolution}}</Resolution>
+      </LODInfo>
+{{- end}}
+    </LODInfos>
+  </TileCacheInfo>
+  <TileImageInfo xsi:type="typens:TileImageInfo">
+    <CacheTileFormat>{{.Format}}</CacheTileFormat>
+    <CompressionQuality>0</CompressionQuality>
+    <Antialiasing>false</Antialiasing>
+  </TileImageInfo>
+  <CacheStorageInfo xsi:type="typens:CacheStorageInfo">
+    <StorageFormat>esriMapCacheStorageModeCompactV2</StorageFormat>
+    <PacketSize>128</PacketSize>
+  </CacheStorageInfo>
+</CacheInfo>
+`))
+
+var cdiTemplate = template.Must(template.New("conf.cdi").Parse(`<?xml version="1.0" encoding="utf-8"?>
+<EnvelopeN xsi:type="typens:EnvelopeN" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:typens="http://www.esri.com/schemas/ArcGIS/10.3">
+  <XMin>{{.XMin}}</XMin>
+  <YMin>{{.YMin}}</YMin>
+  <XMax>{{.XMax}}</XMax>
+  <YMax>{{.YMax}}</YMax>
+  <SpatialReference xsi:type="typens:{{if .Geographic}}GeographicCoordinateSystem{{else}}ProjectedCoordinateSystem{{end}}">
+    <WKT>{{.WKT}}</WKT>
+    <WKID>{{.WKID}}</WKID>
+    <LatestWKID>{{.LatestWKID}}</LatestWKID>
+  </SpatialReference>
+</EnvelopeN>
+`))
+
+// WriteConf 在缓存目录写入 conf.xml 和 conf.cdi
+func (c *CacheInfo) WriteConf(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for name, tmpl := range map[string]*template.Template{"conf.xml": confTemplate, "conf.cdi": cdiTemplate} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(f, c); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package arcgis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LayersFolder bundle 所在的目录
+const LayersFolder = "_alllayers"
+
+// Tile 待导出的瓦片,Row 从北往南计数
+type Tile struct {
+	Level, Row, Col int
+	Filename        string
+}
+
+// Export 把瓦片按 bundle 分组写入 outFolder/_alllayers,并写入 conf.xml、conf.cdi
+// 每次只在内存中保留一个 bundle 的瓦片
+func Export(outFolder string, info *CacheInfo, tiles []Tile) error {
+	groups := make(map[string][]Tile)
+	for _, tile := range tiles {
+		name := BundleFilename(tile.Level, tile.Row, tile.Col)
+		groups[name] = append(groups[name], tile)
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	layers := filepath.Join(outFolder, LayersFolder)
+	for i, name := range names {
+		group := groups[name]
+		bundle := NewBundle(group[0].Level, group[0].Row, group[0].Col)
+		for _, tile := range group {
+			data, err := os.ReadFile(tile.Filename)
+			if err != nil {
+				return err
+			}
+			if err := bundle.Set(tile.Row, tile.Col, data); err != nil {
+				return err
+			}
+		}
+		if err := bundle.WriteFile(layers); err != nil {
+			return err
+		}
+		fmt.Printf("写入 bundle %d/%d %s 瓦片数:%d\n", i+1, len(names), name, len(group))
+	}
+
+	return info.WriteConf(outFolder)
+}
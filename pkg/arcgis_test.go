@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/arcgis"
+)
+
+func TestArcGISBundle(t *testing.T) {
+	bundle := arcgis.NewBundle(10, 300, 520)
+	if bundle.Row != 256 || bundle.Col != 512 {
+		t.Fatalf("bundle origin = %d, %d, want 256, 512", bundle.Row, bundle.Col)
+	}
+	if name := bundle.Filename(); name != filepath.Join("L10", "R0100C0200.bundle") {
+		t.Errorf("Filename = %s", name)
+	}
+	if err := bundle.Set(300, 520, []byte("tile-a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.Set(383, 639, []byte("tile-bb")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.Set(384, 520, []byte("x")); err == nil {
+		t.Errorf("Set outside bundle should fail")
+	}
+
+	buf := bytes.Buffer{}
+	size, err := bundle.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(buf.Len()) {
+		t.Errorf("WriteTo size = %d, written %d", size, buf.Len())
+	}
+
+	reader := bytes.NewReader(buf.Bytes())
+	for _, c := range []struct {
+		row, col int
+		want     string
+	}{{300, 520, "tile-a"}, {383, 639, "tile-bb"}, {301, 520, ""}} {
+		data, err := arcgis.ReadTile(reader, c.row, c.col)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != c.want {
+			t.Errorf("ReadTile(%d, %d) = %q, want %q", c.row, c.col, data, c.want)
+		}
+	}
+}
+
+func TestArcGISExport(t *testing.T) {
+	dir := t.TempDir()
+	tileFile := filepath.Join(dir, "0.png")
+	if err := os.WriteFile(tileFile, []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := arcgis.NewCacheInfo(3857, 256, []float64{156543.03392804097}, -1, -1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "cache")
+	if err := arcgis.Export(out, info, []arcgis.Tile{{Level: 0, Row: 0, Col: 0, Filename: tileFile}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"conf.xml", "conf.cdi", filepath.Join(arcgis.LayersFolder, "L00", "R0000C0000.bundle")} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+
+	if _, err := arcgis.NewCacheInfo(2000, 256, nil, 0, 0, 0, 0); err == nil {
+		t.Errorf("NewCacheInfo should reject unsupported srs")
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache 瓦片后端前的缓存:内存 LRU、可选的磁盘缓存,同一瓦片的并发未命中合并为一次读取
+type Cache struct {
+	memory *memoryLRU
+	disk   *diskCache
+	group  singleflight.Group
+	// generation 每次 Purge 加一,Purge 前开始的读取结果不再写入缓存
+	generation atomic.Int64
+	purgeMu    sync.RWMutex
+
+	hits     atomic.Int64
+	diskHits atomic.Int64
+	misses   atomic.Int64
+	merged   atomic.Int64
+}
+
+// Stats 缓存命中统计,Hits 包含 DiskHits,Merged 为等待其他请求读取结果的未命中
+type Stats struct {
+	Hits        int64 `json:"hits"`
+	DiskHits    int64 `json:"disk_hits"`
+	Misses      int64 `json:"misses"`
+	Merged      int64 `json:"merged"`
+	Entries     int   `json:"entries"`
+	MemoryBytes int64 `json:"memory_bytes"`
+}
+
+type Option func(*Cache)
+
+// WithMemorySize 内存缓存的最大字节数,0 时不使用内存缓存
+func WithMemorySize(bytes int64) Option {
+	return func(c *Cache) {
+		if bytes > 0 {
+			c.memory = newMemoryLRU(bytes)
+		} else {
+			c.memory = nil
+		}
+	}
+}
+
+// WithDisk 磁盘缓存目录,ttl 为 0 时不过期
+func WithDisk(dir string, ttl time.Duration) Option {
+	return func(c *Cache) {
+		if dir != "" {
+			c.disk = &diskCache{dir: dir, ttl: ttl}
+		}
+	}
+}
+
+func New(options ...Option) *Cache {
+	c := &Cache{memory: newMemoryLRU(64 << 20)}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Get 依次查内存、磁盘,都未命中时调用 load 并写入缓存;load 出错时不缓存
+func (c *Cache) Get(key string, load func() ([]byte, error)) ([]byte, error) {
+	if c.memory != nil {
+		if data, ok := c.memory.get(key); ok {
+			c.hits.Add(1)
+			return data, nil
+		}
+	}
+
+	leader := false
+	generation := c.generation.Load()
+	// Purge 后的请求不再合并到 Purge 前开始的读取
+	data, err, _ := c.group.Do(strconv.FormatInt(generation, 10)+"/"+key, func() (interface{}, error) {
+		leader = true
+		if c.disk != nil {
+			if data, ok := c.disk.get(key); ok {
+				c.hits.Add(1)
+				c.diskHits.Add(1)
+				c.store(generation, key, data, false)
+				return data, nil
+			}
+		}
+
+		c.misses.Add(1)
+		data, err := load()
+		if err != nil {
+			return nil, err
+		}
+		c.store(generation, key, data, true)
+		return data, nil
+	})
+	if !leader {
+		c.merged.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// store 写入内存和磁盘缓存,读取期间发生过 Purge 时丢弃结果,避免旧图层的瓦片写回
+func (c *Cache) store(generation int64, key string, data []byte, disk bool) {
+	c.purgeMu.RLock()
+	defer c.purgeMu.RUnlock()
+	if c.generation.Load() != generation {
+		return
+	}
+	if c.memory != nil {
+		c.memory.add(key, data)
+	}
+	if disk && c.disk != nil {
+		if err := c.disk.add(key, data); err != nil {
+			log.Printf("写入磁盘缓存失败:%s", err)
+		}
+	}
+}
+
+// Purge 删除 key 以 prefix 开头的缓存,图层重新加载时调用
+func (c *Cache) Purge(prefix string) {
+	c.purgeMu.Lock()
+	defer c.purgeMu.Unlock()
+	c.generation.Add(1)
+	if c.memory != nil {
+		c.memory.purge(prefix)
+	}
+	if c.disk != nil {
+		if err := c.disk.purge(prefix); err != nil {
+			log.Printf("清理磁盘缓存失败:%s", err)
+		}
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	stats := Stats{
+		Hits:     c.hits.Load(),
+		DiskHits: c.diskHits.Load(),
+		Misses:   c.misses.Load(),
+		Merged:   c.merged.Load(),
+	}
+	if c.memory != nil {
+		stats.Entries, stats.MemoryBytes = c.memory.stats()
+	}
+	return stats
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// diskCache 以 key 为相对路径存放瓦片,按文件修改时间判断是否过期
+type diskCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// path key 中不允许出现 ..,避免写到缓存目录外
+func (d *diskCache) path(key string) (string, bool) {
+	if strings.Contains(key, "..") {
+		return "", false
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(key)), true
+}
+
+func (d *diskCache) get(key string) ([]byte, bool) {
+	filename, ok := d.path(key)
+	if !ok {
+		return nil, false
+	}
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, false
+	}
+	if d.ttl > 0 && time.Since(stat.ModTime()) > d.ttl {
+		_ = os.Remove(filename)
+		return nil, false
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// add 先写临时文件再重命名,并发读取不会读到写了一半的瓦片
+func (d *diskCache) add(key string, data []byte) error {
+	filename, ok := d.path(key)
+	if !ok {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tile-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// purge 删除 prefix 对应的目录,prefix 为图层名加 /
+func (d *diskCache) purge(prefix string) error {
+	filename, ok := d.path(strings.TrimSuffix(prefix, "/"))
+	if !ok || filename == filepath.Clean(d.dir) {
+		return nil
+	}
+	return os.RemoveAll(filename)
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// memoryLRU 按字节数限制大小的 LRU,超出时淘汰最久未访问的瓦片
+type memoryLRU struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key  string
+	data []byte
+}
+
+func newMemoryLRU(maxBytes int64) *memoryLRU {
+	return &memoryLRU{
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (m *memoryLRU) get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(element)
+	return element.Value.(*lruEntry).data, true
+}
+
+func (m *memoryLRU) add(key string, data []byte) {
+	size := int64(len(data))
+	if size > m.maxBytes {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.items[key]; ok {
+		m.bytes += size - int64(len(element.Value.(*lruEntry).data))
+		element.Value.(*lruEntry).data = data
+		m.order.MoveToFront(element)
+	} else {
+		m.items[key] = m.order.PushFront(&lruEntry{key: key, data: data})
+		m.bytes += size
+	}
+	for m.bytes > m.maxBytes {
+		m.removeElement(m.order.Back())
+	}
+}
+
+// purge 删除 key 以 prefix 开头的瓦片
+func (m *memoryLRU) purge(prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, element := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			m.removeElement(element)
+		}
+	}
+}
+
+func (m *memoryLRU) removeElement(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	m.order.Remove(element)
+	delete(m.items, entry.key)
+	m.bytes -= int64(len(entry.data))
+}
+
+func (m *memoryLRU) stats() (int, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items), m.bytes
+}
@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pdxrlj/tile_server/pkg/cache"
+	"github.com/pdxrlj/tile_server/pkg/server"
+)
+
+func TestCacheMemoryLRU(t *testing.T) {
+	c := cache.New(cache.WithMemorySize(10))
+	loads := 0
+	load := func(data string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			loads++
+			return []byte(data), nil
+		}
+	}
+
+	_, _ = c.Get("a/0/0/0", load("aaaa"))
+	_, _ = c.Get("b/0/0/0", load("bbbb"))
+	// 访问 a 后 b 成为最久未访问的瓦片,写入 c 时被淘汰
+	_, _ = c.Get("a/0/0/0", load("aaaa"))
+	_, _ = c.Get("c/0/0/0", load("cccc"))
+	if data, _ := c.Get("a/0/0/0", load("xxxx")); string(data) != "aaaa" {
+		t.Fatalf("a evicted, got %s", data)
+	}
+	if data, _ := c.Get("b/0/0/0", load("bbbb")); string(data) != "bbbb" || loads != 4 {
+		t.Fatalf("b should be reloaded, loads %d", loads)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 4 || stats.MemoryBytes > 10 {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	if _, err := c.Get("d/0/0/0", func() ([]byte, error) { return nil, errors.New("render failed") }); err == nil {
+		t.Fatal("load error not returned")
+	}
+	if data, _ := c.Get("d/0/0/0", load("dddd")); string(data) != "dddd" {
+		t.Fatal("failed load was cached")
+	}
+}
+
+func TestCacheDiskTTL(t *testing.T) {
+	dir := t.TempDir()
+	c := cache.New(cache.WithMemorySize(0), cache.WithDisk(dir, time.Hour))
+	if _, err := c.Get("dom/1/2/3.png", func() ([]byte, error) { return []byte("tile"), nil }); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "dom", "1", "2", "3.png")
+	if data, err := os.ReadFile(filename); err != nil || string(data) != "tile" {
+		t.Fatalf("disk cache file %s %v", data, err)
+	}
+
+	data, _ := c.Get("dom/1/2/3.png", func() ([]byte, error) { return []byte("new"), nil })
+	if string(data) != "tile" || c.Stats().DiskHits != 1 {
+		t.Fatalf("disk hit %s %+v", data, c.Stats())
+	}
+
+	// 超过 ttl 的瓦片重新读取
+	expired := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filename, expired, expired); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := c.Get("dom/1/2/3.png", func() ([]byte, error) { return []byte("new"), nil }); string(data) != "new" {
+		t.Fatalf("expired tile served: %s", data)
+	}
+
+	c.Purge("dom/")
+	if _, err := os.Stat(filepath.Join(dir, "dom")); !os.IsNotExist(err) {
+		t.Fatalf("purge left %v", err)
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	c := cache.New()
+	var loads atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func() ([]byte, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("tile"), nil
+	}
+
+	const clients = 8
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = c.Get("dem/5/1/1", load)
+	}()
+	<-started
+	for i := 1; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := c.Get("dem/5/1/1", load); err != nil || string(data) != "tile" {
+				t.Errorf("Get = %s %v", data, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	stats := c.Stats()
+	if loads.Load() != 1 || stats.Misses != 1 || stats.Merged+stats.Hits != clients-1 {
+		t.Fatalf("loads %d stats %+v", loads.Load(), stats)
+	}
+}
+
+// Purge 时正在读取的旧瓦片不写回缓存
+func TestCachePurgeDuringLoad(t *testing.T) {
+	c := cache.New(cache.WithDisk(t.TempDir(), 0))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		data, _ := c.Get("dom/1/0/0.png", func() ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("old"), nil
+		})
+		if string(data) != "old" {
+			t.Errorf("in-flight load = %s", data)
+		}
+	}()
+	<-started
+	c.Purge("dom/")
+	// Purge 后的请求不合并到旧的读取
+	data, err := c.Get("dom/1/0/0.png", func() ([]byte, error) { return []byte("new"), nil })
+	if err != nil || string(data) != "new" {
+		t.Fatalf("Get after purge = %s %v", data, err)
+	}
+	close(release)
+	<-done
+
+	if data, _ := c.Get("dom/1/0/0.png", func() ([]byte, error) { return []byte("reloaded"), nil }); string(data) != "new" {
+		t.Fatalf("stale tile written back: %s", data)
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	c := cache.New()
+	s := server.New(server.WithCache(c))
+	defer s.Close()
+	if err := s.SyncTilesets([]server.TilesetSource{{Name: "dom", Type: server.TilesetDir, Path: writeDirTileset(t)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if status, body := get(t, s, "/dom/2/3/1.png"); status != 200 || body != "dir-tile" {
+			t.Fatalf("tile status %d %s", status, body)
+		}
+	}
+	if stats := c.Stats(); stats.Misses != 1 || stats.Hits != 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if status, body := get(t, s, "/cache/stats"); status != 200 || body == "" {
+		t.Fatalf("cache stats status %d", status)
+	}
+
+	// 图层删除后清理缓存
+	if err := s.SyncTilesets(nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Entries != 0 {
+		t.Fatalf("cache not purged %+v", stats)
+	}
+}
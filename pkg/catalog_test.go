@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pdxrlj/tile_server/config"
+	"github.com/pdxrlj/tile_server/pkg/pmtiles"
+	"github.com/pdxrlj/tile_server/pkg/server"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// writePMTilesTileset 写入一个只有 3/6/2 瓦片(XYZ)的 PMTiles
+func writePMTilesTileset(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "dsm.pmtiles")
+	writer, err := pmtiles.NewWriter(filename, pmtiles.Header{
+		TileType: pmtiles.TileTypePng,
+		MinZoom:  3,
+		MaxZoom:  3,
+		MinLon:   90,
+		MinLat:   0,
+		MaxLon:   135,
+		MaxLat:   40,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.AddTile(3, 6, 2, []byte("pmtiles-tile")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(map[string]string{"name": "dsm"}); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestCatalogLayers(t *testing.T) {
+	s := server.New()
+	defer s.Close()
+	err := s.SyncTilesets([]server.TilesetSource{
+		{Name: "dom", Type: server.TilesetDir, Path: writeDirTileset(t)},
+		{Name: "dem", Type: server.TilesetMBTiles, Path: writeMBTiles(t)},
+		{Name: "dsm", Type: server.TilesetPMTiles, Path: writePMTilesTileset(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := get(t, s, "/layers")
+	if status != http.StatusOK {
+		t.Fatalf("layers status %d: %s", status, body)
+	}
+	var layers []tile.TileJSON
+	if err := json.Unmarshal([]byte(body), &layers); err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 3 || layers[2].Name != "dsm" || layers[2].MinZoom != 3 || layers[2].Tiles[0] != "http://example.com/dsm/{z}/{x}/{y}.png" {
+		t.Fatalf("layers %+v", layers)
+	}
+
+	for _, c := range []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"/dom/2/3/1.png", http.StatusOK, "dir-tile"},
+		{"/dem/1/1/0", http.StatusOK, "mbtiles-tile"},
+		{"/dsm/3/6/2.png", http.StatusOK, "pmtiles-tile"},
+		{"/dsm/3/6/3.png", http.StatusNotFound, ""},
+		{"/dsm/3/6/2.jpg", http.StatusNotFound, ""},
+		{"/unknown/3/6/2.png", http.StatusNotFound, ""},
+		{"/layers/dom", http.StatusOK, ""},
+	} {
+		status, body := get(t, s, c.url)
+		if status != c.status || (c.body != "" && body != c.body) {
+			t.Errorf("%s: status %d body %q", c.url, status, body)
+		}
+	}
+
+	// 配置中删除的图层停止发布,未变化的图层保持原来的瓦片集
+	dom, _ := s.Tileset("dom")
+	if err := s.SyncTilesets([]server.TilesetSource{{Name: "dom", Type: server.TilesetDir, Path: ""}}); err == nil {
+		t.Fatal("expected error for a dir without tilejson")
+	}
+	if got, _ := s.Tileset("dom"); got != dom {
+		t.Fatal("failed reload replaced the old tileset")
+	}
+	if names := s.TilesetNames(); len(names) != 1 || names[0] != "dom" {
+		t.Fatalf("names after sync %v", names)
+	}
+}
+
+func TestWatchCatalog(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "catalog.yaml")
+	if err := os.WriteFile(filename, []byte("layers:\n  - name: dom\n    type: dir\n    path: ./dom\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan *config.Catalog, 8)
+	catalog, err := config.WatchCatalog(filename, func(catalog *config.Catalog, err error) {
+		if err == nil {
+			changes <- catalog
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Layers) != 1 || catalog.Layers[0].Type != "dir" {
+		t.Fatalf("catalog %+v", catalog)
+	}
+
+	content := "layers:\n  - name: dom\n    type: dir\n    path: ./dom\n  - name: dsm\n    type: pmtiles\n    path: ./dsm.pmtiles\n"
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case changed := <-changes:
+			if len(changed.Layers) == 2 && changed.Layers[1].Type == "pmtiles" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("catalog change not reloaded")
+		}
+	}
+}
+
+// blockingTileset 读取瓦片时阻塞到 release 关闭,记录是否已关闭
+type blockingTileset struct {
+	reading chan struct{}
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func newBlockingTileset() *blockingTileset {
+	return &blockingTileset{reading: make(chan struct{}), release: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (b *blockingTileset) Info() server.TilesetInfo {
+	return server.TilesetInfo{Name: "slow", Format: "png", MaxZoom: 2, Bounds: [4]float64{-180, -85, 180, 85}, TileSize: 256}
+}
+
+func (b *blockingTileset) Tile(z, x, y int) ([]byte, error) {
+	close(b.reading)
+	<-b.release
+	return []byte("slow-tile"), nil
+}
+
+func (b *blockingTileset) Close() error {
+	close(b.closed)
+	return nil
+}
+
+// 替换图层时,旧瓦片集等正在读取的请求结束后才关闭
+func TestReplaceTilesetWhileReading(t *testing.T) {
+	s := server.New()
+	defer s.Close()
+	old := newBlockingTileset()
+	s.AddTileset("slow", old)
+
+	done := make(chan string)
+	go func() {
+		_, body := get(t, s, "/slow/1/0/0.png")
+		done <- body
+	}()
+	<-old.reading
+	s.AddTileset("slow", newBlockingTileset())
+	select {
+	case <-old.closed:
+		t.Fatal("old tileset closed while a request is reading it")
+	default:
+	}
+
+	close(old.release)
+	if body := <-done; body != "slow-tile" {
+		t.Fatalf("body %q", body)
+	}
+	select {
+	case <-old.closed:
+	case <-time.After(time.Second):
+		t.Fatal("old tileset was not closed after the request finished")
+	}
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+func TestSelectOverview(t *testing.T) {
+	factors := []float64{2, 4, 8.02, 16}
+	for _, c := range []struct {
+		factor float64
+		level  int
+	}{
+		{0.5, -1},
+		{1, -1},
+		{1.9, -1},
+		{2, 0},
+		{7.5, 1},
+		{7.99, 2},
+		{8, 2},
+		{100, 3},
+	} {
+		if level := gdal.SelectOverview(factors, c.factor); level != c.level {
+			t.Errorf("SelectOverview(%v) = %d, want %d", c.factor, level, c.level)
+		}
+	}
+	if level := gdal.SelectOverview(nil, 8); level != -1 {
+		t.Errorf("SelectOverview without overviews = %d", level)
+	}
+}
+
+func TestOverviewLevels(t *testing.T) {
+	levels := gdal.OverviewLevels(5000, 3000, 256)
+	want := []int{2, 4, 8, 16, 32}
+	if len(levels) != len(want) {
+		t.Fatalf("OverviewLevels = %v, want %v", levels, want)
+	}
+	for i := range want {
+		if levels[i] != want[i] {
+			t.Fatalf("OverviewLevels = %v, want %v", levels, want)
+		}
+	}
+	if levels := gdal.OverviewLevels(200, 100, 256); len(levels) != 0 {
+		t.Errorf("small raster levels = %v", levels)
+	}
+}
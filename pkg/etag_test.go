@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pdxrlj/tile_server/pkg/server"
+)
+
+func TestTileConditionalRequests(t *testing.T) {
+	s := server.New(server.WithCacheControl("public, max-age=86400"))
+	defer s.Close()
+	err := s.SyncTilesets([]server.TilesetSource{
+		{Name: "dom", Type: server.TilesetDir, Path: writeDirTileset(t), CacheControl: "no-cache"},
+		{Name: "dem", Type: server.TilesetMBTiles, Path: writeMBTiles(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(url string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("/dom/2/3/1.png", nil)
+	etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if rec.Code != http.StatusOK || etag != server.TileETag([]byte("dir-tile")) || lastModified == "" {
+		t.Fatalf("status %d etag %s last-modified %s", rec.Code, etag, lastModified)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Fatalf("layer cache-control %q", cc)
+	}
+	// 同一瓦片从 WMTS 读取时 ETag 相同
+	if rec := request("/wmts/1.0.0/dom/default/WebMercatorQuad/2/1/3.png", nil); rec.Header().Get("ETag") != etag {
+		t.Fatalf("wmts etag %s", rec.Header().Get("ETag"))
+	}
+
+	if rec := request("/dom/2/3/1.png", map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("If-None-Match status %d", rec.Code)
+	}
+	if rec := request("/dom/2/3/1.png", map[string]string{"If-None-Match": `"other"`}); rec.Code != http.StatusOK {
+		t.Fatalf("changed etag status %d", rec.Code)
+	}
+	if rec := request("/dom/2/3/1.png", map[string]string{"If-Modified-Since": lastModified}); rec.Code != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since status %d", rec.Code)
+	}
+	past := time.Now().Add(-24 * time.Hour).UTC().Format(http.TimeFormat)
+	if rec := request("/dom/2/3/1.png", map[string]string{"If-Modified-Since": past}); rec.Code != http.StatusOK {
+		t.Fatalf("modified since yesterday status %d", rec.Code)
+	}
+
+	rec = request("/dem/1/1/0.png", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Fatalf("default cache-control %d %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	if rec := request("/dom/2/0/0.png", map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing tile status %d", rec.Code)
+	}
+}
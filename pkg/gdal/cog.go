@@ -0,0 +1,109 @@
+package gdal
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lukeroth/gdal"
+)
+
+const (
+	// COGInput 把原始输入影像转换为 COG,再重投影为 VRT
+	COGInput = "input"
+	// COGVrt 把重投影后的 VRT 转换为 COG,切片直接读取 COG
+	COGVrt = "vrt"
+)
+
+// COGOptions COG 驱动的创建参数
+type COGOptions struct {
+	BlockSize  int
+	Compress   string
+	Resampling string
+}
+
+type COGOption func(*COGOptions)
+
+func WithCOGBlockSize(blockSize int) COGOption {
+	return func(o *COGOptions) {
+		if blockSize > 0 {
+			o.BlockSize = blockSize
+		}
+	}
+}
+
+func WithCOGCompress(compress string) COGOption {
+	return func(o *COGOptions) {
+		if compress != "" {
+			o.Compress = compress
+		}
+	}
+}
+
+func WithCOGResampling(resampling string) COGOption {
+	return func(o *COGOptions) {
+		if resampling != "" {
+			o.Resampling = resampling
+		}
+	}
+}
+
+func DefaultCOGOptions() *COGOptions {
+	return &COGOptions{
+		BlockSize:  512,
+		Compress:   "DEFLATE",
+		Resampling: "AVERAGE",
+	}
+}
+
+func (o *COGOptions) translateArgs() []string {
+	return []string{
+		"-of", "COG",
+		"-co", "BLOCKSIZE=" + strconv.Itoa(o.BlockSize),
+		"-co", "COMPRESS=" + o.Compress,
+		"-co", "OVERVIEWS=AUTO",
+		"-co", "OVERVIEW_RESAMPLING=" + o.Resampling,
+		"-co", "BIGTIFF=IF_SAFER",
+		"-co", "NUM_THREADS=ALL_CPUS",
+	}
+}
+
+// TranslateCOG 转换为内部分块并带金字塔的 Cloud Optimized GeoTIFF
+func TranslateCOG(src gdal.Dataset, filename string, options ...COGOption) (gdal.Dataset, error) {
+	cogOptions := DefaultCOGOptions()
+	for _, option := range options {
+		option(cogOptions)
+	}
+
+	ds, err := gdal.Translate(filename, src, cogOptions.translateArgs())
+	if err != nil {
+		return gdal.Dataset{}, NewRunError().SetMessage(fmt.Sprintf("translate to COG %s: %s", filename, err))
+	}
+	return ds, nil
+}
+
+// OverviewFactors 各级 overview 相对原始分辨率的缩小倍数
+func OverviewFactors(band gdal.RasterBand) []float64 {
+	count := band.OverviewCount()
+	factors := make([]float64, 0, count)
+	for i := 0; i < count; i++ {
+		ov := band.Overview(i)
+		if ov.XSize() == 0 {
+			factors = append(factors, 0)
+			continue
+		}
+		factors = append(factors, float64(band.XSize())/float64(ov.XSize()))
+	}
+	return factors
+}
+
+// SelectOverview 选择缩小倍数不超过 factor 的最粗一级 overview,返回 -1 时读原始分辨率
+func SelectOverview(factors []float64, factor float64) int {
+	level, best := -1, 1.0
+	for i, f := range factors {
+		// 允许 1% 的取整误差
+		if f > best && f <= factor*1.01 {
+			level, best = i, f
+		}
+	}
+	return level
+}
@@ -0,0 +1,127 @@
+package gdal
+
+import (
+	"fmt"
+
+	"github.com/lukeroth/gdal"
+)
+
+// Cutline 裁切多边形,支持 GeoJSON / Shapefile 等 OGR 可读的矢量文件
+type Cutline struct {
+	Filename string
+	geometry gdal.Geometry
+	srs      gdal.SpatialReference
+	minx     float64
+	miny     float64
+	maxx     float64
+	maxy     float64
+}
+
+// NewCutline 读取矢量文件中的全部面要素,合并后转换到 epsg 坐标系
+func NewCutline(filename string, epsg int) (*Cutline, error) {
+	ds := gdal.OpenDataSource(filename, 0)
+	defer ds.Destroy()
+	if ds.LayerCount() == 0 {
+		return nil, NewRunError().SetMessage(fmt.Sprintf("open cutline %s: no layers", filename))
+	}
+
+	dstSrs := gdal.CreateSpatialReference("")
+	if err := dstSrs.FromEPSG(epsg); err != nil {
+		return nil, NewRunError().SetMessage(fmt.Sprintf("create spatial reference EPSG:%d: %s", epsg, err))
+	}
+	dstSrs.SetAxisMappingStrategy(gdal.OAMS_TraditionalGisOrder)
+
+	var merged *gdal.Geometry
+	for i := 0; i < ds.LayerCount(); i++ {
+		layer := ds.LayerByIndex(i)
+		layerSrs := layer.SpatialReference()
+		layerSrs.SetAxisMappingStrategy(gdal.OAMS_TraditionalGisOrder)
+		layer.ResetReading()
+		for feature := layer.NextFeature(); feature != nil; feature = layer.NextFeature() {
+			geometry := feature.Geometry().Clone()
+			feature.Destroy()
+			if geometry.IsNull() || geometry.IsEmpty() {
+				continue
+			}
+			geometry.SetSpatialReference(layerSrs)
+			if err := geometry.TransformTo(dstSrs); err != nil {
+				return nil, NewRunError().SetMessage(fmt.Sprintf("transform cutline %s: %s", filename, err))
+			}
+			if merged == nil {
+				merged = &geometry
+				continue
+			}
+			union := merged.Union(geometry)
+			merged.Destroy()
+			geometry.Destroy()
+			merged = &union
+		}
+	}
+	if merged == nil {
+		return nil, NewRunError().SetMessage(fmt.Sprintf("cutline %s has no polygon", filename))
+	}
+
+	return newCutline(filename, *merged, dstSrs), nil
+}
+
+// NewCutlineFromBBox 用 srcEpsg 坐标系下的矩形范围构造多边形,转换到 dstEpsg 坐标系
+func NewCutlineFromBBox(minx, miny, maxx, maxy float64, srcEpsg, dstEpsg int) (*Cutline, error) {
+	srcSrs := gdal.CreateSpatialReference("")
+	if err := srcSrs.FromEPSG(srcEpsg); err != nil {
+		return nil, NewRunError().SetMessage(fmt.Sprintf("create spatial reference EPSG:%d: %s", srcEpsg, err))
+	}
+	srcSrs.SetAxisMappingStrategy(gdal.OAMS_TraditionalGisOrder)
+	dstSrs := gdal.CreateSpatialReference("")
+	if err := dstSrs.FromEPSG(dstEpsg); err != nil {
+		return nil, NewRunError().SetMessage(fmt.Sprintf("create spatial reference EPSG:%d: %s", dstEpsg, err))
+	}
+	dstSrs.SetAxisMappingStrategy(gdal.OAMS_TraditionalGisOrder)
+
+	geometry, err := gdal.CreateFromWKT(boxWKT(minx, miny, maxx, maxy), srcSrs)
+	if err != nil {
+		return nil, NewRunError().SetMessage(fmt.Sprintf("create bbox %v: %s", []float64{minx, miny, maxx, maxy}, err))
+	}
+	if err := geometry.TransformTo(dstSrs); err != nil {
+		return nil, NewRunError().SetMessage(fmt.Sprintf("transform bbox %v: %s", []float64{minx, miny, maxx, maxy}, err))
+	}
+	return newCutline("", geometry, dstSrs), nil
+}
+
+func newCutline(filename string, geometry gdal.Geometry, srs gdal.SpatialReference) *Cutline {
+	envelope := geometry.Envelope()
+	return &Cutline{
+		Filename: filename,
+		geometry: geometry,
+		srs:      srs,
+		minx:     envelope.MinX(),
+		miny:     envelope.MinY(),
+		maxx:     envelope.MaxX(),
+		maxy:     envelope.MaxY(),
+	}
+}
+
+func boxWKT(minx, miny, maxx, maxy float64) string {
+	return fmt.Sprintf("POLYGON((%[1]f %[2]f,%[3]f %[2]f,%[3]f %[4]f,%[1]f %[4]f,%[1]f %[2]f))", minx, miny, maxx, maxy)
+}
+
+// Bounds 裁切多边形的外包范围
+func (c *Cutline) Bounds() (float64, float64, float64, float64) {
+	return c.minx, c.miny, c.maxx, c.maxy
+}
+
+// Intersects 判断矩形范围是否与裁切多边形相交,先比较外包范围再做精确判断
+func (c *Cutline) Intersects(minx, miny, maxx, maxy float64) bool {
+	if maxx < c.minx || minx > c.maxx || maxy < c.miny || miny > c.maxy {
+		return false
+	}
+	box, err := gdal.CreateFromWKT(boxWKT(minx, miny, maxx, maxy), c.srs)
+	if err != nil {
+		return true
+	}
+	defer box.Destroy()
+	return c.geometry.Intersects(box)
+}
+
+func (c *Cutline) Close() {
+	c.geometry.Destroy()
+}
@@ -4,6 +4,29 @@ import "errors"
 
 var (
 	ErrInputFilename = errors.New("input filename is empty")
+	ErrNotNorthUp    = errors.New("raster geotransform is not north-up")
+	ErrTileSize      = errors.New("tile size must be 256 or 512")
+
+	ErrAreaOfInterest = errors.New("area of interest bbox must be minx,miny,maxx,maxy")
+	ErrQuadKey        = errors.New("quadkey digits must be 0-3")
+
+	ErrNoSpatialReference = errors.New("no source spatial reference, set one with --s_srs")
+	ErrNoGeoreference     = errors.New("raster has no geotransform, GCPs or RPCs")
+	ErrNoGCP              = errors.New("gcp georeferencing requested but raster has no GCPs")
+	ErrNoRPC              = errors.New("rpc georeferencing requested but raster has no RPC metadata")
+	ErrGeoreference       = errors.New("unknown georeferencing method, use auto/gcp/tps/rpc")
+	ErrCOG                = errors.New("unknown COG preprocessing, use input/vrt")
+
+	ErrOutsideFootprint = errors.New("tile is outside the raster footprint")
+	ErrTileFormat       = errors.New("unknown tile format, use png/jpg")
+	ErrBandIndex        = errors.New("band index out of range")
+	ErrRescale          = errors.New("rescale must be min,max with min < max")
+	ErrColormap         = errors.New("colormap needs a single band and a known colormap_name")
+	ErrResampling       = errors.New("unknown resampling, use nearest/bilinear/cubic/cubicspline/lanczos/average/mode/gauss")
+	ErrNodata           = errors.New("nodata must be a number or nan")
+	ErrReturnMask       = errors.New("return_mask must be true or false")
+	ErrMapSize          = errors.New("map width and height must be between 1 and 4096")
+	ErrMapBBox          = errors.New("map bbox must be minx,miny,maxx,maxy with min < max")
 )
 
 type RunError struct {
@@ -1,34 +1,71 @@
 package gdal
 
 import (
+	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/lukeroth/gdal"
 )
 
 func CreateSpatialReference(epsg int) (string, error) {
 	sp := gdal.CreateSpatialReference("")
-	if epsg != 0 {
+	if epsg == 0 {
 		epsg = 3857
 	}
 	err := sp.FromEPSG(epsg)
 	if err != nil {
-		return "", nil
+		return "", NewRunError().SetMessage(fmt.Sprintf("create spatial reference EPSG:%d: %s", epsg, err))
 	}
 
 	return sp.ToWKT()
 }
 
-func SpatialReference(ds gdal.Dataset) (string, error) {
-	pro := ds.Projection()
+// ParseSpatialReference 解析 WKT、PROJ 字符串或 EPSG 编码(EPSG:4326 / 4326),返回 WKT
+func ParseSpatialReference(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", ErrNoSpatialReference
+	}
+	if _, err := strconv.Atoi(input); err == nil {
+		input = "EPSG:" + input
+	}
+
 	sp := gdal.CreateSpatialReference("")
-	err := sp.FromProj4(pro)
-	if err != nil {
-		return "", err
+	if err := sp.SetFromUserInput(input); err != nil {
+		return "", NewRunError().SetMessage(fmt.Sprintf("parse spatial reference %q: %s", input, err))
 	}
 	return sp.ToWKT()
 }
 
+// SpatialReference 获取数据集的源坐标系,依次尝试投影信息、GCP 投影,RPC 影像默认为 WGS84
+func SpatialReference(ds gdal.Dataset) (string, error) {
+	if pro := ds.Projection(); pro != "" {
+		return ParseSpatialReference(pro)
+	}
+	if ds.GDALGetGCPCount() > 0 {
+		if pro := ds.GDALGetGCPProjection(); pro != "" {
+			return ParseSpatialReference(pro)
+		}
+	}
+	if HasRPC(ds) {
+		return ParseSpatialReference("EPSG:4326")
+	}
+	return "", ErrNoSpatialReference
+}
+
+// HasGeoTransform 数据集是否有仿射变换,GDAL 在没有时返回 (0,1,0,0,0,1)
+func HasGeoTransform(ds gdal.Dataset) bool {
+	return ds.GeoTransform() != [6]float64{0, 1, 0, 0, 0, 1}
+}
+
+// HasRPC 数据集是否带有 RPC 有理多项式系数
+func HasRPC(ds gdal.Dataset) bool {
+	return len(ds.Metadata("RPC")) > 0
+}
+
 func CheckSpatialReferenceIsMercator(ds gdal.Dataset) bool {
 	spatialRef := gdal.CreateSpatialReference(ds.Projection())
 	if spatialRef.IsProjected() {
@@ -45,57 +82,96 @@ type VrtInfo struct {
 	Ds       gdal.Dataset
 }
 
-func WrapGdalVrt(src gdal.Dataset, epsgCode int) (*VrtInfo, error) {
-	tempFile, err := os.CreateTemp("", "*.vrt")
-	if err != nil {
-		return nil, err
-	}
-
-	ds := src
-
-	srcWkt, err := SpatialReference(ds)
+// WrapGdalVrt 把源影像 warp 到 epsgCode 坐标系,写入临时 VRT 文件,调用方负责删除
+func WrapGdalVrt(src gdal.Dataset, epsgCode int, options ...WrapOption) (*VrtInfo, error) {
+	warpedVRT, err := WarpDataset(src, epsgCode, options...)
 	if err != nil {
 		return nil, err
 	}
-
-	dstWkt, err := CreateSpatialReference(epsgCode)
+	vrt, err := gdal.GetDriverByName("VRT")
 	if err != nil {
+		warpedVRT.Close()
 		return nil, err
 	}
 
-	warpedVRT, err := ds.AutoCreateWarpedVRT(srcWkt, dstWkt, gdal.GRA_NearestNeighbour)
+	tempFile, err := os.CreateTemp("", "*.vrt")
 	if err != nil {
+		warpedVRT.Close()
 		return nil, err
 	}
-	vrt, err := gdal.GetDriverByName("VRT")
 
-	// 设置颜色表
-	colorTable := src.RasterBand(1).ColorTable()
-	for i := 1; i <= warpedVRT.RasterCount(); i++ {
-		err = warpedVRT.RasterBand(i).SetColorTable(colorTable)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	options := []string{
+	createOptions := []string{
 		"INIT_DEST=INIT_DEST",
 		"UNIFIED_SRC_NODATA=YES",
 	}
 	err = warpedVRT.SetMetadataItem("NODATA_VALUES", "0 0 0 0", "IMAGE_STRUCTURE")
 	if err != nil {
+		warpedVRT.Close()
+		_ = os.Remove(tempFile.Name())
 		return nil, err
 	}
-	warpedVRT = vrt.CreateCopy(tempFile.Name(), warpedVRT, 0, options, nil, nil)
+	copied := vrt.CreateCopy(tempFile.Name(), warpedVRT, 0, createOptions, nil, nil)
+	warpedVRT.Close()
 
 	vrtInfo := &VrtInfo{
 		Filename: tempFile.Name(),
-		Ds:       warpedVRT,
+		Ds:       copied,
 	}
 	_ = tempFile.Close()
 	return vrtInfo, nil
 }
 
+// WarpDataset 把源影像 warp 为内存中的 VRT 数据集,不落盘
+func WarpDataset(src gdal.Dataset, epsgCode int, options ...WrapOption) (gdal.Dataset, error) {
+	wrapOptions := DefaultWrapOptions()
+	for _, option := range options {
+		option(wrapOptions)
+	}
+
+	ds := src
+	if HasGeoTransform(ds) && !IsNorthUp(ds.GeoTransform()) {
+		// 旋转/错切的仿射变换不能直接按像素窗口读取，warp 后得到正北朝上的网格
+		fmt.Printf("源影像仿射变换存在旋转或错切:%v,通过 warp 重采样为正北朝上\n", ds.GeoTransform())
+	}
+
+	srcWkt := ""
+	var err error
+	if wrapOptions.SrcSRS != "" {
+		srcWkt, err = ParseSpatialReference(wrapOptions.SrcSRS)
+	} else {
+		srcWkt, err = SpatialReference(ds)
+	}
+	if err != nil {
+		return gdal.Dataset{}, err
+	}
+
+	dstWkt, err := CreateSpatialReference(epsgCode)
+	if err != nil {
+		return gdal.Dataset{}, err
+	}
+
+	warpOptions, err := wrapOptions.WarpArgs(NewSourceGeoreference(ds), srcWkt, dstWkt)
+	if err != nil {
+		return gdal.Dataset{}, err
+	}
+
+	warpedVRT, err := gdal.Warp("", nil, []gdal.Dataset{ds}, warpOptions)
+	if err != nil {
+		return gdal.Dataset{}, NewRunError().SetMessage(fmt.Sprintf("warp to EPSG:%d: %s", epsgCode, err))
+	}
+
+	// 设置颜色表
+	colorTable := src.RasterBand(1).ColorTable()
+	for i := 1; i <= warpedVRT.RasterCount(); i++ {
+		err = warpedVRT.RasterBand(i).SetColorTable(colorTable)
+		if err != nil {
+			warpedVRT.Close()
+			return gdal.Dataset{}, err
+		}
+	}
+	return warpedVRT, nil
+}
+
 type Gdal struct {
 	Height       int
 	Width        int
@@ -127,15 +203,54 @@ func (g *Gdal) GetGeoTransform() [6]float64 {
 	return g.GeoTransform
 }
 
+// GetBoundsByTransform 根据仿射变换计算影像四个角点的外包范围
 func (g *Gdal) GetBoundsByTransform() (float64, float64, float64, float64) {
-	transform := g.GetGeoTransform()
-	height := g.GetHeight()
-	width := g.GetWidth()
-
-	minx := transform[0]
-	maxy := transform[3]
-	maxx := minx + transform[1]*float64(width)
-	miny := maxy + transform[5]*float64(height)
+	return BoundsByTransform(g.GetGeoTransform(), g.GetWidth(), g.GetHeight())
+}
+
+// IsNorthUp 影像是否为正北朝上(无旋转、无错切)
+func (g *Gdal) IsNorthUp() bool {
+	return IsNorthUp(g.GetGeoTransform())
+}
+
+// IsNorthUp 仿射变换的旋转项为 0 且 y 方向分辨率为负时为正北朝上
+func IsNorthUp(transform [6]float64) bool {
+	return transform[2] == 0 && transform[4] == 0 && transform[1] > 0 && transform[5] < 0
+}
+
+// ApplyGeoTransform 像素坐标转换为地理坐标
+func ApplyGeoTransform(transform [6]float64, px, py float64) (float64, float64) {
+	x := transform[0] + px*transform[1] + py*transform[2]
+	y := transform[3] + px*transform[4] + py*transform[5]
+	return x, y
+}
+
+// InvertGeoTransform 求仿射变换的逆变换,用于地理坐标转像素坐标
+func InvertGeoTransform(transform [6]float64) ([6]float64, bool) {
+	det := transform[1]*transform[5] - transform[2]*transform[4]
+	if math.Abs(det) < 1e-15 {
+		return [6]float64{}, false
+	}
+	inv := 1 / det
+	var out [6]float64
+	out[1] = transform[5] * inv
+	out[2] = -transform[2] * inv
+	out[4] = -transform[4] * inv
+	out[5] = transform[1] * inv
+	out[0] = (transform[2]*transform[3] - transform[0]*transform[5]) * inv
+	out[3] = (-transform[1]*transform[3] + transform[0]*transform[4]) * inv
+	return out, true
+}
+
+// BoundsByTransform 用全部六个仿射参数计算四个角点,返回 minx, miny, maxx, maxy
+func BoundsByTransform(transform [6]float64, width, height int) (float64, float64, float64, float64) {
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{0, 0}, {float64(width), 0}, {0, float64(height)}, {float64(width), float64(height)}} {
+		x, y := ApplyGeoTransform(transform, corner[0], corner[1])
+		minx, maxx = math.Min(minx, x), math.Max(maxx, x)
+		miny, maxy = math.Min(miny, y), math.Max(maxy, y)
+	}
 	return minx, miny, maxx, maxy
 }
 
@@ -0,0 +1,69 @@
+package gdal
+
+import "math"
+
+// Geodetic EPSG:4326 经纬度切片方案,与 gdal2tiles 的 geodetic(TMS 兼容)一致,0 级为 2x1 个瓦片
+type Geodetic struct {
+	TileSize int
+	// 0 级分辨率,度/像素
+	ResFact float64
+}
+
+func NewGeodetic(tileSize int) *Geodetic {
+	return &Geodetic{
+		TileSize: tileSize,
+		ResFact:  180.0 / float64(tileSize),
+	}
+}
+
+func (g *Geodetic) Name() string {
+	return ProfileGeodetic
+}
+
+func (g *Geodetic) EPSG() int {
+	return 4326
+}
+
+func (g *Geodetic) Resolution(zoom int) float64 {
+	return g.ResFact / math.Pow(2, float64(zoom))
+}
+
+// MeterToTile converts lon, lat in degrees to tx, ty; the name follows the Profile interface
+func (g *Geodetic) MeterToTile(zoom int, lon, lat float64) (int, int) {
+	res := g.Resolution(zoom)
+	px := (lon + 180) / res
+	py := (lat + 90) / res
+	tx := int(math.Ceil(px/float64(g.TileSize)) - 1)
+	ty := int(math.Ceil(py/float64(g.TileSize)) - 1)
+	return tx, ty
+}
+
+// TileMetersBounds returns the bounds of a tile in degrees; the name follows the Profile interface
+func (g *Geodetic) TileMetersBounds(tz, tx, ty int) (float64, float64, float64, float64) {
+	size := g.Resolution(tz) * float64(g.TileSize)
+	return float64(tx)*size - 180, float64(ty)*size - 90, float64(tx+1)*size - 180, float64(ty+1)*size - 90
+}
+
+func (g *Geodetic) TileLatLonBounds(tz, tx, ty int) (float64, float64, float64, float64) {
+	return g.TileMetersBounds(tz, tx, ty)
+}
+
+func (g *Geodetic) MetersToLonLat(lon, lat float64) (float64, float64) {
+	return lon, lat
+}
+
+func (g *Geodetic) GoogleTile(tz, tx, ty int) (int, int) {
+	return tx, (1 << tz) - ty - 1
+}
+
+func (g *Geodetic) TMSTile(tz, tx, ty int) (int, int) {
+	return tx, (1 << tz) - ty - 1
+}
+
+func (g *Geodetic) MaxTile(zoom int) (int, int) {
+	return 1<<(zoom+1) - 1, 1<<zoom - 1
+}
+
+func (g *Geodetic) Origin() (float64, float64) {
+	return -180, -90
+}
@@ -2,6 +2,9 @@ package gdal
 
 import "math"
 
+// MaxZoomLevel the deepest zoom level supported by ZoomForPixelSize
+const MaxZoomLevel = 32
+
 type Mercator struct {
 	TileSize          int
 	OriginShift       float64
@@ -10,9 +13,11 @@ type Mercator struct {
 
 type MercatorOptions func(mercator *Mercator)
 
+// WithTileSize sets the tile size and the matching zoom 0 resolution
 func WithTileSize(tileSize int) MercatorOptions {
 	return func(mercator *Mercator) {
 		mercator.TileSize = tileSize
+		mercator.InitialResolution = 2 * mercator.OriginShift / float64(tileSize)
 	}
 }
 
@@ -44,6 +49,24 @@ func NewMercator(options ...MercatorOptions) *Mercator {
 	return m
 }
 
+func (m *Mercator) Name() string {
+	return ProfileMercator
+}
+
+func (m *Mercator) EPSG() int {
+	return 3857
+}
+
+// MaxTile returns the largest tile x, y at the zoom level
+func (m *Mercator) MaxTile(zoom int) (int, int) {
+	return 1<<zoom - 1, 1<<zoom - 1
+}
+
+// Origin returns the lower left corner of tile 0, 0 in meters
+func (m *Mercator) Origin() (float64, float64) {
+	return -m.OriginShift, -m.OriginShift
+}
+
 func (m *Mercator) Resolution(zoom int) float64 {
 	return m.InitialResolution / math.Pow(2, float64(zoom))
 }
@@ -77,21 +100,94 @@ func (m *Mercator) PixelsToTile(px, py float64) (int, int) {
 	return tx, ty
 }
 
-func (m *Mercator) tileToLat(ty, tz int) float64 {
-	n := math.Pi - 2.0*math.Pi*float64(ty)/math.Pow(2.0, float64(tz))
-	lat := 180.0 / math.Pi * math.Atan(0.5*(math.Exp(n)-math.Exp(-n)))
-	return lat
+// LonLatToMeters converts WGS84 lon, lat to EPSG:3857 meters
+// lon, lat: degrees
+func (m *Mercator) LonLatToMeters(lon, lat float64) (float64, float64) {
+	mx := lon * m.OriginShift / 180.0
+	my := math.Log(math.Tan((90+lat)*math.Pi/360.0)) / (math.Pi / 180.0)
+	my = my * m.OriginShift / 180.0
+	return mx, my
 }
 
-func (m *Mercator) tileToLon(tx, tz int) float64 {
-	lon := float64(tx)/math.Pow(2.0, float64(tz))*360.0 - 180.0
-	return lon
+// MetersToLonLat converts EPSG:3857 meters to WGS84 lon, lat
+// mx, my: meters
+func (m *Mercator) MetersToLonLat(mx, my float64) (float64, float64) {
+	lon := mx / m.OriginShift * 180.0
+	lat := my / m.OriginShift * 180.0
+	lat = 180 / math.Pi * (2*math.Atan(math.Exp(lat*math.Pi/180.0)) - math.Pi/2.0)
+	return lon, lat
 }
 
-func (m *Mercator) tileToLonLat(tx, ty, tz int) (float64, float64) {
-	lat := m.tileToLat(ty, tz)
-	lon := m.tileToLon(tx, tz)
-	return lon, lat
+// GoogleTile converts TMS tile coordinates to Google/XYZ tile coordinates
+// tz: zoom level
+// tx, ty: TMS tile coordinates, y counted from the south
+func (m *Mercator) GoogleTile(tz, tx, ty int) (int, int) {
+	return tx, (1 << tz) - ty - 1
+}
+
+// TMSTile converts Google/XYZ tile coordinates to TMS tile coordinates
+// tz: zoom level
+// tx, ty: XYZ tile coordinates, y counted from the north
+func (m *Mercator) TMSTile(tz, tx, ty int) (int, int) {
+	return tx, (1 << tz) - ty - 1
+}
+
+// QuadKey converts TMS tile coordinates to a Bing Maps quadkey
+// tz: zoom level
+// tx, ty: TMS tile coordinates
+func (m *Mercator) QuadKey(tz, tx, ty int) string {
+	_, ty = m.GoogleTile(tz, tx, ty)
+	key := make([]byte, 0, tz)
+	for i := tz; i > 0; i-- {
+		digit := byte('0')
+		mask := 1 << (i - 1)
+		if tx&mask != 0 {
+			digit++
+		}
+		if ty&mask != 0 {
+			digit += 2
+		}
+		key = append(key, digit)
+	}
+	return string(key)
+}
+
+// QuadKeyToTile converts a Bing Maps quadkey to TMS tile coordinates
+// returns tz, tx, ty
+func (m *Mercator) QuadKeyToTile(quadKey string) (int, int, int, error) {
+	tz := len(quadKey)
+	tx, ty := 0, 0
+	for i := tz; i > 0; i-- {
+		mask := 1 << (i - 1)
+		switch quadKey[tz-i] {
+		case '0':
+		case '1':
+			tx |= mask
+		case '2':
+			ty |= mask
+		case '3':
+			tx |= mask
+			ty |= mask
+		default:
+			return 0, 0, 0, ErrQuadKey
+		}
+	}
+	tx, ty = m.TMSTile(tz, tx, ty)
+	return tz, tx, ty, nil
+}
+
+// ZoomForPixelSize returns the max zoom level whose resolution is not finer than pixelSize
+// pixelSize: meters per pixel of the source raster
+func (m *Mercator) ZoomForPixelSize(pixelSize float64) int {
+	for zoom := 0; zoom < MaxZoomLevel; zoom++ {
+		if pixelSize > m.Resolution(zoom) {
+			if zoom == 0 {
+				return 0
+			}
+			return zoom - 1
+		}
+	}
+	return MaxZoomLevel - 1
 }
 
 // TileMetersBounds returns the bounds of a tile in meters
@@ -103,6 +199,16 @@ func (m *Mercator) TileMetersBounds(tz, tx, ty int) (float64, float64, float64,
 	return minx, miny, maxx, maxy
 }
 
+// TileLatLonBounds returns the bounds of a tile in WGS84 lon, lat
+// tz: zoom level
+// tx, ty: tile coordinates
+func (m *Mercator) TileLatLonBounds(tz, tx, ty int) (float64, float64, float64, float64) {
+	minx, miny, maxx, maxy := m.TileMetersBounds(tz, tx, ty)
+	west, south := m.MetersToLonLat(minx, miny)
+	east, north := m.MetersToLonLat(maxx, maxy)
+	return west, south, east, north
+}
+
 func (m *Mercator) PixelsToMeters(px, py float64, tz int) (float64, float64) {
 	res := m.Resolution(tz)
 	mx := px*res - m.OriginShift
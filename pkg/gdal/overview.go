@@ -0,0 +1,38 @@
+package gdal
+
+import (
+	"fmt"
+
+	"github.com/lukeroth/gdal"
+)
+
+// OverviewLevels 逐级缩小一半的 overview 倍数,直到长边小于 minSize
+func OverviewLevels(width, height, minSize int) []int {
+	var levels []int
+	for factor := 2; max(width, height)/(factor/2) > minSize; factor *= 2 {
+		levels = append(levels, factor)
+	}
+	return levels
+}
+
+// BuildExternalOverviews 源影像没有 overview 时生成外部 .ovr 金字塔,只读打开时 GDAL 写入 {filename}.ovr
+func BuildExternalOverviews(filename, resampling string, minSize int) error {
+	ds, err := gdal.Open(filename, gdal.ReadOnly)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	if ds.RasterCount() == 0 || ds.RasterBand(1).OverviewCount() > 0 {
+		return nil
+	}
+	levels := OverviewLevels(ds.RasterXSize(), ds.RasterYSize(), minSize)
+	if len(levels) == 0 {
+		return nil
+	}
+	fmt.Printf("生成外部金字塔:%s.ovr %v\n", filename, levels)
+	if err := ds.BuildOverviews(resampling, len(levels), levels, 0, nil, gdal.DummyProgress, nil); err != nil {
+		return NewRunError().SetMessage(fmt.Sprintf("build overviews %s: %s", filename, err))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package gdal
+
+import "errors"
+
+const (
+	ProfileMercator = "mercator"
+	ProfileGeodetic = "geodetic"
+)
+
+var ErrProfile = errors.New("unknown tile profile, use mercator/geodetic")
+
+// Profile 瓦片金字塔的切片方案,坐标单位为该方案坐标系的单位(墨卡托为米,经纬度为度)
+// 方法名中的 Meters 沿用墨卡托方案的叫法,geodetic 方案下参数和返回值都是度
+type Profile interface {
+	Name() string
+	EPSG() int
+	// Resolution 该层级每个像素对应的坐标单位(米或度)
+	Resolution(zoom int) float64
+	// MeterToTile 方案坐标系下的 x, y(米或经纬度)所在的 TMS 瓦片号
+	MeterToTile(zoom int, mx, my float64) (int, int)
+	// TileMetersBounds TMS 瓦片在方案坐标系下的范围 minx, miny, maxx, maxy(米或度)
+	TileMetersBounds(tz, tx, ty int) (float64, float64, float64, float64)
+	// TileLatLonBounds TMS 瓦片的经纬度范围 west, south, east, north
+	TileLatLonBounds(tz, tx, ty int) (float64, float64, float64, float64)
+	// MetersToLonLat 方案坐标系下的 x, y 转换为经度、纬度
+	MetersToLonLat(mx, my float64) (float64, float64)
+	// GoogleTile TMS 行号转换为 XYZ 行号
+	GoogleTile(tz, tx, ty int) (int, int)
+	// TMSTile XYZ 行号转换为 TMS 行号
+	TMSTile(tz, tx, ty int) (int, int)
+	// MaxTile 该层级最大的瓦片行列号
+	MaxTile(zoom int) (int, int)
+	// Origin 瓦片行列号 0,0 的左下角坐标
+	Origin() (float64, float64)
+}
+
+// NewProfile 根据名称创建切片方案
+func NewProfile(name string, tileSize int) (Profile, error) {
+	switch name {
+	case "", ProfileMercator:
+		return NewMercator(WithTileSize(tileSize)), nil
+	case ProfileGeodetic:
+		return NewGeodetic(tileSize), nil
+	}
+	return nil, ErrProfile
+}
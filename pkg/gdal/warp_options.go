@@ -0,0 +1,171 @@
+package gdal
+
+import (
+	"strconv"
+
+	"github.com/lukeroth/gdal"
+)
+
+const (
+	GeoreferenceAuto = "auto"
+	GeoreferenceGCP  = "gcp"
+	GeoreferenceTPS  = "tps"
+	GeoreferenceRPC  = "rpc"
+)
+
+// WrapOptions WrapGdalVrt 的 warp 参数
+type WrapOptions struct {
+	// 覆盖源影像坐标系,支持 WKT、PROJ、EPSG
+	SrcSRS string
+	// 地理参考方式 auto/gcp/tps/rpc
+	Georeference string
+	// 重采样方式
+	Resampling string
+	// 裁切多边形文件,多边形外的像素透明
+	Cutline string
+	// 读取源影像的 overview 级别,-1 为原始分辨率
+	OverviewLevel int
+	// 输出范围和像素大小,单位为目标坐标系,WMS GetMap 按请求的 bbox/width/height 输出
+	TargetExtent *[4]float64
+	TargetWidth  int
+	TargetHeight int
+	// 追加 alpha 波段,源影像范围外的像素 alpha 为 0
+	DstAlpha bool
+}
+
+type WrapOption func(*WrapOptions)
+
+func WithSrcSRS(srs string) WrapOption {
+	return func(o *WrapOptions) {
+		o.SrcSRS = srs
+	}
+}
+
+func WithGeoreference(method string) WrapOption {
+	return func(o *WrapOptions) {
+		if method != "" {
+			o.Georeference = method
+		}
+	}
+}
+
+func WithResampling(resampling string) WrapOption {
+	return func(o *WrapOptions) {
+		if resampling != "" {
+			o.Resampling = resampling
+		}
+	}
+}
+
+func WithCutline(filename string) WrapOption {
+	return func(o *WrapOptions) {
+		o.Cutline = filename
+	}
+}
+
+// WithOverviewLevel 从源影像指定级别的 overview 重投影,输出分辨率随之变粗
+func WithOverviewLevel(level int) WrapOption {
+	return func(o *WrapOptions) {
+		o.OverviewLevel = level
+	}
+}
+
+// WithTargetExtent 输出范围 minx,miny,maxx,maxy,单位为目标坐标系
+func WithTargetExtent(minx, miny, maxx, maxy float64) WrapOption {
+	return func(o *WrapOptions) {
+		o.TargetExtent = &[4]float64{minx, miny, maxx, maxy}
+	}
+}
+
+// WithTargetSize 输出的像素宽高
+func WithTargetSize(width, height int) WrapOption {
+	return func(o *WrapOptions) {
+		o.TargetWidth, o.TargetHeight = width, height
+	}
+}
+
+// WithDstAlpha 输出追加 alpha 波段,WMS GetMap 的 return_mask 由它得到影像范围外的透明
+func WithDstAlpha(dstAlpha bool) WrapOption {
+	return func(o *WrapOptions) {
+		o.DstAlpha = dstAlpha
+	}
+}
+
+func DefaultWrapOptions() *WrapOptions {
+	return &WrapOptions{
+		Georeference:  GeoreferenceAuto,
+		Resampling:    "near",
+		OverviewLevel: -1,
+	}
+}
+
+// SourceGeoreference 源影像带有的地理参考信息
+type SourceGeoreference struct {
+	GeoTransform bool
+	GCP          bool
+	RPC          bool
+}
+
+func NewSourceGeoreference(ds gdal.Dataset) SourceGeoreference {
+	return SourceGeoreference{
+		GeoTransform: HasGeoTransform(ds),
+		GCP:          ds.GDALGetGCPCount() > 0,
+		RPC:          HasRPC(ds),
+	}
+}
+
+// WarpArgs 按地理参考方式组装 gdalwarp 参数,输出为内存 VRT
+func (o *WrapOptions) WarpArgs(src SourceGeoreference, srcWkt, dstWkt string) ([]string, error) {
+	args := []string{
+		"-of", "VRT",
+		"-s_srs", srcWkt,
+		"-t_srs", dstWkt,
+		"-r", o.Resampling,
+		"-wo", "UNIFIED_SRC_NODATA=YES",
+	}
+	if o.OverviewLevel >= 0 {
+		args = append(args, "-ovr", strconv.Itoa(o.OverviewLevel))
+	}
+	if e := o.TargetExtent; e != nil {
+		args = append(args, "-te",
+			strconv.FormatFloat(e[0], 'f', -1, 64), strconv.FormatFloat(e[1], 'f', -1, 64),
+			strconv.FormatFloat(e[2], 'f', -1, 64), strconv.FormatFloat(e[3], 'f', -1, 64))
+	}
+	if o.TargetWidth > 0 && o.TargetHeight > 0 {
+		args = append(args, "-ts", strconv.Itoa(o.TargetWidth), strconv.Itoa(o.TargetHeight))
+	}
+	if o.Cutline != "" {
+		// 多边形外写入 alpha=0,范围裁到多边形外包
+		args = append(args, "-cutline", o.Cutline, "-crop_to_cutline", "-dstalpha")
+	} else if o.DstAlpha {
+		args = append(args, "-dstalpha")
+	}
+
+	switch o.Georeference {
+	case GeoreferenceAuto:
+		if src.GeoTransform || src.GCP {
+			return args, nil
+		}
+		if src.RPC {
+			return append(args, "-rpc"), nil
+		}
+		return nil, ErrNoGeoreference
+	case GeoreferenceGCP:
+		// 一阶多项式强制使用 GCP 变换
+		if !src.GCP {
+			return nil, ErrNoGCP
+		}
+		return append(args, "-order", "1"), nil
+	case GeoreferenceTPS:
+		if !src.GCP {
+			return nil, ErrNoGCP
+		}
+		return append(args, "-tps"), nil
+	case GeoreferenceRPC:
+		if !src.RPC {
+			return nil, ErrNoRPC
+		}
+		return append(args, "-rpc"), nil
+	}
+	return nil, ErrGeoreference
+}
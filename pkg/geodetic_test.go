@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"path/filepath"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestGeodeticResolution(t *testing.T) {
+	tests := []struct {
+		tileSize int
+		zoom     int
+		want     float64
+	}{
+		{256, 0, 180.0 / 256},
+		{256, 1, 90.0 / 256},
+		{512, 0, 180.0 / 512},
+		{512, 3, 22.5 / 512},
+	}
+	for _, tt := range tests {
+		if got := pkgGdal.NewGeodetic(tt.tileSize).Resolution(tt.zoom); !almostEqual(got, tt.want, 1e-15) {
+			t.Errorf("tile size %d: Resolution(%d) = %g, want %g", tt.tileSize, tt.zoom, got, tt.want)
+		}
+	}
+}
+
+func TestGeodeticTiles(t *testing.T) {
+	g := pkgGdal.NewGeodetic(256)
+
+	// 0 级为 2x1 个瓦片
+	if x, y := g.MaxTile(0); x != 1 || y != 0 {
+		t.Errorf("MaxTile(0) = %d, %d", x, y)
+	}
+	if x, y := g.MaxTile(2); x != 7 || y != 3 {
+		t.Errorf("MaxTile(2) = %d, %d", x, y)
+	}
+
+	tests := []struct {
+		z, x, y int
+		bounds  [4]float64
+	}{
+		{0, 0, 0, [4]float64{-180, -90, 0, 90}},
+		{0, 1, 0, [4]float64{0, -90, 180, 90}},
+		{1, 3, 1, [4]float64{90, 0, 180, 90}},
+		{2, 0, 0, [4]float64{-180, -90, -135, -45}},
+	}
+	for _, tt := range tests {
+		minx, miny, maxx, maxy := g.TileMetersBounds(tt.z, tt.x, tt.y)
+		got := [4]float64{minx, miny, maxx, maxy}
+		if got != tt.bounds {
+			t.Errorf("TileMetersBounds(%d, %d, %d) = %v, want %v", tt.z, tt.x, tt.y, got, tt.bounds)
+		}
+		west, south, east, north := g.TileLatLonBounds(tt.z, tt.x, tt.y)
+		if [4]float64{west, south, east, north} != tt.bounds {
+			t.Errorf("TileLatLonBounds(%d, %d, %d) differs from TileMetersBounds", tt.z, tt.x, tt.y)
+		}
+		// 瓦片中心点落回同一瓦片,单位为度
+		tx, ty := g.MeterToTile(tt.z, (minx+maxx)/2, (miny+maxy)/2)
+		if tx != tt.x || ty != tt.y {
+			t.Errorf("MeterToTile center of %d/%d/%d = %d, %d", tt.z, tt.x, tt.y, tx, ty)
+		}
+	}
+
+	if x, y := g.GoogleTile(2, 5, 0); x != 5 || y != 3 {
+		t.Errorf("GoogleTile(2, 5, 0) = %d, %d", x, y)
+	}
+	if x, y := g.TMSTile(2, 5, 3); x != 5 || y != 0 {
+		t.Errorf("TMSTile(2, 5, 3) = %d, %d", x, y)
+	}
+	if lon, lat := g.MetersToLonLat(116.4, 39.9); lon != 116.4 || lat != 39.9 {
+		t.Errorf("MetersToLonLat = %f, %f", lon, lat)
+	}
+	if _, err := pkgGdal.NewProfile("utm", 256); err != pkgGdal.ErrProfile {
+		t.Errorf("NewProfile(utm) err = %v", err)
+	}
+}
+
+func TestKMLHref(t *testing.T) {
+	tests := []struct {
+		dir, target string
+		want        string
+	}{
+		{"out/3/5", "out/3/5/2.png", "2.png"},
+		{"out/3/5", "out/4/10/4.kml", "../../4/10/4.kml"},
+		{"out", "out/0/0/0.kml", "0/0/0.kml"},
+	}
+	for _, tt := range tests {
+		got := tile.KMLHref(filepath.FromSlash(tt.dir), filepath.FromSlash(tt.target))
+		if got != tt.want {
+			t.Errorf("KMLHref(%s, %s) = %s, want %s", tt.dir, tt.target, got, tt.want)
+		}
+	}
+}
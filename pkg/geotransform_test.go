@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestBoundsByTransform(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform [6]float64
+		want      [4]float64
+	}{
+		{"north up", [6]float64{100, 10, 0, 500, 0, -10}, [4]float64{100, 300, 300, 500}},
+		// 旋转 90 度:x 随行号增加,y 随列号增加
+		{"rotated", [6]float64{100, 0, 10, 500, 10, 0}, [4]float64{100, 500, 300, 700}},
+		{"sheared", [6]float64{0, 1, 0.5, 0, 0, -1}, [4]float64{0, -20, 30, 0}},
+	}
+	for _, tt := range tests {
+		minx, miny, maxx, maxy := pkgGdal.BoundsByTransform(tt.transform, 20, 20)
+		got := [4]float64{minx, miny, maxx, maxy}
+		for i := range got {
+			if !almostEqual(got[i], tt.want[i], 1e-9) {
+				t.Errorf("%s: BoundsByTransform = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestInvertGeoTransform(t *testing.T) {
+	transform := [6]float64{100, 2, 0.5, 500, 0.25, -3}
+	inv, ok := pkgGdal.InvertGeoTransform(transform)
+	if !ok {
+		t.Fatal("InvertGeoTransform failed")
+	}
+	for _, p := range [][2]float64{{0, 0}, {10, 20}, {-5, 7.5}} {
+		x, y := pkgGdal.ApplyGeoTransform(transform, p[0], p[1])
+		px, py := pkgGdal.ApplyGeoTransform(inv, x, y)
+		if !almostEqual(px, p[0], 1e-9) || !almostEqual(py, p[1], 1e-9) {
+			t.Errorf("round trip %v = %f, %f", p, px, py)
+		}
+	}
+	if _, ok := pkgGdal.InvertGeoTransform([6]float64{0, 1, 2, 0, 2, 4}); ok {
+		t.Error("singular transform inverted")
+	}
+	if !pkgGdal.IsNorthUp([6]float64{0, 1, 0, 0, 0, -1}) || pkgGdal.IsNorthUp(transform) {
+		t.Error("IsNorthUp")
+	}
+}
+
+func TestWindowReadBox(t *testing.T) {
+	tests := []struct {
+		name string
+		box  tile.WindowsReadBox
+		want tile.Window
+	}{
+		{
+			name: "inside",
+			box:  tile.WindowsReadBox{Minx: 10, Maxy: -10, Maxx: 20, Miny: -20, TileSize: 4, Width: 100, Height: 100, GeoTransform: [6]float64{0, 1, 0, 0, 0, -1}},
+			want: tile.Window{Rx: 10, Ry: 10, RxSize: 10, RySize: 10, WxSize: 16, WySize: 16},
+		},
+		{
+			// 瓦片左上角超出影像,写入位置向右下偏移;与 gdal2tiles 一样 rx 向 0 取整为 -4
+			name: "clipped top left",
+			box:  tile.WindowsReadBox{Minx: -5, Maxy: 5, Maxx: 5, Miny: -5, TileSize: 4, Width: 100, Height: 100, GeoTransform: [6]float64{0, 1, 0, 0, 0, -1}},
+			want: tile.Window{Rx: 0, Ry: 0, RxSize: 6, RySize: 6, Wx: 6, Wy: 6, WxSize: 10, WySize: 10},
+		},
+		{
+			name: "clipped bottom right",
+			box:  tile.WindowsReadBox{Minx: 95, Maxy: -95, Maxx: 105, Miny: -105, TileSize: 4, Width: 100, Height: 100, GeoTransform: [6]float64{0, 1, 0, 0, 0, -1}},
+			want: tile.Window{Rx: 95, Ry: 95, RxSize: 5, RySize: 5, WxSize: 8, WySize: 8},
+		},
+		{
+			// 旋转 90 度的影像按逆变换取外包窗口
+			name: "rotated",
+			box:  tile.WindowsReadBox{Minx: 10, Maxy: 20, Maxx: 20, Miny: 10, TileSize: 4, Width: 100, Height: 100, GeoTransform: [6]float64{0, 0, 1, 0, 1, 0}},
+			want: tile.Window{Rx: 10, Ry: 10, RxSize: 10, RySize: 10, WxSize: 16, WySize: 16},
+		},
+	}
+	for _, tt := range tests {
+		got := tile.NewWindows().ReadBox(&tt.box)
+		if *got != tt.want {
+			t.Errorf("%s: ReadBox = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
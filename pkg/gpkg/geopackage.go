@@ -0,0 +1,271 @@
+package gpkg
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// GeoPackage 1.3 https://www.geopackage.org/spec130/
+const (
+	// ApplicationID "GPKG"
+	ApplicationID = 0x47504B47
+	UserVersion   = 10300
+	// batchSize 每个事务写入的瓦片数
+	batchSize = 1000
+)
+
+var (
+	ErrTableName    = errors.New("geopackage: table name must be a valid sql identifier")
+	ErrTileNotFound = errors.New("geopackage: tile not found")
+	tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// TileMatrixSet 瓦片矩阵集,范围为 0 级瓦片网格的外包范围,行号从左上角开始
+type TileMatrixSet struct {
+	TableName   string
+	Identifier  string
+	Description string
+	SRSID       int
+	MinX, MinY  float64
+	MaxX, MaxY  float64
+	// ContentsBounds 数据实际范围,写入 gpkg_contents
+	ContentsBounds [4]float64
+}
+
+// TileMatrix 单个层级的瓦片矩阵
+type TileMatrix struct {
+	ZoomLevel    int
+	MatrixWidth  int
+	MatrixHeight int
+	TileWidth    int
+	TileHeight   int
+	PixelXSize   float64
+	PixelYSize   float64
+}
+
+type GeoPackage struct {
+	db    *sql.DB
+	table string
+	mu    sync.Mutex
+	tx    *sql.Tx
+	stmt  *sql.Stmt
+	count int
+}
+
+// Create 新建 GeoPackage 并写入瓦片矩阵集与各层级的瓦片矩阵,已存在的文件会被覆盖
+func Create(filename string, set TileMatrixSet, matrices []TileMatrix) (*GeoPackage, error) {
+	if !tableNameRegexp.MatchString(set.TableName) {
+		return nil, ErrTableName
+	}
+	srs, err := lookupSpatialRefSys(set.SRSID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	g := &GeoPackage{db: db, table: set.TableName}
+	if err := g.init(set, srs, matrices); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// Open 只读打开 GeoPackage 的瓦片表
+func Open(filename, table string) (*GeoPackage, error) {
+	if !tableNameRegexp.MatchString(table) {
+		return nil, ErrTableName
+	}
+	db, err := sql.Open("sqlite3", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	return &GeoPackage{db: db, table: table}, nil
+}
+
+func (g *GeoPackage) init(set TileMatrixSet, srs SpatialRefSys, matrices []TileMatrix) error {
+	statements := []string{
+		fmt.Sprintf("PRAGMA application_id = %d", ApplicationID),
+		fmt.Sprintf("PRAGMA user_version = %d", UserVersion),
+		`CREATE TABLE gpkg_spatial_ref_sys (
+			srs_name TEXT NOT NULL,
+			srs_id INTEGER PRIMARY KEY,
+			organization TEXT NOT NULL,
+			organization_coordsys_id INTEGER NOT NULL,
+			definition TEXT NOT NULL,
+			description TEXT)`,
+		`CREATE TABLE gpkg_contents (
+			table_name TEXT NOT NULL PRIMARY KEY,
+			data_type TEXT NOT NULL,
+			identifier TEXT UNIQUE,
+			description TEXT DEFAULT '',
+			last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			min_x DOUBLE, min_y DOUBLE, max_x DOUBLE, max_y DOUBLE,
+			srs_id INTEGER,
+			CONSTRAINT fk_gc_r_srs_id FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys(srs_id))`,
+		`CREATE TABLE gpkg_geometry_columns (
+			table_name TEXT NOT NULL,
+			column_name TEXT NOT NULL,
+			geometry_type_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL,
+			z TINYINT NOT NULL,
+			m TINYINT NOT NULL,
+			CONSTRAINT pk_geom_cols PRIMARY KEY (table_name, column_name))`,
+		`CREATE TABLE gpkg_tile_matrix_set (
+			table_name TEXT NOT NULL PRIMARY KEY,
+			srs_id INTEGER NOT NULL,
+			min_x DOUBLE NOT NULL, min_y DOUBLE NOT NULL, max_x DOUBLE NOT NULL, max_y DOUBLE NOT NULL,
+			CONSTRAINT fk_gtms_table_name FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name),
+			CONSTRAINT fk_gtms_srs FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys (srs_id))`,
+		`CREATE TABLE gpkg_tile_matrix (
+			table_name TEXT NOT NULL,
+			zoom_level INTEGER NOT NULL,
+			matrix_width INTEGER NOT NULL,
+			matrix_height INTEGER NOT NULL,
+			tile_width INTEGER NOT NULL,
+			tile_height INTEGER NOT NULL,
+			pixel_x_size DOUBLE NOT NULL,
+			pixel_y_size DOUBLE NOT NULL,
+			CONSTRAINT pk_ttm PRIMARY KEY (table_name, zoom_level),
+			CONSTRAINT fk_tmm_table_name FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name))`,
+		fmt.Sprintf(`CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			zoom_level INTEGER NOT NULL,
+			tile_column INTEGER NOT NULL,
+			tile_row INTEGER NOT NULL,
+			tile_data BLOB NOT NULL,
+			UNIQUE (zoom_level, tile_column, tile_row))`, g.table),
+	}
+	for _, statement := range statements {
+		if _, err := g.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range []int{-1, 0, 4326, srs.ID} {
+		ref := spatialRefSys[id]
+		if _, err := g.db.Exec(`INSERT OR IGNORE INTO gpkg_spatial_ref_sys VALUES (?, ?, ?, ?, ?, ?)`,
+			ref.Name, ref.ID, ref.Organization, ref.OrgID, ref.Definition, ref.Description); err != nil {
+			return err
+		}
+	}
+
+	identifier := set.Identifier
+	if identifier == "" {
+		identifier = set.TableName
+	}
+	bounds := set.ContentsBounds
+	if _, err := g.db.Exec(`INSERT INTO gpkg_contents (table_name, data_type, identifier, description, last_change, min_x, min_y, max_x, max_y, srs_id)
+		VALUES (?, 'tiles', ?, ?, ?, ?, ?, ?, ?, ?)`,
+		set.TableName, identifier, set.Description, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		bounds[0], bounds[1], bounds[2], bounds[3], set.SRSID); err != nil {
+		return err
+	}
+	if _, err := g.db.Exec(`INSERT INTO gpkg_tile_matrix_set VALUES (?, ?, ?, ?, ?, ?)`,
+		set.TableName, set.SRSID, set.MinX, set.MinY, set.MaxX, set.MaxY); err != nil {
+		return err
+	}
+	for _, m := range matrices {
+		if _, err := g.db.Exec(`INSERT INTO gpkg_tile_matrix VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			set.TableName, m.ZoomLevel, m.MatrixWidth, m.MatrixHeight, m.TileWidth, m.TileHeight, m.PixelXSize, m.PixelYSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTile 写入瓦片,row 从上往下计数,可并发调用,按批提交事务
+func (g *GeoPackage) WriteTile(zoom, column, row int, data []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.tx == nil {
+		tx, err := g.db.Begin()
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(fmt.Sprintf(`INSERT OR REPLACE INTO %s (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`, g.table))
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		g.tx, g.stmt = tx, stmt
+	}
+	if _, err := g.stmt.Exec(zoom, column, row, data); err != nil {
+		return err
+	}
+	g.count++
+	if g.count%batchSize == 0 {
+		return g.commit()
+	}
+	return nil
+}
+
+func (g *GeoPackage) commit() error {
+	if g.tx == nil {
+		return nil
+	}
+	_ = g.stmt.Close()
+	err := g.tx.Commit()
+	g.tx, g.stmt = nil, nil
+	return err
+}
+
+// ReadTile 读取瓦片,row 从上往下计数
+func (g *GeoPackage) ReadTile(zoom, column, row int) ([]byte, error) {
+	var data []byte
+	err := g.db.QueryRow(fmt.Sprintf(`SELECT tile_data FROM %s WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`, g.table),
+		zoom, column, row).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTileNotFound
+	}
+	return data, err
+}
+
+// TileMatrices 读取瓦片矩阵,按层级升序
+func (g *GeoPackage) TileMatrices() ([]TileMatrix, error) {
+	rows, err := g.db.Query(`SELECT zoom_level, matrix_width, matrix_height, tile_width, tile_height, pixel_x_size, pixel_y_size
+		FROM gpkg_tile_matrix WHERE table_name = ? ORDER BY zoom_level`, g.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var matrices []TileMatrix
+	for rows.Next() {
+		m := TileMatrix{}
+		if err := rows.Scan(&m.ZoomLevel, &m.MatrixWidth, &m.MatrixHeight, &m.TileWidth, &m.TileHeight, &m.PixelXSize, &m.PixelYSize); err != nil {
+			return nil, err
+		}
+		matrices = append(matrices, m)
+	}
+	return matrices, rows.Err()
+}
+
+// Close 提交未完成的事务并关闭数据库
+func (g *GeoPackage) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.commit(); err != nil {
+		_ = g.db.Close()
+		return err
+	}
+	return g.db.Close()
+}
@@ -0,0 +1,33 @@
+package gpkg
+
+import "fmt"
+
+// SpatialRefSys gpkg_spatial_ref_sys 表的一行
+type SpatialRefSys struct {
+	Name         string
+	ID           int
+	Organization string
+	OrgID        int
+	Definition   string
+	Description  string
+}
+
+// 规范要求必须存在的 -1、0、4326 三条记录,以及墨卡托瓦片用到的 3857
+var spatialRefSys = map[int]SpatialRefSys{
+	-1: {"Undefined cartesian SRS", -1, "NONE", -1, "undefined", "undefined cartesian coordinate reference system"},
+	0:  {"Undefined geographic SRS", 0, "NONE", 0, "undefined", "undefined geographic coordinate reference system"},
+	4326: {"WGS 84 geodetic", 4326, "EPSG", 4326,
+		`GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AXIS["Latitude",NORTH],AXIS["Longitude",EAST],AUTHORITY["EPSG","4326"]]`,
+		"longitude/latitude coordinates in decimal degrees on the WGS 84 spheroid"},
+	3857: {"WGS 84 / Pseudo-Mercator", 3857, "EPSG", 3857,
+		`PROJCS["WGS 84 / Pseudo-Mercator",GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]],PROJECTION["Mercator_1SP"],PARAMETER["central_meridian",0],PARAMETER["scale_factor",1],PARAMETER["false_easting",0],PARAMETER["false_northing",0],UNIT["metre",1,AUTHORITY["EPSG","9001"]],AXIS["Easting",EAST],AXIS["Northing",NORTH],EXTENSION["PROJ4","+proj=merc +a=6378137 +b=6378137 +lat_ts=0 +lon_0=0 +x_0=0 +y_0=0 +k=1 +units=m +nadgrids=@null +wktext +no_defs"],AUTHORITY["EPSG","3857"]]`,
+		"WGS 84 / Pseudo-Mercator, web map tiles"},
+}
+
+func lookupSpatialRefSys(srsID int) (SpatialRefSys, error) {
+	srs, ok := spatialRefSys[srsID]
+	if !ok {
+		return SpatialRefSys{}, fmt.Errorf("geopackage: unsupported srs_id %d, use 3857 or 4326", srsID)
+	}
+	return srs, nil
+}
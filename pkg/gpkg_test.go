@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/gpkg"
+)
+
+func TestGeoPackageTiles(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "out.gpkg")
+	set := gpkg.TileMatrixSet{
+		TableName:      "world",
+		SRSID:          4326,
+		MinX:           -180,
+		MinY:           -90,
+		MaxX:           180,
+		MaxY:           90,
+		ContentsBounds: [4]float64{100, 20, 120, 40},
+	}
+	var matrices []gpkg.TileMatrix
+	for z := 0; z <= 2; z++ {
+		res := 180.0 / 256 / float64(int(1)<<z)
+		matrices = append(matrices, gpkg.TileMatrix{
+			ZoomLevel: z, MatrixWidth: 2 << z, MatrixHeight: 1 << z,
+			TileWidth: 256, TileHeight: 256, PixelXSize: res, PixelYSize: res,
+		})
+	}
+
+	g, err := gpkg.Create(filename, set, matrices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.WriteTile(2, 6, 1, []byte("png-a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.WriteTile(0, 1, 0, []byte("png-b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpkg.Create(filename, gpkg.TileMatrixSet{TableName: "bad name", SRSID: 4326}, nil); err != gpkg.ErrTableName {
+		t.Errorf("invalid table name err = %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var applicationID, dataType string
+	if err := db.QueryRow("PRAGMA application_id").Scan(&applicationID); err != nil || applicationID != "1196444487" {
+		t.Errorf("application_id = %s, %v", applicationID, err)
+	}
+	if err := db.QueryRow("SELECT data_type FROM gpkg_contents WHERE table_name = 'world'").Scan(&dataType); err != nil || dataType != "tiles" {
+		t.Errorf("data_type = %s, %v", dataType, err)
+	}
+
+	reader, err := gpkg.Open(filename, "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := reader.ReadTile(2, 6, 1)
+	if err != nil || !bytes.Equal(data, []byte("png-a")) {
+		t.Errorf("ReadTile = %s, %v", data, err)
+	}
+	if _, err := reader.ReadTile(1, 0, 0); err != gpkg.ErrTileNotFound {
+		t.Errorf("missing tile err = %v", err)
+	}
+	got, err := reader.TileMatrices()
+	if err != nil || len(got) != 3 || got[2].MatrixWidth != 8 || got[2].PixelXSize != matrices[2].PixelXSize {
+		t.Errorf("TileMatrices = %+v, %v", got, err)
+	}
+}
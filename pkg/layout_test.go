@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestLayoutPathParse(t *testing.T) {
+	mercator := pkgGdal.NewMercator()
+	cases := []struct {
+		template string
+		scheme   string
+		z, x, y  int
+		path     string
+	}{
+		{"xyz", "tms", 3, 3, 2, "3/3/2.png"},
+		{"xyz", "xyz", 3, 3, 2, "3/3/5.png"},
+		{"zyx", "xyz", 3, 3, 2, "3/5/3.png"},
+		{"quadkey", "tms", 3, 3, 2, "213.png"},
+		{"arcgis", "tms", 3, 3, 2, "L03/R00000005/C00000003.png"},
+	}
+
+	for _, c := range cases {
+		layout, err := tile.NewLayout(c.template, c.scheme, mercator)
+		if err != nil {
+			t.Fatalf("NewLayout(%s): %v", c.template, err)
+		}
+		path := layout.Path(c.z, c.x, c.y, false)
+		if path != filepath.FromSlash(c.path) {
+			t.Errorf("%s Path(%d, %d, %d) = %s, want %s", c.template, c.z, c.x, c.y, path, c.path)
+		}
+
+		z, x, y, retina, err := layout.Parse(c.path)
+		if err != nil {
+			t.Fatalf("%s Parse(%s): %v", c.template, c.path, err)
+		}
+		if z != c.z || x != c.x || y != c.y || retina {
+			t.Errorf("%s Parse(%s) = %d, %d, %d, %v", c.template, c.path, z, x, y, retina)
+		}
+	}
+}
+
+func TestLayoutRetina(t *testing.T) {
+	layout, err := tile.NewLayout("{z}/{x}/{y}", "tms", pkgGdal.NewMercator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := layout.Path(1, 0, 1, true); path != filepath.FromSlash("1/0/1@2x.png") {
+		t.Errorf("retina Path = %s", path)
+	}
+	if _, _, _, retina, err := layout.Parse("1/0/1@2x.png"); err != nil || !retina {
+		t.Errorf("Parse retina = %v, %v", retina, err)
+	}
+	if _, _, _, _, err := layout.Parse("1/a/1.png"); err == nil {
+		t.Errorf("Parse invalid path should fail")
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	mercator := pkgGdal.NewMercator()
+	for _, template := range []string{"tiles", "{z}/{x}", "{z}/{x}/{y}/{y}", "{quadkey}/{z}", "{z}/{x}/{quadkey}"} {
+		if _, err := tile.NewLayout(template, "tms", mercator); !errors.Is(err, tile.ErrLayout) {
+			t.Errorf("NewLayout(%s) = %v, want ErrLayout", template, err)
+		}
+	}
+	if _, err := tile.NewLayout("quadkey", "tms", pkgGdal.NewGeodetic(256)); !errors.Is(err, tile.ErrLayout) {
+		t.Errorf("geodetic quadkey = %v, want ErrLayout", err)
+	}
+}
+
+func TestLayoutParseFormat(t *testing.T) {
+	layout, err := tile.NewLayout("arcgis", "tms", pkgGdal.NewMercator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"L03/R00000005/C00000003.kml", "L03/R00000005/C00000003.json", "L03/R00000005/C00000003.png.bak"} {
+		if _, _, _, _, err := layout.Parse(path); !errors.Is(err, tile.ErrLayoutPath) {
+			t.Errorf("Parse(%s) = %v, want ErrLayoutPath", path, err)
+		}
+	}
+}
+
+func TestLayoutTileJSON(t *testing.T) {
+	mercator := pkgGdal.NewMercator()
+	cases := []struct {
+		template string
+		scheme   string
+		want     string
+		tileJSON string
+	}{
+		{"xyz", "tms", "tms", "{z}/{x}/{y}.png"},
+		{"zyx", "xyz", "xyz", "{z}/{y}/{x}.png"},
+		{"{z:02}/{x}/{y}", "tms", "tms", ""},
+		{"quadkey", "tms", "xyz", ""},
+		{"arcgis", "tms", "xyz", ""},
+	}
+	for _, c := range cases {
+		layout, err := tile.NewLayout(c.template, c.scheme, mercator)
+		if err != nil {
+			t.Fatalf("NewLayout(%s): %v", c.template, err)
+		}
+		if scheme := layout.Scheme(); scheme != c.want {
+			t.Errorf("%s Scheme() = %s, want %s", c.template, scheme, c.want)
+		}
+		template, ok := layout.TileJSONTemplate()
+		if ok != (c.tileJSON != "") || template != c.tileJSON {
+			t.Errorf("%s TileJSONTemplate() = %q, %v, want %q", c.template, template, ok, c.tileJSON)
+		}
+	}
+}
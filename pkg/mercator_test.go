@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+func almostEqual(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestMercatorLonLatMeters(t *testing.T) {
+	m := pkgGdal.NewMercator()
+
+	mx, my := m.LonLatToMeters(180, 85.0511287798066)
+	if !almostEqual(mx, m.OriginShift, 1e-6) || !almostEqual(my, m.OriginShift, 1e-3) {
+		t.Errorf("LonLatToMeters(180, 85.05) = %f, %f, want %f", mx, my, m.OriginShift)
+	}
+
+	mx, my = m.LonLatToMeters(116.391, 39.907)
+	lon, lat := m.MetersToLonLat(mx, my)
+	if !almostEqual(lon, 116.391, 1e-9) || !almostEqual(lat, 39.907, 1e-9) {
+		t.Errorf("MetersToLonLat round trip = %f, %f", lon, lat)
+	}
+}
+
+func TestMercatorTileLatLonBounds(t *testing.T) {
+	m := pkgGdal.NewMercator()
+
+	west, south, east, north := m.TileLatLonBounds(0, 0, 0)
+	if !almostEqual(west, -180, 1e-9) || !almostEqual(east, 180, 1e-9) ||
+		!almostEqual(south, -85.0511287798066, 1e-9) || !almostEqual(north, 85.0511287798066, 1e-9) {
+		t.Errorf("TileLatLonBounds(0, 0, 0) = %f, %f, %f, %f", west, south, east, north)
+	}
+
+	// TMS 1/1/1 为东北象限
+	west, south, east, north = m.TileLatLonBounds(1, 1, 1)
+	if !almostEqual(west, 0, 1e-9) || !almostEqual(south, 0, 1e-9) || !almostEqual(east, 180, 1e-9) || north < 85 {
+		t.Errorf("TileLatLonBounds(1, 1, 1) = %f, %f, %f, %f", west, south, east, north)
+	}
+}
+
+func TestMercatorGoogleTile(t *testing.T) {
+	m := pkgGdal.NewMercator()
+
+	if x, y := m.GoogleTile(1, 0, 0); x != 0 || y != 1 {
+		t.Errorf("GoogleTile(1, 0, 0) = %d, %d, want 0, 1", x, y)
+	}
+	if x, y := m.TMSTile(3, 3, 5); x != 3 || y != 2 {
+		t.Errorf("TMSTile(3, 3, 5) = %d, %d, want 3, 2", x, y)
+	}
+}
+
+func TestMercatorQuadKey(t *testing.T) {
+	m := pkgGdal.NewMercator()
+
+	// Bing 示例 XYZ 3/3/5 的 quadkey 为 213,对应 TMS 3/3/2
+	if key := m.QuadKey(3, 3, 2); key != "213" {
+		t.Errorf("QuadKey(3, 3, 2) = %s, want 213", key)
+	}
+	if key := m.QuadKey(0, 0, 0); key != "" {
+		t.Errorf("QuadKey(0, 0, 0) = %q, want empty", key)
+	}
+
+	tz, tx, ty, err := m.QuadKeyToTile("213")
+	if err != nil {
+		t.Fatalf("QuadKeyToTile(213): %v", err)
+	}
+	if tz != 3 || tx != 3 || ty != 2 {
+		t.Errorf("QuadKeyToTile(213) = %d, %d, %d, want 3, 3, 2", tz, tx, ty)
+	}
+
+	if _, _, _, err := m.QuadKeyToTile("124"); !errors.Is(err, pkgGdal.ErrQuadKey) {
+		t.Errorf("QuadKeyToTile(124) err = %v, want ErrQuadKey", err)
+	}
+}
+
+func TestMercatorZoomForPixelSize(t *testing.T) {
+	m := pkgGdal.NewMercator()
+
+	if zoom := m.ZoomForPixelSize(150); zoom != 10 {
+		t.Errorf("ZoomForPixelSize(150) = %d, want 10", zoom)
+	}
+	if zoom := m.ZoomForPixelSize(1e6); zoom != 0 {
+		t.Errorf("ZoomForPixelSize(1e6) = %d, want 0", zoom)
+	}
+
+	// 512 瓦片 0 级分辨率为 256 瓦片的一半
+	m512 := pkgGdal.NewMercator(pkgGdal.WithTileSize(512))
+	if !almostEqual(m512.Resolution(0), m.Resolution(1), 1e-9) {
+		t.Errorf("512 Resolution(0) = %f, want %f", m512.Resolution(0), m.Resolution(1))
+	}
+}
@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/server"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestStyleScheme(t *testing.T) {
+	// 与最初的切片输出一致:tms 风格翻转 y 输出 xyz 行号
+	tests := map[string]string{"": "tms", "google": "tms", "tms": "xyz"}
+	for style, want := range tests {
+		if got := tile.StyleScheme(style); got != want {
+			t.Errorf("StyleScheme(%q) = %s, want %s", style, got, want)
+		}
+	}
+}
+
+func TestMetadataInfo(t *testing.T) {
+	mercator := pkgGdal.NewMercator()
+	geodetic := pkgGdal.NewGeodetic(256)
+	tests := []struct {
+		name    string
+		info    tile.MetadataInfo
+		bounds  [4]float64
+		srs     string
+		profile string
+	}{
+		{
+			name:    "mercator",
+			info:    tile.MetadataInfo{Name: "dom", Scheme: "xyz", Template: "{z}/{x}/{y}", MinZoom: 2, MaxZoom: 5, TileSize: 256, Profile: mercator, Bounds: [4]float64{0, 0, mercator.OriginShift, 2 * mercator.OriginShift}},
+			bounds:  [4]float64{0, 0, 180, 85.0511287798066},
+			srs:     "EPSG:3857",
+			profile: "mercator",
+		},
+		{
+			name:    "geodetic",
+			info:    tile.MetadataInfo{Name: "dem", Scheme: "tms", Template: "{z}/{x}/{y}", MinZoom: 0, MaxZoom: 3, TileSize: 512, Profile: geodetic, Bounds: [4]float64{-10, -20, 30, 40}},
+			bounds:  [4]float64{-10, -20, 30, 40},
+			srs:     "EPSG:4326",
+			profile: "global-geodetic",
+		},
+	}
+	for _, tt := range tests {
+		tileJSON := tt.info.TileJSON()
+		if tileJSON.TileJSON != "3.0.0" || tileJSON.Scheme != tt.info.Scheme || tileJSON.Tiles[0] != "{z}/{x}/{y}.png" ||
+			tileJSON.MinZoom != tt.info.MinZoom || tileJSON.MaxZoom != tt.info.MaxZoom || tileJSON.TileSize != tt.info.TileSize {
+			t.Errorf("%s: TileJSON %+v", tt.name, tileJSON)
+		}
+		for i := range tt.bounds {
+			if !almostEqual(tileJSON.Bounds[i], tt.bounds[i], 1e-9) {
+				t.Errorf("%s: bounds %v, want %v", tt.name, tileJSON.Bounds, tt.bounds)
+				break
+			}
+		}
+		if tileJSON.Center[2] != float64(tt.info.MinZoom) {
+			t.Errorf("%s: center %v", tt.name, tileJSON.Center)
+		}
+
+		metadata := tt.info.Metadata()
+		if metadata.Scheme != tt.info.Scheme || metadata.Format != "png" || metadata.MinZoom != strconv.Itoa(tt.info.MinZoom) ||
+			metadata.TileSize != strconv.Itoa(tt.info.TileSize) || metadata.Profile != tt.info.Profile.Name() {
+			t.Errorf("%s: metadata %+v", tt.name, metadata)
+		}
+
+		resource := tt.info.TileMapResource()
+		if resource.SRS != tt.srs || resource.TileSets.Profile != tt.profile || resource.TileFormat.Width != tt.info.TileSize {
+			t.Errorf("%s: tilemapresource %+v", tt.name, resource)
+		}
+		if n := len(resource.TileSets.TileSet); n != tt.info.MaxZoom-tt.info.MinZoom+1 {
+			t.Fatalf("%s: %d tilesets", tt.name, n)
+		}
+		first := resource.TileSets.TileSet[0]
+		if first.Href != strconv.Itoa(tt.info.MinZoom) || !almostEqual(first.UnitsPerPixel, tt.info.Profile.Resolution(tt.info.MinZoom), 1e-12) {
+			t.Errorf("%s: first tileset %+v", tt.name, first)
+		}
+		// xyz 行号不符合 TMS 规范,在 Abstract 中注明
+		if (resource.Abstract != "") != (tt.info.Scheme == "xyz") {
+			t.Errorf("%s: abstract %q", tt.name, resource.Abstract)
+		}
+		data, err := xml.Marshal(resource)
+		if err != nil || !strings.HasPrefix(string(data), `<TileMap version="1.0.0" tilemapservice="http://tms.osgeo.org/1.0.0">`) {
+			t.Errorf("%s: xml %s, %v", tt.name, data, err)
+		}
+	}
+}
+
+// quadkey、arcgis 等布局不写 tilejson.json,目录图层从 metadata.json 读取布局
+func TestDirTilesetMetadataFallback(t *testing.T) {
+	folder := t.TempDir()
+	metadata, _ := json.Marshal(tile.Metadata{
+		Name:    "arcgis",
+		Format:  "png",
+		Bounds:  "100,20,120,40",
+		Center:  "110,30,2",
+		MinZoom: "1",
+		MaxZoom: "2",
+		Scheme:  "xyz",
+		Layout:  "L{z:02}/R{y:hex8}/C{x:hex8}.png",
+	})
+	mercator := &tile.MetadataInfo{TileSize: 512, MinZoom: 1, MaxZoom: 2, Profile: pkgGdal.NewMercator(pkgGdal.WithTileSize(512))}
+	resource, _ := xml.Marshal(mercator.TileMapResource())
+	files := map[string][]byte{
+		tile.MetadataFilename:         metadata,
+		tile.TileMapResourceFilename:  resource,
+		"L02/R00000001/C00000003.png": []byte("arcgis-tile"),
+	}
+	for name, data := range files {
+		filename := filepath.Join(folder, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tileset, err := server.OpenDirTileset("", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := tileset.Info()
+	if info.Name != "arcgis" || info.TileSize != 512 || info.MinZoom != 1 || info.MaxZoom != 2 || info.Bounds != [4]float64{100, 20, 120, 40} {
+		t.Errorf("info %+v", info)
+	}
+	if data, err := tileset.Tile(2, 3, 1); err != nil || string(data) != "arcgis-tile" {
+		t.Errorf("Tile(2, 3, 1) = %q, %v", data, err)
+	}
+}
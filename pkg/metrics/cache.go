@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pdxrlj/tile_server/pkg/cache"
+)
+
+// cacheCollector 把 cache.Stats 导出为指标
+type cacheCollector struct {
+	cache    *cache.Cache
+	hits     *prometheus.Desc
+	diskHits *prometheus.Desc
+	misses   *prometheus.Desc
+	merged   *prometheus.Desc
+	entries  *prometheus.Desc
+	bytes    *prometheus.Desc
+}
+
+// NewCacheCollector 瓦片缓存的命中统计,需要调用方注册
+func NewCacheCollector(c *cache.Cache) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("tile_server", "cache", name), help, nil, nil)
+	}
+	return &cacheCollector{
+		cache:    c,
+		hits:     desc("hits_total", "Tile cache hits, including disk hits."),
+		diskHits: desc("disk_hits_total", "Tile cache hits served from disk."),
+		misses:   desc("misses_total", "Tile cache misses that loaded the tile from its backend."),
+		merged:   desc("merged_total", "Tile cache misses merged into a concurrent load."),
+		entries:  desc("entries", "Tiles held in the memory cache."),
+		bytes:    desc("memory_bytes", "Bytes held in the memory cache."),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{c.hits, c.diskHits, c.misses, c.merged, c.entries, c.bytes} {
+		ch <- desc
+	}
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.diskHits, prometheus.CounterValue, float64(stats.DiskHits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.merged, prometheus.CounterValue, float64(stats.Merged))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(stats.MemoryBytes))
+}
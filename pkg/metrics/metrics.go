@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 切片阶段,对应 Read()、TileToPNG() 和 RegenerateOverviews 缩放
+const (
+	StageRead                = "read"
+	StageTileToPNG           = "tile_to_png"
+	StageRegenerateOverviews = "regenerate_overviews"
+)
+
+var (
+	TilesGenerated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tile_server",
+		Name:      "tiles_generated_total",
+		Help:      "Tiles written by the tiling pipeline, by zoom level.",
+	}, []string{"zoom"})
+
+	TilesServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tile_server",
+		Name:      "tiles_served_total",
+		Help:      "Tiles served over HTTP, by layer and zoom level.",
+	}, []string{"layer", "zoom"})
+
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tile_server",
+		Name:      "stage_duration_seconds",
+		Help:      "Latency of the read, encode and overview stages of a tile.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"stage"})
+
+	GDALHandles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tile_server",
+		Name:      "gdal_handles_in_flight",
+		Help:      "GDAL datasets in use by tile reads and WMS warps; idle pooled handles are not counted.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(TilesGenerated, TilesServed, StageDuration, GDALHandles)
+}
+
+// ObserveStage 记录从 start 开始的阶段耗时
+func ObserveStage(stage string, start time.Time) {
+	StageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// TileGenerated 切片流程写出一张瓦片
+func TileGenerated(zoom int) {
+	TilesGenerated.WithLabelValues(strconv.Itoa(zoom)).Inc()
+}
+
+// TileServed 服务返回一张瓦片
+func TileServed(layer string, zoom int) {
+	TilesServed.WithLabelValues(layer, strconv.Itoa(zoom)).Inc()
+}
+
+// RegisterPprof 在 mux 上挂载 /debug/pprof/
+func RegisterPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// Handler /metrics,withPprof 时同时提供 /debug/pprof/
+func Handler(withPprof bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if withPprof {
+		RegisterPprof(mux)
+	}
+	return mux
+}
+
+// Serve 在后台启动指标监听,用于切片这类长时间运行的命令,返回的 server 用于关闭
+func Serve(addr string, withPprof bool) *http.Server {
+	server := &http.Server{Addr: addr, Handler: Handler(withPprof)}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("指标监听失败:%s", err)
+		}
+	}()
+	return server
+}
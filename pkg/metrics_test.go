@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/pdxrlj/tile_server/pkg/cache"
+	"github.com/pdxrlj/tile_server/pkg/metrics"
+	"github.com/pdxrlj/tile_server/pkg/server"
+)
+
+func TestServerMetrics(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+
+	served := metrics.TilesServed.WithLabelValues("dom", "2")
+	before := testutil.ToFloat64(served)
+	for i := 0; i < 2; i++ {
+		if status, _ := get(t, s, "/dom/2/3/1.png"); status != http.StatusOK {
+			t.Fatalf("tile status %d", status)
+		}
+	}
+	// 不存在的瓦片不计数
+	_, _ = get(t, s, "/dom/2/0/0.png")
+	if got := testutil.ToFloat64(served) - before; got != 2 {
+		t.Fatalf("tiles served %v", got)
+	}
+
+	if status, _ := get(t, s, "/metrics"); status != http.StatusNotFound {
+		t.Fatalf("metrics should be opt-in, status %d", status)
+	}
+	withMetrics := server.New(server.WithMetrics(true))
+	defer withMetrics.Close()
+	status, body := get(t, withMetrics, "/metrics")
+	if status != http.StatusOK || !strings.Contains(body, `tile_server_tiles_served_total{layer="dom",zoom="2"}`) ||
+		!strings.Contains(body, "tile_server_gdal_handles_in_flight") {
+		t.Fatalf("metrics status %d: %s", status, body)
+	}
+	if status, _ := get(t, s, "/debug/pprof/"); status != http.StatusNotFound {
+		t.Fatalf("pprof should be opt-in, status %d", status)
+	}
+
+	withPprof := server.New(server.WithPprof(true))
+	defer withPprof.Close()
+	if status, _ := get(t, withPprof, "/debug/pprof/"); status != http.StatusOK {
+		t.Fatalf("pprof status %d", status)
+	}
+}
+
+func TestCacheCollector(t *testing.T) {
+	c := cache.New()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewCacheCollector(c))
+
+	load := func() ([]byte, error) { return []byte("tile"), nil }
+	_, _ = c.Get("dom/1/0/0.png", load)
+	_, _ = c.Get("dom/1/0/0.png", load)
+	_, _ = c.Get("dom/1/1/0.png", load)
+
+	expected := `
+# HELP tile_server_cache_hits_total Tile cache hits, including disk hits.
+# TYPE tile_server_cache_hits_total counter
+tile_server_cache_hits_total 1
+# HELP tile_server_cache_misses_total Tile cache misses that loaded the tile from its backend.
+# TYPE tile_server_cache_misses_total counter
+tile_server_cache_misses_total 2
+# HELP tile_server_cache_entries Tiles held in the memory cache.
+# TYPE tile_server_cache_entries gauge
+tile_server_cache_entries 2
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"tile_server_cache_hits_total", "tile_server_cache_misses_total", "tile_server_cache_entries")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
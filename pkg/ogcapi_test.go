@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOGCAPICollections(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+
+	status, body := get(t, s, "/collections")
+	if status != http.StatusOK {
+		t.Fatalf("collections status %d: %s", status, body)
+	}
+	var collections struct {
+		Collections []struct {
+			ID     string `json:"id"`
+			Extent struct {
+				Spatial struct {
+					Bbox [][4]float64 `json:"bbox"`
+				} `json:"spatial"`
+			} `json:"extent"`
+		} `json:"collections"`
+	}
+	if err := json.Unmarshal([]byte(body), &collections); err != nil {
+		t.Fatal(err)
+	}
+	if len(collections.Collections) != 2 || collections.Collections[0].ID != "dem" || collections.Collections[1].ID != "dom" {
+		t.Fatalf("collections %+v", collections.Collections)
+	}
+	if bbox := collections.Collections[1].Extent.Spatial.Bbox; len(bbox) != 1 || bbox[0] != [4]float64{100, 20, 120, 40} {
+		t.Fatalf("dom bbox %v", bbox)
+	}
+
+	status, body = get(t, s, "/collections/dom/tiles")
+	if status != http.StatusOK || !strings.Contains(body, "/collections/dom/tiles/WebMercatorQuad") {
+		t.Fatalf("tilesets status %d: %s", status, body)
+	}
+
+	status, body = get(t, s, "/collections/dom/tiles/WebMercatorQuad")
+	if status != http.StatusOK {
+		t.Fatalf("tileset status %d: %s", status, body)
+	}
+	var tileset struct {
+		Limits []struct {
+			TileMatrix string `json:"tileMatrix"`
+			MinTileRow int    `json:"minTileRow"`
+			MaxTileRow int    `json:"maxTileRow"`
+			MinTileCol int    `json:"minTileCol"`
+			MaxTileCol int    `json:"maxTileCol"`
+		} `json:"tileMatrixSetLimits"`
+	}
+	if err := json.Unmarshal([]byte(body), &tileset); err != nil {
+		t.Fatal(err)
+	}
+	// 元数据的层级范围取自 tilejson.json 的 minzoom/maxzoom
+	if len(tileset.Limits) != 2 || tileset.Limits[0].TileMatrix != "1" || tileset.Limits[1].TileMatrix != "2" {
+		t.Fatalf("limits %+v", tileset.Limits)
+	}
+	if l := tileset.Limits[1]; l.MinTileCol != 3 || l.MaxTileCol != 3 || l.MinTileRow != 1 || l.MaxTileRow != 1 {
+		t.Fatalf("zoom 2 limits %+v", l)
+	}
+	if !strings.Contains(body, `"type": "image/png"`) {
+		t.Fatalf("tileset format missing: %s", body)
+	}
+}
+
+func TestOGCAPITiles(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+
+	for _, c := range []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"/collections/dom/tiles/WebMercatorQuad/2/1/3", http.StatusOK, "dir-tile"},
+		{"/collections/dem/tiles/WebMercatorQuad/1/0/1", http.StatusOK, "mbtiles-tile"},
+		{"/collections/dom/tiles/WebMercatorQuad/2/0/3", http.StatusNotFound, ""},
+		{"/collections/dom/tiles/WorldCRS84Quad/2/1/3", http.StatusNotFound, ""},
+		{"/collections/dom/tiles/WebMercatorQuad/2/a/3", http.StatusBadRequest, ""},
+		{"/collections/unknown/tiles", http.StatusNotFound, ""},
+	} {
+		status, body := get(t, s, c.url)
+		if status != c.status || (c.body != "" && body != c.body) {
+			t.Errorf("%s: status %d body %q", c.url, status, body)
+		}
+	}
+}
+
+func TestOGCAPITileMatrixSets(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+
+	status, body := get(t, s, "/tileMatrixSets")
+	if status != http.StatusOK || !strings.Contains(body, `"id": "WebMercatorQuad"`) {
+		t.Fatalf("tileMatrixSets status %d: %s", status, body)
+	}
+
+	status, body = get(t, s, "/tileMatrixSets/WebMercatorQuad")
+	if status != http.StatusOK {
+		t.Fatalf("tileMatrixSet status %d: %s", status, body)
+	}
+	var tms struct {
+		URI          string `json:"uri"`
+		TileMatrices []struct {
+			ID            string     `json:"id"`
+			PointOfOrigin [2]float64 `json:"pointOfOrigin"`
+			MatrixWidth   int        `json:"matrixWidth"`
+		} `json:"tileMatrices"`
+	}
+	if err := json.Unmarshal([]byte(body), &tms); err != nil {
+		t.Fatal(err)
+	}
+	if tms.URI != "http://www.opengis.net/def/tilematrixset/OGC/1.0/WebMercatorQuad" || len(tms.TileMatrices) != 25 {
+		t.Fatalf("tms %s with %d matrices", tms.URI, len(tms.TileMatrices))
+	}
+	if m := tms.TileMatrices[3]; m.ID != "3" || m.MatrixWidth != 8 || m.PointOfOrigin[1] < 20037508 {
+		t.Fatalf("matrix 3 %+v", m)
+	}
+
+	if status, _ := get(t, s, "/tileMatrixSets/WorldCRS84Quad"); status != http.StatusNotFound {
+		t.Fatalf("unused tms status %d", status)
+	}
+}
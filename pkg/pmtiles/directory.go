@@ -0,0 +1,166 @@
+package pmtiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+var ErrDirectory = errors.New("invalid pmtiles directory")
+
+// maxDirectorySize 单个目录压缩前后的最大字节数,防止损坏或恶意的文件导致超大内存分配
+const maxDirectorySize = 16 << 20
+
+// Entry 目录项,RunLength 为 0 时指向叶子目录
+type Entry struct {
+	TileID    uint64
+	Offset    uint64
+	Length    uint32
+	RunLength uint32
+}
+
+// SerializeDirectory 按规范分列写入 tile id 差值、run length、长度、偏移,再 gzip 压缩
+func SerializeDirectory(entries []Entry) ([]byte, error) {
+	raw := make([]byte, 0, len(entries)*8)
+	raw = binary.AppendUvarint(raw, uint64(len(entries)))
+
+	lastID := uint64(0)
+	for _, entry := range entries {
+		raw = binary.AppendUvarint(raw, entry.TileID-lastID)
+		lastID = entry.TileID
+	}
+	for _, entry := range entries {
+		raw = binary.AppendUvarint(raw, uint64(entry.RunLength))
+	}
+	for _, entry := range entries {
+		raw = binary.AppendUvarint(raw, uint64(entry.Length))
+	}
+	for i, entry := range entries {
+		// 紧接上一项的数据时偏移记为 0
+		if i > 0 && entry.Offset == entries[i-1].Offset+uint64(entries[i-1].Length) {
+			raw = binary.AppendUvarint(raw, 0)
+			continue
+		}
+		raw = binary.AppendUvarint(raw, entry.Offset+1)
+	}
+
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func DeserializeDirectory(data []byte) ([]Entry, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(io.LimitReader(gz, maxDirectorySize+1))
+	if err != nil || len(raw) > maxDirectorySize {
+		return nil, ErrDirectory
+	}
+	r := bytes.NewReader(raw)
+
+	count, err := binary.ReadUvarint(r)
+	// 每个目录项至少占 4 个字节(瓦片号、游程、长度、偏移各一个 varint)
+	if err != nil || count > uint64(r.Len())/4 {
+		return nil, ErrDirectory
+	}
+	entries := make([]Entry, count)
+	lastID := uint64(0)
+	for i := range entries {
+		delta, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrDirectory
+		}
+		lastID += delta
+		entries[i].TileID = lastID
+	}
+	for i := range entries {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrDirectory
+		}
+		entries[i].RunLength = uint32(v)
+	}
+	for i := range entries {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrDirectory
+		}
+		entries[i].Length = uint32(v)
+	}
+	for i := range entries {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrDirectory
+		}
+		if v == 0 && i > 0 {
+			entries[i].Offset = entries[i-1].Offset + uint64(entries[i-1].Length)
+		} else {
+			entries[i].Offset = v - 1
+		}
+	}
+	return entries, nil
+}
+
+// FindTile 在有序目录中查找 tile id 所在的目录项
+func FindTile(entries []Entry, tileID uint64) (Entry, bool) {
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].TileID > tileID
+	}) - 1
+	if i < 0 {
+		return Entry{}, false
+	}
+	entry := entries[i]
+	if entry.RunLength == 0 || tileID < entry.TileID+uint64(entry.RunLength) {
+		return entry, true
+	}
+	return Entry{}, false
+}
+
+// BuildRootLeaves 根目录放不下 16 KiB 时,把目录项拆分到叶子目录,根目录只保存叶子目录的指针
+func BuildRootLeaves(entries []Entry) ([]byte, []byte, error) {
+	root, err := SerializeDirectory(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(root) <= RootSize-HeaderSize {
+		return root, nil, nil
+	}
+
+	leafSize := 4096
+	for {
+		var rootEntries []Entry
+		leaves := bytes.Buffer{}
+		for start := 0; start < len(entries); start += leafSize {
+			end := min(start+leafSize, len(entries))
+			leaf, err := SerializeDirectory(entries[start:end])
+			if err != nil {
+				return nil, nil, err
+			}
+			rootEntries = append(rootEntries, Entry{
+				TileID: entries[start].TileID,
+				Offset: uint64(leaves.Len()),
+				Length: uint32(len(leaf)),
+			})
+			leaves.Write(leaf)
+		}
+		root, err = SerializeDirectory(rootEntries)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(root) <= RootSize-HeaderSize {
+			return root, leaves.Bytes(), nil
+		}
+		leafSize += leafSize / 5
+	}
+}
@@ -0,0 +1,130 @@
+package pmtiles
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// PMTiles v3 https://github.com/protomaps/PMTiles/blob/main/spec/v3/spec.md
+const (
+	HeaderSize = 127
+	// RootSize 文件头加根目录不超过 16 KiB,客户端一次请求即可读到
+	RootSize = 16384
+)
+
+// Compression
+const (
+	CompressionUnknown uint8 = 0
+	CompressionNone    uint8 = 1
+	CompressionGzip    uint8 = 2
+)
+
+// TileType
+const (
+	TileTypeUnknown uint8 = 0
+	TileTypeMvt     uint8 = 1
+	TileTypePng     uint8 = 2
+	TileTypeJpeg    uint8 = 3
+	TileTypeWebp    uint8 = 4
+)
+
+var ErrHeader = errors.New("not a pmtiles v3 archive")
+
+type Header struct {
+	RootOffset          uint64
+	RootLength          uint64
+	MetadataOffset      uint64
+	MetadataLength      uint64
+	LeafDirectoryOffset uint64
+	LeafDirectoryLength uint64
+	TileDataOffset      uint64
+	TileDataLength      uint64
+	AddressedTiles      uint64
+	TileEntries         uint64
+	TileContents        uint64
+	Clustered           bool
+	InternalCompression uint8
+	TileCompression     uint8
+	TileType            uint8
+	MinZoom             uint8
+	MaxZoom             uint8
+	MinLon, MinLat      float64
+	MaxLon, MaxLat      float64
+	CenterZoom          uint8
+	CenterLon           float64
+	CenterLat           float64
+}
+
+func (h *Header) Marshal() []byte {
+	b := make([]byte, HeaderSize)
+	copy(b[0:7], "PMTiles")
+	b[7] = 3
+	for i, v := range []uint64{
+		h.RootOffset, h.RootLength, h.MetadataOffset, h.MetadataLength,
+		h.LeafDirectoryOffset, h.LeafDirectoryLength, h.TileDataOffset, h.TileDataLength,
+		h.AddressedTiles, h.TileEntries, h.TileContents,
+	} {
+		binary.LittleEndian.PutUint64(b[8+8*i:], v)
+	}
+	if h.Clustered {
+		b[96] = 1
+	}
+	b[97] = h.InternalCompression
+	b[98] = h.TileCompression
+	b[99] = h.TileType
+	b[100] = h.MinZoom
+	b[101] = h.MaxZoom
+	binary.LittleEndian.PutUint32(b[102:], uint32(e7(h.MinLon)))
+	binary.LittleEndian.PutUint32(b[106:], uint32(e7(h.MinLat)))
+	binary.LittleEndian.PutUint32(b[110:], uint32(e7(h.MaxLon)))
+	binary.LittleEndian.PutUint32(b[114:], uint32(e7(h.MaxLat)))
+	b[118] = h.CenterZoom
+	binary.LittleEndian.PutUint32(b[119:], uint32(e7(h.CenterLon)))
+	binary.LittleEndian.PutUint32(b[123:], uint32(e7(h.CenterLat)))
+	return b
+}
+
+func UnmarshalHeader(b []byte) (*Header, error) {
+	if len(b) < HeaderSize || string(b[0:7]) != "PMTiles" || b[7] != 3 {
+		return nil, ErrHeader
+	}
+	u64 := func(i int) uint64 {
+		return binary.LittleEndian.Uint64(b[8+8*i:])
+	}
+	i32 := func(offset int) float64 {
+		return float64(int32(binary.LittleEndian.Uint32(b[offset:]))) / 1e7
+	}
+	return &Header{
+		RootOffset:          u64(0),
+		RootLength:          u64(1),
+		MetadataOffset:      u64(2),
+		MetadataLength:      u64(3),
+		LeafDirectoryOffset: u64(4),
+		LeafDirectoryLength: u64(5),
+		TileDataOffset:      u64(6),
+		TileDataLength:      u64(7),
+		AddressedTiles:      u64(8),
+		TileEntries:         u64(9),
+		TileContents:        u64(10),
+		Clustered:           b[96] == 1,
+		InternalCompression: b[97],
+		TileCompression:     b[98],
+		TileType:            b[99],
+		MinZoom:             b[100],
+		MaxZoom:             b[101],
+		MinLon:              i32(102),
+		MinLat:              i32(106),
+		MaxLon:              i32(110),
+		MaxLat:              i32(114),
+		CenterZoom:          b[118],
+		CenterLon:           i32(119),
+		CenterLat:           i32(123),
+	}, nil
+}
+
+func e7(v float64) int32 {
+	if v < 0 {
+		return int32(v*1e7 - 0.5)
+	}
+	return int32(v*1e7 + 0.5)
+}
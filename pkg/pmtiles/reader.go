@@ -0,0 +1,176 @@
+package pmtiles
+
+import (
+	"bytes"
+	"container/list"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrTileNotFound = errors.New("pmtiles tile not found")
+
+const (
+	// maxDepth 根目录加叶子目录的最大层数
+	maxDepth = 4
+	// maxLeaves 缓存的叶子目录数,超出时淘汰最久未访问的
+	maxLeaves = 256
+)
+
+// Reader 从 .pmtiles 文件读取瓦片,根目录常驻内存,叶子目录按需读取并缓存
+type Reader struct {
+	r      io.ReaderAt
+	closer io.Closer
+	header *Header
+	root   []Entry
+	mu     sync.Mutex
+	leaves map[uint64]*list.Element
+	order  *list.List
+}
+
+type leafEntry struct {
+	offset  uint64
+	entries []Entry
+}
+
+func Open(filename string) (*Reader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	reader.closer = f
+	return reader, nil
+}
+
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	b := make([]byte, HeaderSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, err
+	}
+	header, err := UnmarshalHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	reader := &Reader{r: r, header: header, leaves: make(map[uint64]*list.Element), order: list.New()}
+	reader.root, err = reader.directory(header.RootOffset, header.RootLength)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (reader *Reader) Header() *Header {
+	return reader.header
+}
+
+// Metadata 解压后的 JSON 元数据
+func (reader *Reader) Metadata() ([]byte, error) {
+	data, err := reader.read(reader.header.MetadataOffset, reader.header.MetadataLength)
+	if err != nil {
+		return nil, err
+	}
+	if reader.header.InternalCompression != CompressionGzip {
+		return data, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(gz)
+}
+
+// UnmarshalMetadata 元数据解析到 v
+func (reader *Reader) UnmarshalMetadata(v any) error {
+	data, err := reader.Metadata()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// GetTile 按 XYZ 瓦片号读取瓦片,不存在时返回 ErrTileNotFound
+func (reader *Reader) GetTile(z uint8, x, y uint32) ([]byte, error) {
+	if z < reader.header.MinZoom || z > reader.header.MaxZoom || x >= 1<<z || y >= 1<<z {
+		return nil, ErrTileNotFound
+	}
+	tileID := ZxyToID(z, x, y)
+
+	entries := reader.root
+	for depth := 0; depth < maxDepth; depth++ {
+		entry, ok := FindTile(entries, tileID)
+		if !ok {
+			return nil, ErrTileNotFound
+		}
+		if entry.RunLength > 0 {
+			return reader.read(reader.header.TileDataOffset+entry.Offset, uint64(entry.Length))
+		}
+		leaf, err := reader.leaf(entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = leaf
+	}
+	return nil, ErrTileNotFound
+}
+
+func (reader *Reader) leaf(entry Entry) ([]Entry, error) {
+	offset := reader.header.LeafDirectoryOffset + entry.Offset
+	reader.mu.Lock()
+	if element, ok := reader.leaves[offset]; ok {
+		reader.order.MoveToFront(element)
+		leaf := element.Value.(*leafEntry).entries
+		reader.mu.Unlock()
+		return leaf, nil
+	}
+	reader.mu.Unlock()
+
+	leaf, err := reader.directory(offset, uint64(entry.Length))
+	if err != nil {
+		return nil, err
+	}
+	reader.mu.Lock()
+	if _, ok := reader.leaves[offset]; !ok {
+		reader.leaves[offset] = reader.order.PushFront(&leafEntry{offset: offset, entries: leaf})
+		for reader.order.Len() > maxLeaves {
+			oldest := reader.order.Back()
+			reader.order.Remove(oldest)
+			delete(reader.leaves, oldest.Value.(*leafEntry).offset)
+		}
+	}
+	reader.mu.Unlock()
+	return leaf, nil
+}
+
+func (reader *Reader) directory(offset, length uint64) ([]Entry, error) {
+	if length > maxDirectorySize {
+		return nil, ErrDirectory
+	}
+	data, err := reader.read(offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return DeserializeDirectory(data)
+}
+
+func (reader *Reader) read(offset, length uint64) ([]byte, error) {
+	b := make([]byte, length)
+	if _, err := reader.r.ReadAt(b, int64(offset)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (reader *Reader) Close() error {
+	if reader.closer != nil {
+		return reader.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package pmtiles
+
+// ZxyToID 瓦片号转换为 PMTiles 的 tile id: 前面所有层级的瓦片数加上当前层级的 Hilbert 曲线序号
+// x, y 为 XYZ 瓦片号,y 从北往南
+func ZxyToID(z uint8, x, y uint32) uint64 {
+	acc := (uint64(1)<<(2*uint64(z)) - 1) / 3
+	n := uint64(1) << z
+	tx, ty := uint64(x), uint64(y)
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := uint64(0), uint64(0)
+		if tx&s > 0 {
+			rx = 1
+		}
+		if ty&s > 0 {
+			ry = 1
+		}
+		acc += s * s * ((3 * rx) ^ ry)
+		tx, ty = rotate(n, tx, ty, rx, ry)
+	}
+	return acc
+}
+
+// IDToZxy tile id 转换为瓦片号
+func IDToZxy(id uint64) (uint8, uint32, uint32) {
+	var z uint8
+	acc := uint64(0)
+	for {
+		count := uint64(1) << (2 * uint64(z))
+		if id < acc+count {
+			break
+		}
+		acc += count
+		z++
+	}
+
+	n := uint64(1) << z
+	t := id - acc
+	tx, ty := uint64(0), uint64(0)
+	for s := uint64(1); s < n; s *= 2 {
+		rx := 1 & (t / 2)
+		ry := 1 & (t ^ rx)
+		tx, ty = rotate(s, tx, ty, rx, ry)
+		tx += s * rx
+		ty += s * ry
+		t /= 4
+	}
+	return z, uint32(tx), uint32(ty)
+}
+
+func rotate(n, x, y, rx, ry uint64) (uint64, uint64) {
+	if ry == 0 {
+		if rx == 1 {
+			x = n - 1 - x
+			y = n - 1 - y
+		}
+		return y, x
+	}
+	return x, y
+}
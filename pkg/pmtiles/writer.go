@@ -0,0 +1,161 @@
+package pmtiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var ErrTileOrder = errors.New("pmtiles tiles must be added in ascending tile id order")
+
+// Writer 按 tile id 升序写入瓦片,相同内容的瓦片只保存一份,连续相同的瓦片合并为一个目录项
+type Writer struct {
+	filename string
+	header   Header
+	tmp      *os.File
+	offset   uint64
+	entries  []Entry
+	hashes   map[[sha256.Size]byte]Entry
+	lastID   uint64
+	lastHash [sha256.Size]byte
+	count    uint64
+}
+
+// NewWriter header 中填写瓦片类型、层级、范围与中心点,偏移量等由 Close 计算
+func NewWriter(filename string, header Header) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "*.pmtiles.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		filename: filename,
+		header:   header,
+		tmp:      tmp,
+		hashes:   make(map[[sha256.Size]byte]Entry),
+	}, nil
+}
+
+// AddTile 写入 XYZ 瓦片,须按 ZxyToID 升序调用
+func (w *Writer) AddTile(z uint8, x, y uint32, data []byte) error {
+	return w.Add(ZxyToID(z, x, y), data)
+}
+
+func (w *Writer) Add(tileID uint64, data []byte) error {
+	if w.count > 0 && tileID <= w.lastID {
+		return ErrTileOrder
+	}
+	hash := sha256.Sum256(data)
+
+	// 与上一个瓦片 id 连续且内容相同,合并到上一个目录项
+	if n := len(w.entries); n > 0 && hash == w.lastHash {
+		last := &w.entries[n-1]
+		if tileID == last.TileID+uint64(last.RunLength) {
+			last.RunLength++
+			w.lastID = tileID
+			w.count++
+			return nil
+		}
+	}
+
+	entry, ok := w.hashes[hash]
+	if !ok {
+		if _, err := w.tmp.Write(data); err != nil {
+			return err
+		}
+		entry = Entry{Offset: w.offset, Length: uint32(len(data))}
+		w.offset += uint64(len(data))
+		w.hashes[hash] = entry
+	}
+	entry.TileID = tileID
+	entry.RunLength = 1
+	w.entries = append(w.entries, entry)
+	w.lastID = tileID
+	w.lastHash = hash
+	w.count++
+	return nil
+}
+
+// Close 生成目录与元数据,按 header、根目录、元数据、叶子目录、瓦片数据的顺序写出文件
+func (w *Writer) Close(metadata any) error {
+	defer func() {
+		_ = w.tmp.Close()
+		_ = os.Remove(w.tmp.Name())
+	}()
+
+	sort.Slice(w.entries, func(i, j int) bool {
+		return w.entries[i].TileID < w.entries[j].TileID
+	})
+	root, leaves, err := BuildRootLeaves(w.entries)
+	if err != nil {
+		return err
+	}
+	meta, err := compressMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	h := w.header
+	h.RootOffset = HeaderSize
+	h.RootLength = uint64(len(root))
+	h.MetadataOffset = h.RootOffset + h.RootLength
+	h.MetadataLength = uint64(len(meta))
+	h.LeafDirectoryOffset = h.MetadataOffset + h.MetadataLength
+	h.LeafDirectoryLength = uint64(len(leaves))
+	h.TileDataOffset = h.LeafDirectoryOffset + h.LeafDirectoryLength
+	h.TileDataLength = w.offset
+	h.AddressedTiles = w.count
+	h.TileEntries = uint64(len(w.entries))
+	h.TileContents = uint64(len(w.hashes))
+	// 瓦片按 id 升序写入,数据区即为聚簇顺序
+	h.Clustered = true
+	h.InternalCompression = CompressionGzip
+	if h.TileCompression == CompressionUnknown {
+		h.TileCompression = CompressionNone
+	}
+
+	out, err := os.Create(w.filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, b := range [][]byte{h.Marshal(), root, meta, leaves} {
+		if _, err := out.Write(b); err != nil {
+			return err
+		}
+	}
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, w.tmp); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func compressMetadata(metadata any) ([]byte, error) {
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/pmtiles"
+	"github.com/pdxrlj/tile_server/pkg/server"
+)
+
+func TestPMTilesTileID(t *testing.T) {
+	for _, c := range []struct {
+		z    uint8
+		x, y uint32
+		id   uint64
+	}{
+		{0, 0, 0, 0},
+		{1, 0, 0, 1},
+		{1, 0, 1, 2},
+		{1, 1, 1, 3},
+		{1, 1, 0, 4},
+		{2, 0, 0, 5},
+		{12, 3423, 1763, 19078479},
+	} {
+		if id := pmtiles.ZxyToID(c.z, c.x, c.y); id != c.id {
+			t.Errorf("ZxyToID(%d, %d, %d) = %d, want %d", c.z, c.x, c.y, id, c.id)
+		}
+		z, x, y := pmtiles.IDToZxy(c.id)
+		if z != c.z || x != c.x || y != c.y {
+			t.Errorf("IDToZxy(%d) = %d, %d, %d", c.id, z, x, y)
+		}
+	}
+}
+
+func TestPMTilesWriterReader(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "out.pmtiles")
+	writer, err := pmtiles.NewWriter(filename, pmtiles.Header{
+		TileType: pmtiles.TileTypePng,
+		MinZoom:  0,
+		MaxZoom:  9,
+		MinLon:   -180, MinLat: -85, MaxLon: 180, MaxLat: 85,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 足够多的瓦片迫使目录拆分为叶子目录,连续的空白瓦片合并为一个目录项
+	tiles := map[uint64][]byte{}
+	for id := uint64(0); id < pmtiles.ZxyToID(9, 0, 0); id++ {
+		data := []byte("blank")
+		if id%5 > 2 {
+			data = bytes.Repeat([]byte{byte(id), byte(id >> 8)}, int(id*7919%97)+1)
+		}
+		tiles[id] = data
+		if err := writer.Add(id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Add(0, []byte("x")); err == nil {
+		t.Errorf("Add out of order should fail")
+	}
+	if err := writer.Close(map[string]string{"name": "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := pmtiles.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	header := reader.Header()
+	if header.AddressedTiles != uint64(len(tiles)) || header.TileEntries >= header.AddressedTiles {
+		t.Errorf("addressed %d entries %d", header.AddressedTiles, header.TileEntries)
+	}
+	if header.LeafDirectoryLength == 0 {
+		t.Errorf("expected leaf directories")
+	}
+	if header.MinLat != -85 || header.MaxLon != 180 {
+		t.Errorf("bounds = %v %v", header.MinLat, header.MaxLon)
+	}
+
+	for _, id := range []uint64{0, 1, 7, 100, 5461, 21844, 87380} {
+		z, x, y := pmtiles.IDToZxy(id)
+		data, err := reader.GetTile(z, x, y)
+		if err != nil {
+			t.Fatalf("GetTile(%d, %d, %d): %v", z, x, y, err)
+		}
+		if !bytes.Equal(data, tiles[id]) {
+			t.Errorf("tile %d = %v, want %v", id, data, tiles[id])
+		}
+	}
+	if _, err := reader.GetTile(9, 0, 0); err != pmtiles.ErrTileNotFound {
+		t.Errorf("missing tile err = %v", err)
+	}
+
+	meta := map[string]string{}
+	if err := reader.UnmarshalMetadata(&meta); err != nil || meta["name"] != "test" {
+		t.Errorf("metadata = %v, %v", meta, err)
+	}
+}
+
+// 瓦片大小从元数据读取,缺失时为 256
+func TestPMTilesTileSize(t *testing.T) {
+	open := func(metadata map[string]string) server.TilesetInfo {
+		filename := filepath.Join(t.TempDir(), "out.pmtiles")
+		writer, err := pmtiles.NewWriter(filename, pmtiles.Header{TileType: pmtiles.TileTypePng, MinZoom: 0, MaxZoom: 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.AddTile(0, 0, 0, []byte("tile")); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(metadata); err != nil {
+			t.Fatal(err)
+		}
+		ts, err := server.OpenPMTiles("", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ts.Close()
+		return ts.Info()
+	}
+	if info := open(map[string]string{"name": "dom", "tile_size": "512", "profile": "mercator"}); info.TileSize != 512 || info.Profile != pkgGdal.ProfileMercator {
+		t.Errorf("info %+v", info)
+	}
+	if info := open(map[string]string{"name": "dom"}); info.TileSize != 256 || info.Profile != pkgGdal.ProfileMercator {
+		t.Errorf("info without tile_size %+v", info)
+	}
+}
+
+// 目录项数超过数据长度时不按该数量分配内存
+func TestPMTilesDirectoryCount(t *testing.T) {
+	raw := binary.AppendUvarint(nil, 1<<40)
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(raw)
+	_ = gz.Close()
+	if _, err := pmtiles.DeserializeDirectory(buf.Bytes()); err != pmtiles.ErrDirectory {
+		t.Errorf("DeserializeDirectory err = %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestParseRenderOptions(t *testing.T) {
+	values, _ := url.ParseQuery("bidx=3&bidx=2,1&rescale=0,3000&colormap_name=Viridis&nodata=-9999&resampling=bilinear&return_mask=false")
+	options, err := tile.ParseRenderOptions(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Bidx) != 3 || options.Bidx[0] != 3 || options.Bidx[2] != 1 {
+		t.Errorf("Bidx = %v", options.Bidx)
+	}
+	if len(options.Rescale) != 1 || options.Rescale[0] != [2]float64{0, 3000} {
+		t.Errorf("Rescale = %v", options.Rescale)
+	}
+	if options.ColormapName != "viridis" || options.Resampling != "bilinear" || options.ReturnMask {
+		t.Errorf("options = %+v", options)
+	}
+	if options.Nodata == nil || *options.Nodata != -9999 {
+		t.Errorf("Nodata = %v", options.Nodata)
+	}
+
+	defaults, err := tile.ParseRenderOptions(url.Values{})
+	if err != nil || !defaults.ReturnMask || defaults.Nodata != nil {
+		t.Errorf("defaults = %+v, %v", defaults, err)
+	}
+
+	for query, want := range map[string]error{
+		"bidx=0":             pkgGdal.ErrBandIndex,
+		"bidx=a":             pkgGdal.ErrBandIndex,
+		"rescale=10":         pkgGdal.ErrRescale,
+		"rescale=5,1":        pkgGdal.ErrRescale,
+		"colormap_name=nope": pkgGdal.ErrColormap,
+		"nodata=x":           pkgGdal.ErrNodata,
+		"resampling=foo":     pkgGdal.ErrResampling,
+		"return_mask=maybe":  pkgGdal.ErrReturnMask,
+	} {
+		values, _ := url.ParseQuery(query)
+		if _, err := tile.ParseRenderOptions(values); !errors.Is(err, want) {
+			t.Errorf("ParseRenderOptions(%s) = %v, want %v", query, err, want)
+		}
+	}
+}
+
+func TestColormap(t *testing.T) {
+	lut, err := tile.Colormap("greys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lut[0] != [3]byte{0, 0, 0} || lut[128] != [3]byte{128, 128, 128} || lut[255] != [3]byte{255, 255, 255} {
+		t.Errorf("greys = %v %v %v", lut[0], lut[128], lut[255])
+	}
+	for _, name := range tile.ColormapNames() {
+		lut, err := tile.Colormap(name)
+		if err != nil {
+			t.Fatalf("Colormap(%s): %v", name, err)
+		}
+		if lut[0] == lut[255] {
+			t.Errorf("Colormap(%s) is flat", name)
+		}
+	}
+}
+
+func TestRenderOptionsKey(t *testing.T) {
+	parse := func(query string) string {
+		values, _ := url.ParseQuery(query)
+		options, err := tile.ParseRenderOptions(values)
+		if err != nil {
+			t.Fatalf("ParseRenderOptions(%s): %v", query, err)
+		}
+		return options.Key()
+	}
+	// 参数顺序、大小写和数字写法不同时 key 相同
+	if a, b := parse("rescale=0,3000&bidx=1&colormap_name=Viridis"), parse("colormap_name=viridis&bidx=1&rescale=0.0,3e3"); a != b {
+		t.Errorf("keys differ: %s, %s", a, b)
+	}
+	// return_mask 默认为 true
+	if a, b := parse(""), parse("return_mask=true"); a != b {
+		t.Errorf("default keys differ: %s, %s", a, b)
+	}
+	for _, pair := range [][2]string{
+		{"bidx=1,2", "bidx=2,1"},
+		{"nodata=0", ""},
+		{"return_mask=false", ""},
+		{"resampling=bilinear", "resampling=cubic"},
+	} {
+		if parse(pair[0]) == parse(pair[1]) {
+			t.Errorf("%q and %q have the same key", pair[0], pair[1])
+		}
+	}
+}
+
+func TestHasRenderOptions(t *testing.T) {
+	for query, want := range map[string]bool{
+		"":                      false,
+		"api_key=abc&v=2":       false,
+		"v=2&bidx=1":            true,
+		"return_mask=false":     true,
+		"colormap_name=viridis": true,
+	} {
+		values, _ := url.ParseQuery(query)
+		if got := tile.HasRenderOptions(values); got != want {
+			t.Errorf("HasRenderOptions(%q) = %v", query, got)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKey 合作方的访问密钥;Rate 为每秒请求数,0 时不限流;Layers 为空时可以访问所有图层和 /cog
+type APIKey struct {
+	Key    string
+	Name   string
+	Rate   float64
+	Burst  int
+	Layers []string
+}
+
+const apiKeyHeader = "X-API-Key"
+
+type apiKeyContext struct{}
+
+// accessKey 通过校验的密钥及其令牌桶
+type accessKey struct {
+	APIKey
+	layers map[string]bool
+	bucket *tokenBucket
+}
+
+func newAccessKeys(keys []APIKey) map[string]*accessKey {
+	accessKeys := make(map[string]*accessKey, len(keys))
+	for _, key := range keys {
+		if key.Key == "" {
+			continue
+		}
+		access := &accessKey{APIKey: key}
+		if len(key.Layers) > 0 {
+			access.layers = make(map[string]bool, len(key.Layers))
+			for _, layer := range key.Layers {
+				access.layers[layer] = true
+			}
+		}
+		if key.Rate > 0 {
+			access.bucket = newTokenBucket(key.Rate, key.Burst)
+		}
+		accessKeys[key.Key] = access
+	}
+	return accessKeys
+}
+
+// allowLayer 密钥是否可以访问图层
+func (k *accessKey) allowLayer(layer string) bool {
+	return k.layers == nil || k.layers[layer]
+}
+
+// Middleware HTTP 中间件,按添加顺序由外到内执行
+type Middleware func(next http.Handler) http.Handler
+
+func chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// reject 拒绝请求并记录结构化日志
+func (s *Server) reject(w http.ResponseWriter, r *http.Request, status int, reason string, attrs ...any) {
+	attrs = append([]any{
+		"status", status,
+		"reason", reason,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote", r.RemoteAddr,
+	}, attrs...)
+	s.logger.LogAttrs(r.Context(), slog.LevelWarn, "request rejected", slog.Group("request", attrs...))
+	http.Error(w, http.StatusText(status), status)
+}
+
+// cors 允许配置的来源跨域访问,预检请求不需要密钥
+func (s *Server) cors() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || len(s.corsOrigins) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			allowed := s.corsOrigins["*"] || s.corsOrigins[origin]
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !allowed {
+				if preflight {
+					s.reject(w, r, http.StatusForbidden, "cors_origin", "origin", origin)
+					return
+				}
+				// 非预检请求不带 CORS 头,由浏览器拦截
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Retry-After")
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", apiKeyHeader+", If-None-Match, If-Modified-Since")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKeys 校验 X-API-Key 或 api_key 参数、按密钥限流,并检查请求的图层是否在密钥的图层列表中
+func (s *Server) apiKeys() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(s.accessKeys) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			value := r.Header.Get(apiKeyHeader)
+			if value == "" {
+				// 地图客户端的瓦片模板无法设置请求头
+				value = r.URL.Query().Get("api_key")
+			}
+			if value == "" {
+				s.reject(w, r, http.StatusUnauthorized, "missing_key")
+				return
+			}
+			key, ok := s.accessKeys[value]
+			if !ok {
+				s.reject(w, r, http.StatusUnauthorized, "invalid_key")
+				return
+			}
+
+			if key.bucket != nil {
+				if ok, wait := key.bucket.allow(time.Now()); !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					s.reject(w, r, http.StatusTooManyRequests, "rate_limited", "key", key.Name)
+					return
+				}
+			}
+
+			if key.layers != nil && unrestrictedOnly(r.URL.Path) {
+				s.reject(w, r, http.StatusForbidden, "route_not_allowed", "key", key.Name)
+				return
+			}
+			for _, layer := range requestLayers(r) {
+				if !key.allowLayer(layer) {
+					s.reject(w, r, http.StatusForbidden, "layer_not_allowed", "key", key.Name, "layer", layer)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, key)))
+		})
+	}
+}
+
+// unrestrictedOnly 只有未限制图层的密钥可以访问的路由:读取任意文件的 /cog 和服务内部状态
+func unrestrictedOnly(path string) bool {
+	for _, prefix := range []string{"/cog/", "/metrics", "/debug/", "/cache/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestLayers 请求访问的图层,与各接口的路由一致
+func requestLayers(r *http.Request) []string {
+	path := r.URL.Path
+	switch {
+	case path == "/wmts":
+		if layer := kvpParams(r)["layer"]; layer != "" {
+			return []string{layer}
+		}
+		return nil
+	case path == "/wms":
+		if layers := kvpParams(r)["layers"]; layers != "" {
+			return strings.Split(layers, ",")
+		}
+		return nil
+	case path == wmtsCapsPath:
+		return nil
+	case strings.HasPrefix(path, wmtsRESTPrefix):
+		return firstSegment(strings.TrimPrefix(path, wmtsRESTPrefix))
+	case strings.HasPrefix(path, "/collections/"):
+		return firstSegment(strings.TrimPrefix(path, "/collections/"))
+	case strings.HasPrefix(path, "/layers/"):
+		return firstSegment(strings.TrimPrefix(path, "/layers/"))
+	}
+
+	// /{layer}/{z}/{x}/{y},其余路由不属于某个图层
+	for _, prefix := range []string{"/cog/", "/wmts/", "/tileMatrixSets", "/cache/", "/debug/", "/metrics", "/conformance", "/layers", "/collections"} {
+		if strings.HasPrefix(path, prefix) {
+			return nil
+		}
+	}
+	if layer, rest, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/"); ok && rest != "" {
+		return []string{layer}
+	}
+	return nil
+}
+
+func firstSegment(path string) []string {
+	segment, _, _ := strings.Cut(path, "/")
+	if segment == "" {
+		return nil
+	}
+	return []string{segment}
+}
+
+// visibleTilesetNames 请求密钥可以访问的图层,按名称排序
+func (s *Server) visibleTilesetNames(r *http.Request) []string {
+	var names []string
+	for _, name := range s.TilesetNames() {
+		if layerVisible(r, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// layerVisible 列表接口只返回请求密钥可以访问的图层
+func layerVisible(r *http.Request, layer string) bool {
+	key, ok := r.Context().Value(apiKeyContext{}).(*accessKey)
+	return !ok || key.allowLayer(layer)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/pdxrlj/tile_server/pkg/metrics"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// TileETag 瓦片内容的哈希,内容不变时 ETag 不变
+func TileETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// cacheControl 图层配置的 Cache-Control,未配置时使用服务的默认值
+func (s *Server) cacheControl(name string) string {
+	s.tilesetMu.RLock()
+	defer s.tilesetMu.RUnlock()
+	if source, ok := s.sources[name]; ok && source.CacheControl != "" {
+		return source.CacheControl
+	}
+	return s.defaultCacheControl
+}
+
+// writeLayerTile 写出图层的瓦片,Last-Modified 取图层的修改时间
+func (s *Server) writeLayerTile(w http.ResponseWriter, r *http.Request, name string, z int, info TilesetInfo, data []byte, format string, err error) {
+	if err == nil {
+		metrics.TileServed(name, z)
+	}
+	serveTile(w, r, data, format, info.ModTime, s.cacheControl(name), err)
+}
+
+// serveTile 带 ETag、Last-Modified、Cache-Control 写出瓦片
+// If-None-Match 与 ETag 相同,或 If-Modified-Since 不早于修改时间时返回 304
+func serveTile(w http.ResponseWriter, r *http.Request, data []byte, format string, modTime time.Time, cacheControl string, err error) {
+	if err != nil {
+		writeTileError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", tile.ContentType(format))
+	w.Header().Set("ETag", TileETag(data))
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	// ServeContent 按 RFC 7232 处理条件请求,If-None-Match 优先于 If-Modified-Since
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
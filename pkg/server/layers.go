@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// handleLayers /layers 列出所有图层的 TileJSON,/layers/{layer} 返回单个图层
+func (s *Server) handleLayers(w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r)
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/layers"), "/")
+	if name == "" {
+		layers := []tile.TileJSON{}
+		for _, name := range s.TilesetNames() {
+			if !layerVisible(r, name) {
+				continue
+			}
+			if ts, ok := s.Tileset(name); ok {
+				layers = append(layers, layerTileJSON(base, name, ts.Info()))
+			}
+		}
+		writeJSON(w, http.StatusOK, layers)
+		return
+	}
+
+	ts, ok := s.Tileset(name)
+	if !ok {
+		http.Error(w, "unknown layer "+name, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, layerTileJSON(base, name, ts.Info()))
+}
+
+// layerTileJSON 图层的 TileJSON,瓦片地址指向 /{layer}/{z}/{x}/{y}.{fmt}
+func layerTileJSON(base, name string, info TilesetInfo) tile.TileJSON {
+	west, south, east, north := info.Bounds[0], info.Bounds[1], info.Bounds[2], info.Bounds[3]
+	return tile.TileJSON{
+		TileJSON: "3.0.0",
+		Name:     info.Name,
+		Scheme:   "xyz",
+		Tiles:    []string{fmt.Sprintf("%s/%s/{z}/{x}/{y}.%s", base, name, info.Format)},
+		MinZoom:  info.MinZoom,
+		MaxZoom:  info.MaxZoom,
+		Bounds:   []float64{west, south, east, north},
+		Center:   []float64{(west + east) / 2, (south + north) / 2, float64(info.MinZoom)},
+		Format:   info.Format,
+		TileSize: info.TileSize,
+	}
+}
+
+// handleLayerTile /{layer}/{z}/{x}/{y}.{fmt} 按图层名转发到对应的瓦片集
+// 实时渲染的图层支持 /cog 的渲染参数和其他输出格式
+func (s *Server) handleLayerTile(w http.ResponseWriter, r *http.Request) {
+	name, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	ts, release, ok := s.acquireTileset(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	defer release()
+	z, x, y, format, err := ParseTilePath(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	info := ts.Info()
+	if format == "" {
+		format = info.Format
+	}
+
+	// 只有渲染参数影响结果,api_key 和防缓存参数与不带参数的请求读取同一张瓦片
+	query := r.URL.Query()
+	renderOptions := tile.HasRenderOptions(query)
+	if dynamic, ok := ts.(*DynamicTileset); ok && (renderOptions || !sameFormat(format, info.Format)) {
+		var options *tile.RenderOptions
+		if renderOptions {
+			if options, err = tile.ParseRenderOptions(query); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if query.Get("return_mask") == "" {
+				// 与不带渲染参数的瓦片一致,默认不追加 alpha 波段
+				options.ReturnMask = false
+			}
+		}
+		data, err := s.renderTile(name, "", z, x, y, format, options, func() ([]byte, error) {
+			return dynamic.Render(z, x, y, format, options)
+		})
+		s.writeLayerTile(w, r, name, z, info, data, format, err)
+		return
+	}
+	if !sameFormat(format, info.Format) {
+		http.Error(w, "layer format is "+info.Format, http.StatusNotFound)
+		return
+	}
+
+	data, err := s.readTile(name, ts, z, x, y)
+	s.writeLayerTile(w, r, name, z, info, data, info.Format, err)
+}
+
+// sameFormat jpg 与 jpeg 视为同一格式
+func sameFormat(a, b string) bool {
+	if a == "jpeg" {
+		a = "jpg"
+	}
+	if b == "jpeg" {
+		b = "jpg"
+	}
+	return a == b
+}
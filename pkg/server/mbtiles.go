@@ -0,0 +1,106 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// MBTiles https://github.com/mapbox/mbtiles-spec,tile_row 按 TMS 从南往北
+type MBTiles struct {
+	db   *sql.DB
+	info TilesetInfo
+	prof pkgGdal.Profile
+}
+
+func OpenMBTiles(name, filename string) (*MBTiles, error) {
+	db, err := sql.Open("sqlite3", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	m := &MBTiles{db: db, prof: pkgGdal.NewMercator()}
+	if err := m.loadInfo(name); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	m.info.ModTime = modTime(filename)
+	return m, nil
+}
+
+func (m *MBTiles) loadInfo(name string) error {
+	rows, err := m.db.Query(`SELECT name, value FROM metadata`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		metadata[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	m.info = TilesetInfo{
+		Name:     name,
+		Format:   metadata["format"],
+		Bounds:   [4]float64{-180, -maxMercatorLat, 180, maxMercatorLat},
+		TileSize: 256,
+		Profile:  pkgGdal.ProfileMercator,
+	}
+	if m.info.Name == "" {
+		m.info.Name = metadata["name"]
+	}
+	if m.info.Format == "" {
+		m.info.Format = "png"
+	}
+	if bounds := strings.Split(metadata["bounds"], ","); len(bounds) == 4 {
+		for i, v := range bounds {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				m.info.Bounds[i] = f
+			}
+		}
+	}
+
+	// minzoom/maxzoom 缺省时从瓦片表统计
+	minZoom, errMin := strconv.Atoi(metadata["minzoom"])
+	maxZoom, errMax := strconv.Atoi(metadata["maxzoom"])
+	if errMin != nil || errMax != nil {
+		// 瓦片表为空时 MIN/MAX 为 NULL,层级保持为 0
+		var tableMin, tableMax sql.NullInt64
+		if err := m.db.QueryRow(`SELECT MIN(zoom_level), MAX(zoom_level) FROM tiles`).Scan(&tableMin, &tableMax); err != nil {
+			return err
+		}
+		minZoom, maxZoom = int(tableMin.Int64), int(tableMax.Int64)
+	}
+	m.info.MinZoom, m.info.MaxZoom = minZoom, maxZoom
+	return nil
+}
+
+func (m *MBTiles) Info() TilesetInfo {
+	return m.info
+}
+
+func (m *MBTiles) Tile(z, x, y int) ([]byte, error) {
+	var data []byte
+	_, row := m.prof.TMSTile(z, x, y)
+	err := m.db.QueryRow(`SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`,
+		z, x, row).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTileNotFound
+	}
+	return data, err
+}
+
+func (m *MBTiles) Close() error {
+	return m.db.Close()
+}
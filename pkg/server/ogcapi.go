@@ -0,0 +1,343 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// OGC API - Tiles 1.0 https://docs.ogc.org/is/20-057/20-057.html
+const (
+	crs84             = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+	relTilesetsMap    = "http://www.opengis.net/def/rel/ogc/1.0/tilesets-map"
+	relTilingScheme   = "http://www.opengis.net/def/rel/ogc/1.0/tiling-scheme"
+	relConformance    = "http://www.opengis.net/def/rel/ogc/1.0/conformance"
+	relTileMatrixSets = "http://www.opengis.net/def/rel/ogc/1.0/tiling-schemes"
+	// ogcMaxZoom 瓦片矩阵集文档列出的最大层级
+	ogcMaxZoom = 24
+)
+
+var ogcConformance = []string{
+	"http://www.opengis.net/spec/ogcapi-common-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-common-2/1.0/conf/collections",
+	"http://www.opengis.net/spec/ogcapi-tiles-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-tiles-1/1.0/conf/tileset",
+	"http://www.opengis.net/spec/ogcapi-tiles-1/1.0/conf/tilesets-list",
+	"http://www.opengis.net/spec/ogcapi-tiles-1/1.0/conf/geodata-tilesets",
+	"http://www.opengis.net/spec/ogcapi-tiles-1/1.0/conf/png",
+	"http://www.opengis.net/spec/ogcapi-tiles-1/1.0/conf/jpeg",
+	"http://www.opengis.net/spec/tms/2.0/conf/json-tilematrixset",
+}
+
+type ogcLink struct {
+	Href      string `json:"href"`
+	Rel       string `json:"rel"`
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+type ogcCollection struct {
+	ID     string    `json:"id"`
+	Title  string    `json:"title"`
+	Extent ogcExtent `json:"extent"`
+	Links  []ogcLink `json:"links"`
+}
+
+type ogcExtent struct {
+	Spatial struct {
+		Bbox [][4]float64 `json:"bbox"`
+		CRS  string       `json:"crs"`
+	} `json:"spatial"`
+}
+
+type ogcTileset struct {
+	Title            string          `json:"title"`
+	DataType         string          `json:"dataType"`
+	CRS              string          `json:"crs"`
+	TileMatrixSetURI string          `json:"tileMatrixSetURI,omitempty"`
+	Limits           []ogcTileLimits `json:"tileMatrixSetLimits,omitempty"`
+	BoundingBox      *ogcBoundingBox `json:"boundingBox,omitempty"`
+	Links            []ogcLink       `json:"links"`
+}
+
+type ogcTileLimits struct {
+	TileMatrix string `json:"tileMatrix"`
+	MinTileRow int    `json:"minTileRow"`
+	MaxTileRow int    `json:"maxTileRow"`
+	MinTileCol int    `json:"minTileCol"`
+	MaxTileCol int    `json:"maxTileCol"`
+}
+
+type ogcBoundingBox struct {
+	LowerLeft  [2]float64 `json:"lowerLeft"`
+	UpperRight [2]float64 `json:"upperRight"`
+	CRS        string     `json:"crs"`
+}
+
+type ogcTileMatrixSet struct {
+	ID                string          `json:"id"`
+	Title             string          `json:"title"`
+	URI               string          `json:"uri,omitempty"`
+	CRS               string          `json:"crs"`
+	WellKnownScaleSet string          `json:"wellKnownScaleSet,omitempty"`
+	OrderedAxes       []string        `json:"orderedAxes"`
+	TileMatrices      []ogcTileMatrix `json:"tileMatrices"`
+}
+
+type ogcTileMatrix struct {
+	ID               string     `json:"id"`
+	ScaleDenominator float64    `json:"scaleDenominator"`
+	CellSize         float64    `json:"cellSize"`
+	CornerOfOrigin   string     `json:"cornerOfOrigin"`
+	PointOfOrigin    [2]float64 `json:"pointOfOrigin"`
+	TileWidth        int        `json:"tileWidth"`
+	TileHeight       int        `json:"tileHeight"`
+	MatrixWidth      int        `json:"matrixWidth"`
+	MatrixHeight     int        `json:"matrixHeight"`
+}
+
+// uri 标准瓦片矩阵集的注册地址,非 256 的瓦片大小不是标准矩阵集
+func (t *TileMatrixSet) uri() string {
+	if t.TileSize != 256 {
+		return ""
+	}
+	return t.URI
+}
+
+// handleConformance /conformance
+func (s *Server) handleConformance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]string{"conformsTo": ogcConformance})
+}
+
+// handleCollections /collections 与 /collections/{id}[/tiles[/{tms}[/{z}/{y}/{x}]]]
+func (s *Server) handleCollections(w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r)
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/collections"), "/")
+	if path == "" {
+		collections := []ogcCollection{}
+		for _, name := range s.TilesetNames() {
+			if !layerVisible(r, name) {
+				continue
+			}
+			if ts, ok := s.Tileset(name); ok {
+				collections = append(collections, s.ogcCollection(base, name, ts.Info()))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"collections": collections,
+			"links":       []ogcLink{{Href: base + "/collections", Rel: "self", Type: "application/json"}},
+		})
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	ts, release, ok := s.acquireTileset(parts[0])
+	if !ok {
+		writeOGCException(w, http.StatusNotFound, "unknown collection "+parts[0])
+		return
+	}
+	defer release()
+	info := ts.Info()
+	tms, err := NewTileMatrixSet(info.Profile, info.TileSize)
+	if err != nil {
+		writeOGCException(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		writeJSON(w, http.StatusOK, s.ogcCollection(base, parts[0], info))
+	case parts[1] != "tiles":
+		writeOGCException(w, http.StatusNotFound, "not found")
+	case len(parts) == 2:
+		tileset := ogcTilesetSummary(base, parts[0], info, tms)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"tilesets": []ogcTileset{tileset},
+			"links":    []ogcLink{{Href: fmt.Sprintf("%s/collections/%s/tiles", base, parts[0]), Rel: "self", Type: "application/json"}},
+		})
+	case parts[2] != tms.id():
+		writeOGCException(w, http.StatusNotFound, "unknown tile matrix set "+parts[2])
+	case len(parts) == 3:
+		writeJSON(w, http.StatusOK, ogcTilesetMetadata(base, parts[0], info, tms))
+	case len(parts) == 6:
+		s.ogcTile(w, r, parts[0], ts, tms, parts[3], parts[4], parts[5])
+	default:
+		writeOGCException(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) ogcCollection(base, name string, info TilesetInfo) ogcCollection {
+	collection := ogcCollection{
+		ID:    name,
+		Title: info.Name,
+		Links: []ogcLink{
+			{Href: fmt.Sprintf("%s/collections/%s", base, name), Rel: "self", Type: "application/json"},
+			{Href: fmt.Sprintf("%s/collections/%s/tiles", base, name), Rel: relTilesetsMap, Type: "application/json", Title: "map tilesets"},
+		},
+	}
+	collection.Extent.Spatial.Bbox = [][4]float64{info.Bounds}
+	collection.Extent.Spatial.CRS = crs84
+	return collection
+}
+
+func ogcTilesetSummary(base, name string, info TilesetInfo, tms *TileMatrixSet) ogcTileset {
+	tilesetURL := fmt.Sprintf("%s/collections/%s/tiles/%s", base, name, tms.id())
+	return ogcTileset{
+		Title:            info.Name,
+		DataType:         "map",
+		CRS:              tms.CRS,
+		TileMatrixSetURI: tms.uri(),
+		Links: []ogcLink{
+			{Href: tilesetURL, Rel: "self", Type: "application/json"},
+			{Href: fmt.Sprintf("%s/tileMatrixSets/%s", base, tms.id()), Rel: relTilingScheme, Type: "application/json"},
+		},
+	}
+}
+
+// ogcTilesetMetadata 瓦片集元数据,层级范围、范围和格式取自切片结果
+func ogcTilesetMetadata(base, name string, info TilesetInfo, tms *TileMatrixSet) ogcTileset {
+	tileset := ogcTilesetSummary(base, name, info, tms)
+	tileset.BoundingBox = &ogcBoundingBox{
+		LowerLeft:  [2]float64{info.Bounds[0], info.Bounds[1]},
+		UpperRight: [2]float64{info.Bounds[2], info.Bounds[3]},
+		CRS:        crs84,
+	}
+	for z := info.MinZoom; z <= info.MaxZoom; z++ {
+		minCol, minRow, maxCol, maxRow := tms.TileLimits(z, info.Bounds)
+		tileset.Limits = append(tileset.Limits, ogcTileLimits{
+			TileMatrix: fmt.Sprint(z),
+			MinTileRow: minRow,
+			MaxTileRow: maxRow,
+			MinTileCol: minCol,
+			MaxTileCol: maxCol,
+		})
+	}
+	tileset.Links = append(tileset.Links, ogcLink{
+		Href:      fmt.Sprintf("%s/collections/%s/tiles/%s/{tileMatrix}/{tileRow}/{tileCol}", base, name, tms.id()),
+		Rel:       "item",
+		Type:      tile.ContentType(info.Format),
+		Templated: true,
+	})
+	return tileset
+}
+
+func (s *Server) ogcTile(w http.ResponseWriter, r *http.Request, name string, ts Tileset, tms *TileMatrixSet, matrix, row, col string) {
+	info := ts.Info()
+	col, format, _ := strings.Cut(col, ".")
+	z, errZ := strconv.Atoi(matrix)
+	y, errY := strconv.Atoi(row)
+	x, errX := strconv.Atoi(col)
+	if errZ != nil || errY != nil || errX != nil {
+		writeOGCException(w, http.StatusBadRequest, "tileMatrix, tileRow and tileCol must be integers")
+		return
+	}
+	if format != "" && tile.ContentType(format) != tile.ContentType(info.Format) {
+		writeOGCException(w, http.StatusNotAcceptable, "tileset format is "+tile.ContentType(info.Format))
+		return
+	}
+	minCol, minRow, maxCol, maxRow := tms.TileLimits(z, info.Bounds)
+	if z < info.MinZoom || z > info.MaxZoom || x < minCol || x > maxCol || y < minRow || y > maxRow {
+		writeOGCException(w, http.StatusNotFound, "tile is outside the tileset limits")
+		return
+	}
+
+	data, err := s.readTile(name, ts, z, x, y)
+	s.writeLayerTile(w, r, name, z, info, data, info.Format, err)
+}
+
+// handleTileMatrixSets /tileMatrixSets 与 /tileMatrixSets/{id},只列出已发布瓦片集用到的矩阵集
+func (s *Server) handleTileMatrixSets(w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r)
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/tileMatrixSets"), "/")
+
+	sets := make(map[string]*TileMatrixSet)
+	var order []string
+	for _, name := range s.visibleTilesetNames(r) {
+		ts, ok := s.Tileset(name)
+		if !ok {
+			continue
+		}
+		info := ts.Info()
+		tms, err := NewTileMatrixSet(info.Profile, info.TileSize)
+		if err != nil {
+			continue
+		}
+		if _, ok := sets[tms.id()]; !ok {
+			sets[tms.id()] = tms
+			order = append(order, tms.id())
+		}
+	}
+
+	if id == "" {
+		list := []map[string]any{}
+		for _, id := range order {
+			tms := sets[id]
+			list = append(list, map[string]any{
+				"id":    id,
+				"title": tms.Title,
+				"uri":   tms.uri(),
+				"links": []ogcLink{{Href: fmt.Sprintf("%s/tileMatrixSets/%s", base, id), Rel: relTilingScheme, Type: "application/json"}},
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"tileMatrixSets": list})
+		return
+	}
+
+	tms, ok := sets[id]
+	if !ok {
+		writeOGCException(w, http.StatusNotFound, "unknown tile matrix set "+id)
+		return
+	}
+	doc := ogcTileMatrixSet{
+		ID:                id,
+		Title:             tms.Title,
+		URI:               tms.uri(),
+		CRS:               tms.CRS,
+		WellKnownScaleSet: tms.WellKnownScaleSet,
+		OrderedAxes:       []string{"E", "N"},
+	}
+	if tms.TileSize != 256 {
+		doc.WellKnownScaleSet = ""
+	}
+	if tms.CRS == crs84 {
+		doc.OrderedAxes = []string{"Lon", "Lat"}
+	}
+	for _, m := range tms.Matrices(ogcMaxZoom) {
+		doc.TileMatrices = append(doc.TileMatrices, ogcTileMatrix{
+			ID:               m.ID,
+			ScaleDenominator: m.ScaleDenominator,
+			CellSize:         m.CellSize,
+			CornerOfOrigin:   "topLeft",
+			PointOfOrigin:    m.TopLeft,
+			TileWidth:        m.TileWidth,
+			TileHeight:       m.TileHeight,
+			MatrixWidth:      m.MatrixWidth,
+			MatrixHeight:     m.MatrixHeight,
+		})
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// writeOGCException OGC API 的错误响应
+func writeOGCException(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]any{
+		"code":        http.StatusText(status),
+		"description": detail,
+	})
+}
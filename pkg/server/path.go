@@ -0,0 +1,27 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrTilePath = errors.New("tile path must be {z}/{x}/{y}.{format}")
+
+// ParseTilePath 解析 {z}/{x}/{y}.{format},format 为空时返回空字符串
+func ParseTilePath(path string) (int, int, int, string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, "", ErrTilePath
+	}
+	last, format, _ := strings.Cut(parts[2], ".")
+	values := make([]int, 3)
+	for i, part := range []string{parts[0], parts[1], last} {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return 0, 0, 0, "", ErrTilePath
+		}
+		values[i] = v
+	}
+	return values[0], values[1], values[2], format, nil
+}
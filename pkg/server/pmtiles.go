@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/pmtiles"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// PMTiles 切片流程打包的 .pmtiles 单文件,层级和范围取自文件头
+type PMTiles struct {
+	reader *pmtiles.Reader
+	info   TilesetInfo
+}
+
+func OpenPMTiles(name, filename string) (*PMTiles, error) {
+	reader, err := pmtiles.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	header := reader.Header()
+	metadata := tile.Metadata{}
+	// 元数据用于取名称、瓦片大小和切片方案,缺失时按 256 像素的墨卡托瓦片读取
+	_ = reader.UnmarshalMetadata(&metadata)
+	if name == "" {
+		name = metadata.Name
+	}
+	tileSize, err := strconv.Atoi(metadata.TileSize)
+	if err != nil || tileSize <= 0 {
+		tileSize = 256
+	}
+	profile := pkgGdal.ProfileMercator
+	if metadata.Profile != "" {
+		profile = metadata.Profile
+	}
+	format := "png"
+	if header.TileType == pmtiles.TileTypeJpeg {
+		format = "jpg"
+	}
+
+	return &PMTiles{
+		reader: reader,
+		info: TilesetInfo{
+			Name:     name,
+			Format:   format,
+			MinZoom:  int(header.MinZoom),
+			MaxZoom:  int(header.MaxZoom),
+			Bounds:   [4]float64{header.MinLon, header.MinLat, header.MaxLon, header.MaxLat},
+			TileSize: tileSize,
+			Profile:  profile,
+			ModTime:  modTime(filename),
+		},
+	}, nil
+}
+
+func (p *PMTiles) Info() TilesetInfo {
+	return p.info
+}
+
+func (p *PMTiles) Tile(z, x, y int) ([]byte, error) {
+	if z < 0 || z > 31 || x < 0 || y < 0 {
+		return nil, ErrTileNotFound
+	}
+	data, err := p.reader.GetTile(uint8(z), uint32(x), uint32(y))
+	if errors.Is(err, pmtiles.ErrTileNotFound) {
+		return nil, ErrTileNotFound
+	}
+	return data, err
+}
+
+func (p *PMTiles) Close() error {
+	return p.reader.Close()
+}
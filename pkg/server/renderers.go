@@ -0,0 +1,110 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// rendererCache 按源文件缓存渲染器,超出数量时淘汰最久未访问的渲染器
+// 被淘汰的渲染器等正在渲染的请求释放后再关闭
+type rendererCache struct {
+	mu    sync.Mutex
+	max   int
+	items map[string]*list.Element
+	order *list.List
+}
+
+type rendererEntry struct {
+	path     string
+	renderer *tile.Renderer
+	refs     int
+	evicted  bool
+}
+
+func newRendererCache(max int) *rendererCache {
+	return &rendererCache{
+		max:   max,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// acquire 取出源文件的渲染器,用完后调用 release
+func (c *rendererCache) acquire(path string) (*rendererEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[path]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	entry := element.Value.(*rendererEntry)
+	entry.refs++
+	return entry, true
+}
+
+// add 加入新建的渲染器,其他请求已经加入同一源文件时关闭新建的渲染器,返回已有的
+func (c *rendererCache) add(path string, renderer *tile.Renderer) *rendererEntry {
+	c.mu.Lock()
+	if element, ok := c.items[path]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*rendererEntry)
+		entry.refs++
+		c.mu.Unlock()
+		renderer.Close()
+		return entry
+	}
+	entry := &rendererEntry{path: path, renderer: renderer, refs: 1}
+	c.items[path] = c.order.PushFront(entry)
+	var closing []*tile.Renderer
+	for c.max > 0 && c.order.Len() > c.max {
+		if evicted := c.evict(c.order.Back()); evicted != nil {
+			closing = append(closing, evicted)
+		}
+	}
+	c.mu.Unlock()
+	for _, evicted := range closing {
+		evicted.Close()
+	}
+	return entry
+}
+
+// release 请求结束,已淘汰且没有请求在用的渲染器在这里关闭
+func (c *rendererCache) release(entry *rendererEntry) {
+	c.mu.Lock()
+	entry.refs--
+	closing := entry.evicted && entry.refs == 0
+	c.mu.Unlock()
+	if closing {
+		entry.renderer.Close()
+	}
+}
+
+// evict 移出缓存,没有请求在用时返回需要关闭的渲染器
+func (c *rendererCache) evict(element *list.Element) *tile.Renderer {
+	entry := element.Value.(*rendererEntry)
+	c.order.Remove(element)
+	delete(c.items, entry.path)
+	entry.evicted = true
+	if entry.refs > 0 {
+		return nil
+	}
+	return entry.renderer
+}
+
+// close 淘汰全部渲染器
+func (c *rendererCache) close() {
+	c.mu.Lock()
+	var closing []*tile.Renderer
+	for c.order.Len() > 0 {
+		if evicted := c.evict(c.order.Back()); evicted != nil {
+			closing = append(closing, evicted)
+		}
+	}
+	c.mu.Unlock()
+	for _, renderer := range closing {
+		renderer.Close()
+	}
+}
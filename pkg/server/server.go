@@ -0,0 +1,509 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/pdxrlj/tile_server/pkg/cache"
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/metrics"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+var (
+	ErrPathNotAllowed = errors.New("path is outside the data root")
+	ErrNoDataRoot     = errors.New("data root is not configured, path is not allowed")
+	ErrMissingPath    = errors.New("missing path parameter")
+	ErrTilesetName    = errors.New("tileset name is empty")
+	ErrDuplicateParam = errors.New("duplicate query parameter")
+)
+
+type Server struct {
+	addr     string
+	dataRoot string
+	workers  int
+	tileSize int
+	profile  string
+	mux      *http.ServeMux
+	// 按源文件缓存的实时渲染器,最多 maxRenderers 个
+	renderers    *rendererCache
+	maxRenderers int
+	// 按图层名发布的瓦片集
+	tilesetMu sync.RWMutex
+	tilesets  map[string]*tilesetEntry
+	// syncMu 串行执行 SyncTilesets,配置监听与启动时的同步可能同时发生
+	syncMu sync.Mutex
+	// 由 SyncTilesets 按配置打开的瓦片集及其配置
+	sources map[string]TilesetSource
+	// 瓦片集前的缓存,为空时直接读取
+	cache *cache.Cache
+	// 未单独配置的图层和 /cog 瓦片使用的 Cache-Control
+	defaultCacheControl string
+	pprof               bool
+	metrics             bool
+	// 按密钥值索引的访问密钥,为空时不校验
+	accessKeys  map[string]*accessKey
+	corsOrigins map[string]bool
+	// logger 记录被拒绝的请求
+	logger *slog.Logger
+}
+
+type Option func(*Server)
+
+func WithAddr(addr string) Option {
+	return func(s *Server) {
+		s.addr = addr
+	}
+}
+
+// WithDataRoot 限制 ?path= 只能访问该目录下的文件,未设置时 /cog 不可用
+func WithDataRoot(dataRoot string) Option {
+	return func(s *Server) {
+		s.dataRoot = dataRoot
+	}
+}
+
+// WithWorkers 每个源文件同时渲染的请求数
+func WithWorkers(workers int) Option {
+	return func(s *Server) {
+		s.workers = workers
+	}
+}
+
+// WithMaxRenderers /cog 同时打开的源文件数,超出时关闭最久未访问的
+func WithMaxRenderers(maxRenderers int) Option {
+	return func(s *Server) {
+		s.maxRenderers = maxRenderers
+	}
+}
+
+func WithTileSize(tileSize int) Option {
+	return func(s *Server) {
+		s.tileSize = tileSize
+	}
+}
+
+func WithProfile(profile string) Option {
+	return func(s *Server) {
+		s.profile = profile
+	}
+}
+
+// WithCache 在瓦片集前加一层缓存
+func WithCache(c *cache.Cache) Option {
+	return func(s *Server) {
+		s.cache = c
+	}
+}
+
+// WithCacheControl 瓦片响应默认的 Cache-Control,图层可以单独配置
+func WithCacheControl(cacheControl string) Option {
+	return func(s *Server) {
+		s.defaultCacheControl = cacheControl
+	}
+}
+
+// WithMetrics 挂载 /metrics,默认关闭
+func WithMetrics(enable bool) Option {
+	return func(s *Server) {
+		s.metrics = enable
+	}
+}
+
+// WithPprof 挂载 /debug/pprof/,默认关闭
+func WithPprof(enable bool) Option {
+	return func(s *Server) {
+		s.pprof = enable
+	}
+}
+
+// WithAPIKeys 只允许持有密钥的请求访问,并按密钥限流和限制图层
+func WithAPIKeys(keys []APIKey) Option {
+	return func(s *Server) {
+		s.accessKeys = newAccessKeys(keys)
+	}
+}
+
+// WithCORSOrigins 允许跨域访问的来源,"*" 表示所有来源
+func WithCORSOrigins(origins []string) Option {
+	return func(s *Server) {
+		s.corsOrigins = make(map[string]bool, len(origins))
+		for _, origin := range origins {
+			s.corsOrigins[origin] = true
+		}
+	}
+}
+
+// WithLogger 记录被拒绝请求的结构化日志,默认输出 JSON 到标准错误
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+func New(options ...Option) *Server {
+	s := &Server{
+		addr:         ":8080",
+		workers:      4,
+		tileSize:     256,
+		profile:      pkgGdal.ProfileMercator,
+		mux:          http.NewServeMux(),
+		maxRenderers: 64,
+		tilesets:     make(map[string]*tilesetEntry),
+		sources:      make(map[string]TilesetSource),
+		logger:       slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.renderers = newRendererCache(s.maxRenderers)
+	s.mux.HandleFunc("/cog/", s.handleCOG)
+	s.mux.HandleFunc("/wmts", s.handleWMTS)
+	s.mux.HandleFunc("/wmts/", s.handleWMTSRest)
+	s.mux.HandleFunc("/wms", s.handleWMS)
+	s.mux.HandleFunc("/conformance", s.handleConformance)
+	s.mux.HandleFunc("/collections", s.handleCollections)
+	s.mux.HandleFunc("/collections/", s.handleCollections)
+	s.mux.HandleFunc("/tileMatrixSets", s.handleTileMatrixSets)
+	s.mux.HandleFunc("/tileMatrixSets/", s.handleTileMatrixSets)
+	s.mux.HandleFunc("/layers", s.handleLayers)
+	s.mux.HandleFunc("/layers/", s.handleLayers)
+	s.mux.HandleFunc("/cache/stats", s.handleCacheStats)
+	if s.metrics {
+		s.mux.Handle("/metrics", promhttp.Handler())
+	}
+	if s.pprof {
+		metrics.RegisterPprof(s.mux)
+	}
+	s.mux.HandleFunc("/", s.handleLayerTile)
+	return s
+}
+
+// tilesetEntry 发布中的瓦片集,替换或删除后等正在读取的请求结束再关闭
+type tilesetEntry struct {
+	Tileset
+	mu      sync.Mutex
+	refs    int
+	retired bool
+}
+
+func (e *tilesetEntry) acquire() {
+	e.mu.Lock()
+	e.refs++
+	e.mu.Unlock()
+}
+
+func (e *tilesetEntry) release() {
+	e.mu.Lock()
+	e.refs--
+	closing := e.retired && e.refs == 0
+	e.mu.Unlock()
+	if closing {
+		_ = e.Close()
+	}
+}
+
+// retire 停止发布,没有请求在读取时立即关闭
+func (e *tilesetEntry) retire() {
+	e.mu.Lock()
+	e.retired = true
+	closing := e.refs == 0
+	e.mu.Unlock()
+	if closing {
+		_ = e.Close()
+	}
+}
+
+// AddTileset 以图层名发布瓦片集,同名的旧瓦片集在正在读取的请求结束后关闭
+func (s *Server) AddTileset(name string, tileset Tileset) {
+	s.tilesetMu.Lock()
+	old, ok := s.tilesets[name]
+	s.tilesets[name] = &tilesetEntry{Tileset: tileset}
+	s.tilesetMu.Unlock()
+	if ok {
+		s.purgeCache(name)
+		old.retire()
+	}
+}
+
+// RemoveTileset 停止发布瓦片集,正在读取的请求结束后关闭
+func (s *Server) RemoveTileset(name string) {
+	s.tilesetMu.Lock()
+	old, ok := s.tilesets[name]
+	delete(s.tilesets, name)
+	delete(s.sources, name)
+	s.tilesetMu.Unlock()
+	if ok {
+		s.purgeCache(name)
+		old.retire()
+	}
+}
+
+// SyncTilesets 按配置同步发布的瓦片集:新增或配置有变化的重新打开,配置中删除的关闭
+// 打开失败的图层保留原来的瓦片集,错误合并返回
+func (s *Server) SyncTilesets(sources []TilesetSource) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	var errs []error
+	wanted := make(map[string]bool)
+	for _, source := range sources {
+		if source.Name == "" {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrTilesetName, source.Path))
+			continue
+		}
+		wanted[source.Name] = true
+		s.tilesetMu.RLock()
+		old, ok := s.sources[source.Name]
+		s.tilesetMu.RUnlock()
+		if ok && old == source {
+			continue
+		}
+		tileset, err := s.OpenTileset(source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("open tileset %s: %w", source.Name, err))
+			continue
+		}
+		s.AddTileset(source.Name, tileset)
+		s.tilesetMu.Lock()
+		s.sources[source.Name] = source
+		s.tilesetMu.Unlock()
+	}
+
+	s.tilesetMu.RLock()
+	var removed []string
+	for name := range s.sources {
+		if !wanted[name] {
+			removed = append(removed, name)
+		}
+	}
+	s.tilesetMu.RUnlock()
+	for _, name := range removed {
+		s.RemoveTileset(name)
+	}
+	return errors.Join(errs...)
+}
+
+// readTile 经过缓存读取瓦片,未配置缓存时直接读取
+func (s *Server) readTile(name string, ts Tileset, z, x, y int) ([]byte, error) {
+	if s.cache == nil {
+		return ts.Tile(z, x, y)
+	}
+	key := fmt.Sprintf("%s/%d/%d/%d.%s", name, z, x, y, ts.Info().Format)
+	return s.cache.Get(key, func() ([]byte, error) {
+		return ts.Tile(z, x, y)
+	})
+}
+
+// renderTile 经过缓存实时渲染,key 以 prefix 开头,包含源文件和规范化的渲染参数
+// 渲染参数和源文件路径取摘要,作为磁盘缓存的路径也不会含特殊字符
+func (s *Server) renderTile(prefix, source string, z, x, y int, format string, options *tile.RenderOptions, render func() ([]byte, error)) ([]byte, error) {
+	if s.cache == nil {
+		return render()
+	}
+	// 未带渲染参数时与切片流程的读取一致,与默认参数的结果不同
+	optionsKey := "-"
+	if options != nil {
+		optionsKey = options.Key()
+	}
+	sum := sha256.Sum256([]byte(source + "\x00" + optionsKey))
+	key := fmt.Sprintf("%s/%d/%d/%d/%s.%s", prefix, z, x, y, hex.EncodeToString(sum[:12]), format)
+	return s.cache.Get(key, render)
+}
+
+// purgeCache 图层替换或删除后清理它的缓存
+func (s *Server) purgeCache(name string) {
+	if s.cache != nil {
+		s.cache.Purge(name + "/")
+	}
+}
+
+// handleCacheStats /cache/stats 缓存命中统计
+func (s *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if s.cache == nil {
+		http.Error(w, "cache is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.cache.Stats())
+}
+
+// Tileset 发布中的瓦片集,只用于读取元数据;读取瓦片使用 acquireTileset
+func (s *Server) Tileset(name string) (Tileset, bool) {
+	s.tilesetMu.RLock()
+	defer s.tilesetMu.RUnlock()
+	entry, ok := s.tilesets[name]
+	if !ok {
+		return nil, false
+	}
+	return entry.Tileset, true
+}
+
+// acquireTileset 取出瓦片集用于读取瓦片,读取结束后调用 release,期间瓦片集不会被关闭
+func (s *Server) acquireTileset(name string) (Tileset, func(), bool) {
+	s.tilesetMu.RLock()
+	defer s.tilesetMu.RUnlock()
+	entry, ok := s.tilesets[name]
+	if !ok {
+		return nil, nil, false
+	}
+	entry.acquire()
+	return entry.Tileset, entry.release, true
+}
+
+// TilesetNames 按名称排序的图层列表
+func (s *Server) TilesetNames() []string {
+	s.tilesetMu.RLock()
+	defer s.tilesetMu.RUnlock()
+	names := make([]string, 0, len(s.tilesets))
+	for name := range s.tilesets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handler 先处理跨域,解析 OGC 参数后再校验访问密钥
+func (s *Server) Handler() http.Handler {
+	return chain(s.mux, s.cors(), s.kvp(), s.apiKeys())
+}
+
+func (s *Server) ListenAndServe() error {
+	log.Printf("瓦片服务监听:%s", s.addr)
+	return http.ListenAndServe(s.addr, s.Handler())
+}
+
+func (s *Server) Close() {
+	s.renderers.close()
+
+	s.tilesetMu.Lock()
+	defer s.tilesetMu.Unlock()
+	for name, entry := range s.tilesets {
+		entry.retire()
+		delete(s.tilesets, name)
+		delete(s.sources, name)
+	}
+}
+
+// handleCOG /cog/{z}/{x}/{y}.{fmt}?path=... 实时渲染源影像瓦片
+// 支持 bidx、rescale、colormap_name、nodata、resampling、return_mask 渲染参数
+func (s *Server) handleCOG(w http.ResponseWriter, r *http.Request) {
+	z, x, y, format, err := ParseTilePath(strings.TrimPrefix(r.URL.Path, "/cog/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == "" {
+		format = "png"
+	}
+	options, err := tile.ParseRenderOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry, err := s.renderer(r.URL.Query().Get("path"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPathNotAllowed), errors.Is(err, ErrNoDataRoot):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrMissingPath):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+		return
+	}
+
+	data, err := s.renderTile("cog", entry.renderer.Filename(), z, x, y, format, options, func() ([]byte, error) {
+		return entry.renderer.Render(z, x, y, format, options)
+	})
+	modTime := entry.renderer.ModTime()
+	s.renderers.release(entry)
+	if err == nil {
+		metrics.TileServed("cog", z)
+	}
+	serveTile(w, r, data, format, modTime, s.defaultCacheControl, err)
+}
+
+// renderer 取出或创建源文件的渲染器,用完后调用 s.renderers.release
+// 打开源文件不持有锁,同一文件并发创建时只保留先加入的渲染器
+func (s *Server) renderer(path string) (*rendererEntry, error) {
+	path, err := s.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if entry, ok := s.renderers.acquire(path); ok {
+		return entry, nil
+	}
+	renderer, err := tile.NewRenderer(path,
+		tile.WithRendererTileSize(s.tileSize),
+		tile.WithRendererWorkers(s.workers),
+		tile.WithRendererProfile(s.profile),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.renderers.add(path, renderer), nil
+}
+
+// resolvePath 相对路径基于 data root,解析符号链接后不能跳出该目录;未设置 data root 时拒绝访问
+func (s *Server) resolvePath(path string) (string, error) {
+	if path == "" {
+		return "", ErrMissingPath
+	}
+	if s.dataRoot == "" {
+		return "", ErrNoDataRoot
+	}
+	root, err := filepath.Abs(s.dataRoot)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	if !insideRoot(root, path) {
+		return "", ErrPathNotAllowed
+	}
+	// 解析符号链接后再比较,data root 内指向外部的链接同样拒绝
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", err
+	}
+	if !insideRoot(root, path) {
+		return "", ErrPathNotAllowed
+	}
+	return path, nil
+}
+
+func insideRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writeTileError 影像范围外返回 204,瓦片不存在返回 404
+func writeTileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pkgGdal.ErrOutsideFootprint):
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrTileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, pkgGdal.ErrTileFormat), errors.Is(err, pkgGdal.ErrBandIndex), errors.Is(err, pkgGdal.ErrColormap):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("渲染瓦片失败:%s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"math"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// standardPixelSize OGC 规定的标准像素大小 0.28mm,用于计算比例尺分母
+const standardPixelSize = 0.00028
+
+// metersPerDegree 赤道上 1 度对应的米数
+const metersPerDegree = 2 * math.Pi * 6378137 / 360
+
+// TileMatrixSet OGC 2D Tile Matrix Set,墨卡托为 WebMercatorQuad,经纬度为 WorldCRS84Quad
+type TileMatrixSet struct {
+	ID                string
+	Title             string
+	URI               string
+	CRS               string
+	WellKnownScaleSet string
+	TileSize          int
+	Profile           pkgGdal.Profile
+}
+
+// TileMatrix 单个层级的瓦片矩阵,左上角坐标按 CRS 轴顺序
+type TileMatrix struct {
+	ID               string
+	Zoom             int
+	ScaleDenominator float64
+	CellSize         float64
+	TopLeft          [2]float64
+	TileWidth        int
+	TileHeight       int
+	MatrixWidth      int
+	MatrixHeight     int
+}
+
+func NewTileMatrixSet(profileName string, tileSize int) (*TileMatrixSet, error) {
+	profile, err := pkgGdal.NewProfile(profileName, tileSize)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Name() == pkgGdal.ProfileGeodetic {
+		return &TileMatrixSet{
+			ID:       "WorldCRS84Quad",
+			Title:    "CRS84 for the World",
+			URI:      "http://www.opengis.net/def/tilematrixset/OGC/1.0/WorldCRS84Quad",
+			CRS:      "http://www.opengis.net/def/crs/OGC/1.3/CRS84",
+			TileSize: tileSize,
+			Profile:  profile,
+		}, nil
+	}
+	return &TileMatrixSet{
+		ID:                "WebMercatorQuad",
+		Title:             "Google Maps Compatible for the World",
+		URI:               "http://www.opengis.net/def/tilematrixset/OGC/1.0/WebMercatorQuad",
+		CRS:               "http://www.opengis.net/def/crs/EPSG/0/3857",
+		WellKnownScaleSet: "http://www.opengis.net/def/wkss/OGC/1.0/GoogleMapsCompatible",
+		TileSize:          tileSize,
+		Profile:           profile,
+	}, nil
+}
+
+// URN WMTS 1.0 使用的 CRS 标识
+func (t *TileMatrixSet) URN() string {
+	if t.Profile.Name() == pkgGdal.ProfileGeodetic {
+		return "urn:ogc:def:crs:OGC:1.3:CRS84"
+	}
+	return "urn:ogc:def:crs:EPSG::3857"
+}
+
+func (t *TileMatrixSet) Matrix(z int) TileMatrix {
+	res := t.Profile.Resolution(z)
+	metersPerUnit := 1.0
+	if t.Profile.Name() == pkgGdal.ProfileGeodetic {
+		metersPerUnit = metersPerDegree
+	}
+	originX, originY := t.Profile.Origin()
+	maxX, maxY := t.Profile.MaxTile(z)
+	return TileMatrix{
+		ID:               fmt.Sprint(z),
+		Zoom:             z,
+		ScaleDenominator: res * metersPerUnit / standardPixelSize,
+		CellSize:         res,
+		// 左上角为原点 y 加上整列瓦片的高度
+		TopLeft:      [2]float64{originX, originY + float64(maxY+1)*res*float64(t.TileSize)},
+		TileWidth:    t.TileSize,
+		TileHeight:   t.TileSize,
+		MatrixWidth:  maxX + 1,
+		MatrixHeight: maxY + 1,
+	}
+}
+
+// Matrices 0 级到 maxZoom 的瓦片矩阵
+func (t *TileMatrixSet) Matrices(maxZoom int) []TileMatrix {
+	matrices := make([]TileMatrix, 0, maxZoom+1)
+	for z := 0; z <= maxZoom; z++ {
+		matrices = append(matrices, t.Matrix(z))
+	}
+	return matrices
+}
+
+// TileLimits 经纬度范围在该层级覆盖的 XYZ 行列号 minCol, minRow, maxCol, maxRow
+func (t *TileMatrixSet) TileLimits(z int, bounds [4]float64) (int, int, int, int) {
+	project := func(lon, lat float64) (float64, float64) {
+		if t.Profile.Name() == pkgGdal.ProfileMercator {
+			lat = math.Max(-maxMercatorLat, math.Min(maxMercatorLat, lat))
+			return pkgGdal.NewMercator().LonLatToMeters(lon, lat)
+		}
+		return lon, lat
+	}
+	minx, miny := project(bounds[0], bounds[1])
+	maxx, maxy := project(bounds[2], bounds[3])
+	tminx, tminy := t.Profile.MeterToTile(z, minx, miny)
+	tmaxx, tmaxy := t.Profile.MeterToTile(z, maxx, maxy)
+	maxX, maxY := t.Profile.MaxTile(z)
+	clamp := func(v, hi int) int {
+		return max(0, min(hi, v))
+	}
+	tminx, tmaxx = clamp(tminx, maxX), clamp(tmaxx, maxX)
+	tminy, tmaxy = clamp(tminy, maxY), clamp(tmaxy, maxY)
+	// TMS 行号转换为从北往南
+	_, minRow := t.Profile.GoogleTile(z, tminx, tmaxy)
+	_, maxRow := t.Profile.GoogleTile(z, tminx, tminy)
+	return tminx, minRow, tmaxx, maxRow
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// maxMercatorLat Web 墨卡托的纬度范围
+const maxMercatorLat = 85.0511287798
+
+const (
+	TilesetDir     = "dir"
+	TilesetMBTiles = "mbtiles"
+	TilesetPMTiles = "pmtiles"
+	TilesetDynamic = "dynamic"
+)
+
+var (
+	ErrTileNotFound = errors.New("tile not found")
+	ErrTilesetType  = errors.New("unknown tileset type, use dir/mbtiles/pmtiles/dynamic")
+)
+
+// TilesetInfo 瓦片集元数据,范围为经纬度 west, south, east, north
+// ModTime 为切片结果或源文件的修改时间,用作瓦片的 Last-Modified
+type TilesetInfo struct {
+	Name     string
+	Format   string
+	MinZoom  int
+	MaxZoom  int
+	Bounds   [4]float64
+	TileSize int
+	Profile  string
+	ModTime  time.Time
+}
+
+// Tileset 瓦片来源:切片目录、MBTiles、PMTiles 或实时渲染
+type Tileset interface {
+	Info() TilesetInfo
+	// Tile 按 XYZ 瓦片号读取,y 从北往南;瓦片不存在时返回 ErrTileNotFound
+	Tile(z, x, y int) ([]byte, error)
+	Close() error
+}
+
+// MapTileset 能按任意坐标系和范围渲染的瓦片集,通过 WMS 发布
+type MapTileset interface {
+	Tileset
+	// RenderMap bbox 为 epsg 坐标系下的 minx,miny,maxx,maxy
+	RenderMap(epsg int, bbox [4]float64, width, height int, format string, options *tile.RenderOptions) ([]byte, error)
+}
+
+// TilesetSource 瓦片集配置
+type TilesetSource struct {
+	Name string
+	Type string
+	Path string
+	// MinZoom MaxZoom 实时渲染的层级范围,MaxZoom 为 0 时按影像分辨率计算
+	MinZoom int
+	MaxZoom int
+	// CacheControl 瓦片响应的 Cache-Control,为空时使用服务的默认值
+	CacheControl string
+	// SrcSRS Georeference 实时渲染覆盖源影像坐标系和地理参考方式,与切片流程的 --s_srs --georeference 相同
+	SrcSRS       string
+	Georeference string
+}
+
+// OpenTileset 按类型打开瓦片集,实时渲染使用服务的瓦片大小、切片方案和 worker 数
+func (s *Server) OpenTileset(source TilesetSource) (Tileset, error) {
+	switch source.Type {
+	case TilesetDir:
+		return OpenDirTileset(source.Name, source.Path)
+	case TilesetMBTiles:
+		return OpenMBTiles(source.Name, source.Path)
+	case TilesetPMTiles:
+		return OpenPMTiles(source.Name, source.Path)
+	case TilesetDynamic:
+		renderer, err := tile.NewRenderer(source.Path,
+			tile.WithRendererTileSize(s.tileSize),
+			tile.WithRendererWorkers(s.workers),
+			tile.WithRendererProfile(s.profile),
+			tile.WithRendererSrcSRS(source.SrcSRS),
+			tile.WithRendererGeoreference(source.Georeference),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return NewDynamicTileset(source.Name, renderer, source.MinZoom, source.MaxZoom), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTilesetType, source.Type)
+}
+
+// DirTileset 切片流程输出的目录,按 tilejson.json(或 metadata.json)中的路径模板读取瓦片
+type DirTileset struct {
+	folder string
+	info   TilesetInfo
+	layout *tile.Layout
+	prof   pkgGdal.Profile
+}
+
+func OpenDirTileset(name, folder string) (*DirTileset, error) {
+	tileJSON, infoFile, err := readDirTileJSON(folder)
+	if err != nil {
+		return nil, err
+	}
+	if len(tileJSON.Tiles) == 0 || len(tileJSON.Bounds) != 4 {
+		return nil, fmt.Errorf("invalid %s in %s", infoFile, folder)
+	}
+
+	profileName, resourceTileSize := dirProfile(folder)
+	tileSize := tileJSON.TileSize
+	if tileSize == 0 {
+		tileSize = resourceTileSize
+	}
+	if tileSize == 0 {
+		tileSize = 256
+	}
+	profile, err := pkgGdal.NewProfile(profileName, tileSize)
+	if err != nil {
+		return nil, err
+	}
+	template := strings.TrimSuffix(tileJSON.Tiles[0], filepath.Ext(tileJSON.Tiles[0]))
+	layout, err := tile.NewLayout(template, tileJSON.Scheme, profile)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = tileJSON.Name
+	}
+	format := tileJSON.Format
+	if format == "" {
+		format = "png"
+	}
+
+	return &DirTileset{
+		folder: folder,
+		layout: layout,
+		prof:   profile,
+		info: TilesetInfo{
+			Name:     name,
+			Format:   format,
+			MinZoom:  tileJSON.MinZoom,
+			MaxZoom:  tileJSON.MaxZoom,
+			Bounds:   [4]float64{tileJSON.Bounds[0], tileJSON.Bounds[1], tileJSON.Bounds[2], tileJSON.Bounds[3]},
+			TileSize: tileSize,
+			Profile:  profileName,
+			// 元数据在切片结束时写入
+			ModTime: dirModTime(folder, infoFile),
+		},
+	}, nil
+}
+
+// modTime 文件的修改时间,读取失败时为零值
+func modTime(filename string) time.Time {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// dirModTime 目录图层的修改时间,元数据文件读取不到时取目录的修改时间
+func dirModTime(folder, infoFile string) time.Time {
+	if t := modTime(filepath.Join(folder, infoFile)); !t.IsZero() {
+		return t
+	}
+	return modTime(folder)
+}
+
+// readDirTileJSON 读取 tilejson.json,quadkey、arcgis 等布局没有 tilejson.json 时读取 metadata.json
+func readDirTileJSON(folder string) (*tile.TileJSON, string, error) {
+	data, err := os.ReadFile(filepath.Join(folder, tile.TileJSONFilename))
+	if err == nil {
+		tileJSON := &tile.TileJSON{}
+		if err := json.Unmarshal(data, tileJSON); err != nil {
+			return nil, "", err
+		}
+		return tileJSON, tile.TileJSONFilename, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, "", err
+	}
+
+	data, err = os.ReadFile(filepath.Join(folder, tile.MetadataFilename))
+	if err != nil {
+		return nil, "", err
+	}
+	metadata := tile.Metadata{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, "", err
+	}
+	tileJSON, err := metadata.TileJSON()
+	if err != nil {
+		return nil, "", err
+	}
+	return tileJSON, tile.MetadataFilename, nil
+}
+
+// dirProfile 从 tilemapresource.xml 的坐标系判断切片方案,同时返回其中记录的瓦片大小(未记录时为 0)
+func dirProfile(folder string) (string, int) {
+	data, err := os.ReadFile(filepath.Join(folder, tile.TileMapResourceFilename))
+	if err != nil {
+		return pkgGdal.ProfileMercator, 0
+	}
+	resource := tile.TileMapResource{}
+	if err := xml.Unmarshal(data, &resource); err != nil {
+		return pkgGdal.ProfileMercator, 0
+	}
+	if resource.SRS == "EPSG:4326" {
+		return pkgGdal.ProfileGeodetic, resource.TileFormat.Width
+	}
+	return pkgGdal.ProfileMercator, resource.TileFormat.Width
+}
+
+func (d *DirTileset) Info() TilesetInfo {
+	return d.info
+}
+
+func (d *DirTileset) Tile(z, x, y int) ([]byte, error) {
+	maxX, maxY := d.prof.MaxTile(z)
+	if z < d.info.MinZoom || z > d.info.MaxZoom || x < 0 || y < 0 || x > maxX || y > maxY {
+		return nil, ErrTileNotFound
+	}
+	// 布局按 TMS 瓦片号生成路径
+	_, ty := d.prof.TMSTile(z, x, y)
+	data, err := os.ReadFile(filepath.Join(d.folder, d.layout.Path(z, x, ty, false)))
+	if os.IsNotExist(err) {
+		return nil, ErrTileNotFound
+	}
+	return data, err
+}
+
+func (d *DirTileset) Close() error {
+	return nil
+}
+
+// DynamicTileset 按请求实时渲染源影像
+type DynamicTileset struct {
+	renderer *tile.Renderer
+	info     TilesetInfo
+}
+
+func NewDynamicTileset(name string, renderer *tile.Renderer, minZoom, maxZoom int) *DynamicTileset {
+	if maxZoom == 0 {
+		maxZoom = renderer.NativeZoom()
+	}
+	west, south := renderer.Profile.MetersToLonLat(renderer.Minx, renderer.Miny)
+	east, north := renderer.Profile.MetersToLonLat(renderer.Maxx, renderer.Maxy)
+	if renderer.Profile.Name() == pkgGdal.ProfileMercator {
+		south, north = math.Max(south, -maxMercatorLat), math.Min(north, maxMercatorLat)
+	}
+	return &DynamicTileset{
+		renderer: renderer,
+		info: TilesetInfo{
+			Name:     name,
+			Format:   "png",
+			MinZoom:  minZoom,
+			MaxZoom:  maxZoom,
+			Bounds:   [4]float64{west, south, east, north},
+			TileSize: renderer.TileSize(),
+			Profile:  renderer.Profile.Name(),
+			ModTime:  renderer.ModTime(),
+		},
+	}
+}
+
+func (d *DynamicTileset) Info() TilesetInfo {
+	return d.info
+}
+
+func (d *DynamicTileset) Tile(z, x, y int) ([]byte, error) {
+	return d.renderer.Render(z, x, y, d.info.Format, nil)
+}
+
+// Render 按请求参数渲染
+func (d *DynamicTileset) Render(z, x, y int, format string, options *tile.RenderOptions) ([]byte, error) {
+	return d.renderer.Render(z, x, y, format, options)
+}
+
+// RenderMap 按任意范围渲染,供 WMS GetMap 使用
+func (d *DynamicTileset) RenderMap(epsg int, bbox [4]float64, width, height int, format string, options *tile.RenderOptions) ([]byte, error) {
+	return d.renderer.RenderMap(epsg, bbox, width, height, format, options)
+}
+
+func (d *DynamicTileset) Close() error {
+	d.renderer.Close()
+	return nil
+}
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// WMS 1.1.1 与 1.3.0,只发布可以实时渲染的瓦片集
+const (
+	wmsVersion111 = "1.1.1"
+	wmsVersion130 = "1.3.0"
+)
+
+// wmsCRS 支持的输出坐标系,CRS:84 与 EPSG:4326 相同但轴顺序为经度在前
+var wmsCRS = []struct {
+	Name string
+	EPSG int
+}{
+	{"EPSG:3857", 3857},
+	{"EPSG:900913", 3857},
+	{"EPSG:4326", 4326},
+	{"CRS:84", 4326},
+}
+
+type wmsCapabilities struct {
+	XMLName    xml.Name
+	Xmlns      string        `xml:"xmlns,attr,omitempty"`
+	XmlnsXlink string        `xml:"xmlns:xlink,attr"`
+	Version    string        `xml:"version,attr"`
+	Service    wmsService    `xml:"Service"`
+	Capability wmsCapability `xml:"Capability"`
+}
+
+type wmsService struct {
+	Name           string            `xml:"Name"`
+	Title          string            `xml:"Title"`
+	OnlineResource wmsOnlineResource `xml:"OnlineResource"`
+}
+
+type wmsOnlineResource struct {
+	Type string `xml:"xlink:type,attr"`
+	Href string `xml:"xlink:href,attr"`
+}
+
+type wmsCapability struct {
+	GetCapabilities wmsOperation `xml:"Request>GetCapabilities"`
+	GetMap          wmsOperation `xml:"Request>GetMap"`
+	Exception       []string     `xml:"Exception>Format"`
+	Layer           wmsLayer     `xml:"Layer"`
+}
+
+type wmsOperation struct {
+	Formats []string          `xml:"Format"`
+	Get     wmsOnlineResource `xml:"DCPType>HTTP>Get>OnlineResource"`
+}
+
+type wmsLayer struct {
+	Queryable   *int              `xml:"queryable,attr"`
+	Name        string            `xml:"Name,omitempty"`
+	Title       string            `xml:"Title"`
+	CRS         []string          `xml:"CRS,omitempty"`
+	SRS         []string          `xml:"SRS,omitempty"`
+	Geographic  *wmsGeographicBox `xml:"EX_GeographicBoundingBox"`
+	LatLon      *wmsBoundingBox   `xml:"LatLonBoundingBox"`
+	BoundingBox []wmsBoundingBox  `xml:"BoundingBox"`
+	Layers      []wmsLayer        `xml:"Layer"`
+}
+
+type wmsGeographicBox struct {
+	West  float64 `xml:"westBoundLongitude"`
+	East  float64 `xml:"eastBoundLongitude"`
+	South float64 `xml:"southBoundLatitude"`
+	North float64 `xml:"northBoundLatitude"`
+}
+
+type wmsBoundingBox struct {
+	CRS  string  `xml:"CRS,attr,omitempty"`
+	SRS  string  `xml:"SRS,attr,omitempty"`
+	MinX float64 `xml:"minx,attr"`
+	MinY float64 `xml:"miny,attr"`
+	MaxX float64 `xml:"maxx,attr"`
+	MaxY float64 `xml:"maxy,attr"`
+}
+
+type wmsExceptionReport struct {
+	XMLName   xml.Name
+	Xmlns     string       `xml:"xmlns,attr,omitempty"`
+	Version   string       `xml:"version,attr"`
+	Exception wmsException `xml:"ServiceException"`
+}
+
+type wmsException struct {
+	Code string `xml:"code,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+// mapTilesets layers 中可以通过 WMS 发布的瓦片集
+func (s *Server) mapTilesets(layers []string) ([]string, []MapTileset) {
+	var names []string
+	var tilesets []MapTileset
+	for _, name := range layers {
+		ts, ok := s.Tileset(name)
+		if !ok {
+			continue
+		}
+		if m, ok := ts.(MapTileset); ok {
+			names = append(names, name)
+			tilesets = append(tilesets, m)
+		}
+	}
+	return names, tilesets
+}
+
+// WMSCapabilities 生成 1.1.1 或 1.3.0 的 GetCapabilities 文档,layers 中每个实时渲染的瓦片集为一个图层
+func (s *Server) WMSCapabilities(baseURL, version string, layers []string) ([]byte, error) {
+	v130 := version == wmsVersion130
+	resource := wmsOnlineResource{Type: "simple", Href: baseURL + "/wms?"}
+	caps := wmsCapabilities{
+		XmlnsXlink: "http://www.w3.org/1999/xlink",
+		Version:    version,
+		Service:    wmsService{Name: "OGC:WMS", Title: "tile_server", OnlineResource: resource},
+		Capability: wmsCapability{
+			GetCapabilities: wmsOperation{Formats: []string{"application/vnd.ogc.wms_xml"}, Get: resource},
+			GetMap:          wmsOperation{Formats: []string{"image/png", "image/jpeg"}, Get: resource},
+			Exception:       []string{"application/vnd.ogc.se_xml"},
+			Layer:           wmsLayer{Title: "tile_server"},
+		},
+	}
+	if v130 {
+		caps.XMLName = xml.Name{Local: "WMS_Capabilities"}
+		caps.Xmlns = "http://www.opengis.net/wms"
+		caps.Service.Name = "WMS"
+		caps.Capability.GetCapabilities.Formats = []string{"text/xml"}
+		caps.Capability.Exception = []string{"XML"}
+	} else {
+		caps.XMLName = xml.Name{Local: "WMT_MS_Capabilities"}
+	}
+
+	var crs []string
+	for _, c := range wmsCRS {
+		if c.Name != "CRS:84" || v130 {
+			crs = append(crs, c.Name)
+		}
+	}
+	if v130 {
+		caps.Capability.Layer.CRS = crs
+	} else {
+		caps.Capability.Layer.SRS = crs
+	}
+
+	mercator := pkgGdal.NewMercator()
+	names, tilesets := s.mapTilesets(layers)
+	for i, ts := range tilesets {
+		info := ts.Info()
+		west, south, east, north := info.Bounds[0], info.Bounds[1], info.Bounds[2], info.Bounds[3]
+		minx, miny := mercator.LonLatToMeters(west, math.Max(south, -maxMercatorLat))
+		maxx, maxy := mercator.LonLatToMeters(east, math.Min(north, maxMercatorLat))
+		queryable := 0
+		layer := wmsLayer{Queryable: &queryable, Name: names[i], Title: info.Name}
+		if v130 {
+			layer.Geographic = &wmsGeographicBox{West: west, East: east, South: south, North: north}
+			layer.BoundingBox = []wmsBoundingBox{
+				{CRS: "CRS:84", MinX: west, MinY: south, MaxX: east, MaxY: north},
+				// 1.3.0 中 EPSG:4326 的轴顺序为纬度在前
+				{CRS: "EPSG:4326", MinX: south, MinY: west, MaxX: north, MaxY: east},
+				{CRS: "EPSG:3857", MinX: minx, MinY: miny, MaxX: maxx, MaxY: maxy},
+			}
+		} else {
+			layer.LatLon = &wmsBoundingBox{MinX: west, MinY: south, MaxX: east, MaxY: north}
+			layer.BoundingBox = []wmsBoundingBox{
+				{SRS: "EPSG:4326", MinX: west, MinY: south, MaxX: east, MaxY: north},
+				{SRS: "EPSG:3857", MinX: minx, MinY: miny, MaxX: maxx, MaxY: maxy},
+			}
+		}
+		caps.Capability.Layer.Layers = append(caps.Capability.Layer.Layers, layer)
+	}
+
+	data, err := xml.MarshalIndent(caps, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// handleWMS /wms?SERVICE=WMS&REQUEST=GetCapabilities|GetMap
+// GetMap 同样支持 bidx、rescale、colormap_name、nodata、resampling、return_mask 渲染参数
+func (s *Server) handleWMS(w http.ResponseWriter, r *http.Request) {
+	params := kvpParams(r)
+	version := wmsNegotiate(params["version"])
+	if service := params["service"]; service != "" && !strings.EqualFold(service, "WMS") {
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidParameterValue", "service must be WMS")
+		return
+	}
+	switch strings.ToLower(params["request"]) {
+	case "getcapabilities", "capabilities":
+		data, err := s.WMSCapabilities(baseURL(r), version, s.visibleTilesetNames(r))
+		if err != nil {
+			writeWMSException(w, version, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		if version == wmsVersion130 {
+			w.Header().Set("Content-Type", "text/xml")
+		} else {
+			w.Header().Set("Content-Type", "application/vnd.ogc.wms_xml")
+		}
+		_, _ = w.Write(data)
+	case "getmap", "map":
+		s.wmsGetMap(w, r, params, version)
+	case "":
+		writeWMSException(w, version, http.StatusBadRequest, "MissingParameterValue", "request is required")
+	default:
+		writeWMSException(w, version, http.StatusBadRequest, "OperationNotSupported", "request must be GetCapabilities or GetMap")
+	}
+}
+
+// wmsNegotiate 低于 1.3.0 的版本按 1.1.1 响应,未指定时使用 1.3.0
+func wmsNegotiate(version string) string {
+	if version != "" && version < wmsVersion130 {
+		return wmsVersion111
+	}
+	return wmsVersion130
+}
+
+func (s *Server) wmsGetMap(w http.ResponseWriter, r *http.Request, params map[string]string, version string) {
+	crsKey, crsCode := "crs", "InvalidCRS"
+	if version == wmsVersion111 {
+		crsKey, crsCode = "srs", "InvalidSRS"
+	}
+	for _, key := range []string{"layers", crsKey, "bbox", "width", "height", "format"} {
+		if params[key] == "" {
+			writeWMSException(w, version, http.StatusBadRequest, "MissingParameterValue", key+" is required")
+			return
+		}
+	}
+
+	layers := strings.Split(params["layers"], ",")
+	if len(layers) != 1 {
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidParameterValue", "only one layer per GetMap request is supported")
+		return
+	}
+	ts, release, ok := s.acquireTileset(layers[0])
+	if !ok {
+		writeWMSException(w, version, http.StatusBadRequest, "LayerNotDefined", "unknown layer "+layers[0])
+		return
+	}
+	defer release()
+	mapTileset, isMap := ts.(MapTileset)
+	if !isMap {
+		writeWMSException(w, version, http.StatusBadRequest, "LayerNotDefined", "unknown layer "+layers[0])
+		return
+	}
+
+	epsg := 0
+	crs := strings.ToUpper(params[crsKey])
+	for _, c := range wmsCRS {
+		if c.Name == crs {
+			epsg = c.EPSG
+		}
+	}
+	if epsg == 0 {
+		writeWMSException(w, version, http.StatusBadRequest, crsCode, "unsupported "+crsKey+" "+params[crsKey])
+		return
+	}
+
+	var bbox [4]float64
+	values := strings.Split(params["bbox"], ",")
+	if len(values) != 4 {
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidParameterValue", pkgGdal.ErrMapBBox.Error())
+		return
+	}
+	for i, v := range values {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			writeWMSException(w, version, http.StatusBadRequest, "InvalidParameterValue", pkgGdal.ErrMapBBox.Error())
+			return
+		}
+		bbox[i] = f
+	}
+	if version == wmsVersion130 && crs == "EPSG:4326" {
+		// 1.3.0 的 EPSG:4326 为纬度在前,warp 按经度在前
+		bbox = [4]float64{bbox[1], bbox[0], bbox[3], bbox[2]}
+	}
+
+	width, errW := strconv.Atoi(params["width"])
+	height, errH := strconv.Atoi(params["height"])
+	if errW != nil || errH != nil {
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidParameterValue", pkgGdal.ErrMapSize.Error())
+		return
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(params["format"]), "image/")
+	if format == "jpeg" {
+		format = "jpg"
+	}
+	if format != "png" && format != "jpg" {
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidFormat", "format must be image/png or image/jpeg")
+		return
+	}
+
+	options, err := tile.ParseRenderOptions(r.URL.Query())
+	if err != nil {
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidParameterValue", err.Error())
+		return
+	}
+	if r.URL.Query().Get("return_mask") == "" {
+		// WMS 默认不透明,TRANSPARENT=TRUE 时输出 alpha
+		options.ReturnMask = strings.EqualFold(params["transparent"], "true")
+	}
+
+	data, err := mapTileset.RenderMap(epsg, bbox, width, height, format, options)
+	switch {
+	case errors.Is(err, pkgGdal.ErrMapSize), errors.Is(err, pkgGdal.ErrMapBBox),
+		errors.Is(err, pkgGdal.ErrBandIndex), errors.Is(err, pkgGdal.ErrColormap):
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidParameterValue", err.Error())
+		return
+	case errors.Is(err, pkgGdal.ErrTileFormat):
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidFormat", err.Error())
+		return
+	case err != nil:
+		log.Printf("渲染 WMS 图片失败:%s", err)
+		writeWMSException(w, version, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", tile.ContentType(format))
+	_, _ = w.Write(data)
+}
+
+func writeWMSException(w http.ResponseWriter, version string, status int, code, text string) {
+	report := wmsExceptionReport{
+		XMLName:   xml.Name{Local: "ServiceExceptionReport"},
+		Version:   version,
+		Exception: wmsException{Code: code, Text: text},
+	}
+	contentType := "application/vnd.ogc.se_xml"
+	if version == wmsVersion130 {
+		report.Xmlns = "http://www.opengis.net/ogc"
+		contentType = "text/xml"
+	}
+	data, _ := xml.MarshalIndent(report, "", "  ")
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, _ = w.Write(append([]byte(xml.Header), data...))
+}
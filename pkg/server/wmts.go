@@ -0,0 +1,393 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// WMTS 1.0.0 http://www.opengis.net/wmts/1.0,同时支持 KVP 和 RESTful 两种请求方式
+const (
+	wmtsVersion    = "1.0.0"
+	wmtsCapsPath   = "/wmts/1.0.0/WMTSCapabilities.xml"
+	wmtsRESTPrefix = "/wmts/1.0.0/"
+)
+
+type wmtsCapabilities struct {
+	XMLName            xml.Name            `xml:"Capabilities"`
+	Xmlns              string              `xml:"xmlns,attr"`
+	XmlnsOws           string              `xml:"xmlns:ows,attr"`
+	XmlnsXlink         string              `xml:"xmlns:xlink,attr"`
+	Version            string              `xml:"version,attr"`
+	Title              string              `xml:"ows:ServiceIdentification>ows:Title"`
+	ServiceType        string              `xml:"ows:ServiceIdentification>ows:ServiceType"`
+	ServiceTypeVersion string              `xml:"ows:ServiceIdentification>ows:ServiceTypeVersion"`
+	Operations         []wmtsOperation     `xml:"ows:OperationsMetadata>ows:Operation"`
+	Layers             []wmtsLayer         `xml:"Contents>Layer"`
+	TileMatrixSets     []wmtsTileMatrixSet `xml:"Contents>TileMatrixSet"`
+	ServiceMetadataURL wmtsServiceMetadata `xml:"ServiceMetadataURL"`
+}
+
+type wmtsOperation struct {
+	Name string       `xml:"name,attr"`
+	Gets []wmtsGetDCP `xml:"ows:DCP>ows:HTTP>ows:Get"`
+}
+
+type wmtsGetDCP struct {
+	Href     string `xml:"xlink:href,attr"`
+	Encoding string `xml:"ows:Constraint>ows:AllowedValues>ows:Value"`
+}
+
+type wmtsLayer struct {
+	Title             string             `xml:"ows:Title"`
+	Identifier        string             `xml:"ows:Identifier"`
+	LowerCorner       string             `xml:"ows:WGS84BoundingBox>ows:LowerCorner"`
+	UpperCorner       string             `xml:"ows:WGS84BoundingBox>ows:UpperCorner"`
+	Style             wmtsStyle          `xml:"Style"`
+	Format            string             `xml:"Format"`
+	TileMatrixSetLink wmtsTileMatrixLink `xml:"TileMatrixSetLink"`
+	ResourceURL       wmtsResourceURL    `xml:"ResourceURL"`
+}
+
+type wmtsStyle struct {
+	IsDefault  bool   `xml:"isDefault,attr"`
+	Identifier string `xml:"ows:Identifier"`
+}
+
+type wmtsTileMatrixLink struct {
+	TileMatrixSet string             `xml:"TileMatrixSet"`
+	Limits        []wmtsMatrixLimits `xml:"TileMatrixSetLimits>TileMatrixLimits"`
+}
+
+type wmtsMatrixLimits struct {
+	TileMatrix string `xml:"TileMatrix"`
+	MinTileRow int    `xml:"MinTileRow"`
+	MaxTileRow int    `xml:"MaxTileRow"`
+	MinTileCol int    `xml:"MinTileCol"`
+	MaxTileCol int    `xml:"MaxTileCol"`
+}
+
+type wmtsResourceURL struct {
+	Format       string `xml:"format,attr"`
+	ResourceType string `xml:"resourceType,attr"`
+	Template     string `xml:"template,attr"`
+}
+
+type wmtsTileMatrixSet struct {
+	Identifier        string           `xml:"ows:Identifier"`
+	SupportedCRS      string           `xml:"ows:SupportedCRS"`
+	WellKnownScaleSet string           `xml:"WellKnownScaleSet,omitempty"`
+	TileMatrix        []wmtsTileMatrix `xml:"TileMatrix"`
+}
+
+type wmtsTileMatrix struct {
+	Identifier       string  `xml:"ows:Identifier"`
+	ScaleDenominator float64 `xml:"ScaleDenominator"`
+	TopLeftCorner    string  `xml:"TopLeftCorner"`
+	TileWidth        int     `xml:"TileWidth"`
+	TileHeight       int     `xml:"TileHeight"`
+	MatrixWidth      int     `xml:"MatrixWidth"`
+	MatrixHeight     int     `xml:"MatrixHeight"`
+}
+
+type wmtsServiceMetadata struct {
+	Href string `xml:"xlink:href,attr"`
+}
+
+type owsExceptionReport struct {
+	XMLName   xml.Name     `xml:"ows:ExceptionReport"`
+	XmlnsOws  string       `xml:"xmlns:ows,attr"`
+	Version   string       `xml:"version,attr"`
+	Exception owsException `xml:"ows:Exception"`
+}
+
+type owsException struct {
+	Code    string `xml:"exceptionCode,attr"`
+	Locator string `xml:"locator,attr,omitempty"`
+	Text    string `xml:"ows:ExceptionText"`
+}
+
+// WMTSCapabilities 根据 layers 中各瓦片集的层级、范围和瓦片矩阵集生成 GetCapabilities 文档
+func (s *Server) WMTSCapabilities(baseURL string, layers []string) ([]byte, error) {
+	caps := wmtsCapabilities{
+		Xmlns:              "http://www.opengis.net/wmts/1.0",
+		XmlnsOws:           "http://www.opengis.net/ows/1.1",
+		XmlnsXlink:         "http://www.w3.org/1999/xlink",
+		Version:            wmtsVersion,
+		Title:              "tile_server",
+		ServiceType:        "OGC WMTS",
+		ServiceTypeVersion: wmtsVersion,
+		ServiceMetadataURL: wmtsServiceMetadata{Href: baseURL + wmtsCapsPath},
+	}
+	for _, operation := range []string{"GetCapabilities", "GetTile"} {
+		caps.Operations = append(caps.Operations, wmtsOperation{
+			Name: operation,
+			Gets: []wmtsGetDCP{
+				{Href: baseURL + "/wmts?", Encoding: "KVP"},
+				{Href: baseURL + wmtsRESTPrefix, Encoding: "RESTful"},
+			},
+		})
+	}
+
+	// 每个瓦片矩阵集取所有引用它的图层的最大层级
+	matrixSets := make(map[string]*TileMatrixSet)
+	maxZooms := make(map[string]int)
+	var order []string
+	for _, name := range layers {
+		ts, ok := s.Tileset(name)
+		if !ok {
+			continue
+		}
+		info := ts.Info()
+		tms, err := NewTileMatrixSet(info.Profile, info.TileSize)
+		if err != nil {
+			return nil, err
+		}
+		id := tms.id()
+		if _, ok := matrixSets[id]; !ok {
+			matrixSets[id] = tms
+			order = append(order, id)
+		}
+		maxZooms[id] = max(maxZooms[id], info.MaxZoom)
+
+		layer := wmtsLayer{
+			Title:             info.Name,
+			Identifier:        name,
+			LowerCorner:       fmt.Sprintf("%g %g", info.Bounds[0], info.Bounds[1]),
+			UpperCorner:       fmt.Sprintf("%g %g", info.Bounds[2], info.Bounds[3]),
+			Style:             wmtsStyle{IsDefault: true, Identifier: "default"},
+			Format:            tile.ContentType(info.Format),
+			TileMatrixSetLink: wmtsTileMatrixLink{TileMatrixSet: id},
+			ResourceURL: wmtsResourceURL{
+				Format:       tile.ContentType(info.Format),
+				ResourceType: "tile",
+				Template:     fmt.Sprintf("%s%s%s/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.%s", baseURL, wmtsRESTPrefix, name, info.Format),
+			},
+		}
+		for z := info.MinZoom; z <= info.MaxZoom; z++ {
+			minCol, minRow, maxCol, maxRow := tms.TileLimits(z, info.Bounds)
+			layer.TileMatrixSetLink.Limits = append(layer.TileMatrixSetLink.Limits, wmtsMatrixLimits{
+				TileMatrix: fmt.Sprint(z),
+				MinTileRow: minRow,
+				MaxTileRow: maxRow,
+				MinTileCol: minCol,
+				MaxTileCol: maxCol,
+			})
+		}
+		caps.Layers = append(caps.Layers, layer)
+	}
+
+	for _, id := range order {
+		tms := matrixSets[id]
+		set := wmtsTileMatrixSet{
+			Identifier:        id,
+			SupportedCRS:      tms.URN(),
+			WellKnownScaleSet: tms.wellKnownScaleSetURN(),
+		}
+		for _, m := range tms.Matrices(maxZooms[id]) {
+			set.TileMatrix = append(set.TileMatrix, wmtsTileMatrix{
+				Identifier:       m.ID,
+				ScaleDenominator: m.ScaleDenominator,
+				TopLeftCorner:    fmt.Sprintf("%.10f %.10f", m.TopLeft[0], m.TopLeft[1]),
+				TileWidth:        m.TileWidth,
+				TileHeight:       m.TileHeight,
+				MatrixWidth:      m.MatrixWidth,
+				MatrixHeight:     m.MatrixHeight,
+			})
+		}
+		caps.TileMatrixSets = append(caps.TileMatrixSets, set)
+	}
+
+	data, err := xml.MarshalIndent(caps, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// id WMTS 中的矩阵集标识,非 256 的瓦片大小单独命名
+func (t *TileMatrixSet) id() string {
+	if t.TileSize == 256 {
+		return t.ID
+	}
+	return fmt.Sprintf("%s%d", t.ID, t.TileSize)
+}
+
+func (t *TileMatrixSet) wellKnownScaleSetURN() string {
+	if t.WellKnownScaleSet == "" || t.TileSize != 256 {
+		return ""
+	}
+	return "urn:ogc:def:wkss:OGC:1.0:GoogleMapsCompatible"
+}
+
+// handleWMTS KVP 方式 /wmts?SERVICE=WMTS&REQUEST=GetCapabilities|GetTile
+func (s *Server) handleWMTS(w http.ResponseWriter, r *http.Request) {
+	params := kvpParams(r)
+	if service := params["service"]; service != "" && !strings.EqualFold(service, "WMTS") {
+		writeOWSException(w, http.StatusBadRequest, "InvalidParameterValue", "service", "service must be WMTS")
+		return
+	}
+	switch strings.ToLower(params["request"]) {
+	case "getcapabilities":
+		s.writeWMTSCapabilities(w, r)
+	case "gettile":
+		for _, key := range []string{"layer", "tilematrixset", "tilematrix", "tilerow", "tilecol"} {
+			if params[key] == "" {
+				writeOWSException(w, http.StatusBadRequest, "MissingParameterValue", key, key+" is required")
+				return
+			}
+		}
+		format := "png"
+		if f := params["format"]; f != "" {
+			format = strings.TrimPrefix(strings.ToLower(f), "image/")
+		}
+		s.wmtsTile(w, r, params["layer"], params["tilematrixset"], params["tilematrix"], params["tilerow"], params["tilecol"], format)
+	case "":
+		writeOWSException(w, http.StatusBadRequest, "MissingParameterValue", "request", "request is required")
+	default:
+		writeOWSException(w, http.StatusBadRequest, "OperationNotSupported", "request", "request must be GetCapabilities or GetTile")
+	}
+}
+
+// handleWMTSRest RESTful 方式
+// /wmts/1.0.0/WMTSCapabilities.xml
+// /wmts/1.0.0/{layer}/{style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.{format}
+func (s *Server) handleWMTSRest(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == wmtsCapsPath {
+		s.writeWMTSCapabilities(w, r)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, wmtsRESTPrefix), "/")
+	if len(parts) != 6 {
+		http.NotFound(w, r)
+		return
+	}
+	col, format, _ := strings.Cut(parts[5], ".")
+	if format == "" {
+		format = "png"
+	}
+	s.wmtsTile(w, r, parts[0], parts[2], parts[3], parts[4], col, format)
+}
+
+func (s *Server) writeWMTSCapabilities(w http.ResponseWriter, r *http.Request) {
+	data, err := s.WMTSCapabilities(baseURL(r), s.visibleTilesetNames(r))
+	if err != nil {
+		writeOWSException(w, http.StatusInternalServerError, "NoApplicableCode", "", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(data)
+}
+
+func (s *Server) wmtsTile(w http.ResponseWriter, r *http.Request, layer, matrixSet, matrix, row, col, format string) {
+	ts, release, ok := s.acquireTileset(layer)
+	if !ok {
+		writeOWSException(w, http.StatusBadRequest, "InvalidParameterValue", "layer", "unknown layer "+layer)
+		return
+	}
+	defer release()
+	info := ts.Info()
+	tms, err := NewTileMatrixSet(info.Profile, info.TileSize)
+	if err != nil || tms.id() != matrixSet {
+		writeOWSException(w, http.StatusBadRequest, "InvalidParameterValue", "tilematrixset", "unknown tile matrix set "+matrixSet)
+		return
+	}
+	if !sameFormat(format, info.Format) {
+		writeOWSException(w, http.StatusBadRequest, "InvalidParameterValue", "format", "layer format is "+tile.ContentType(info.Format))
+		return
+	}
+	z, errZ := strconv.Atoi(matrix)
+	y, errY := strconv.Atoi(row)
+	x, errX := strconv.Atoi(col)
+	if errZ != nil || errY != nil || errX != nil {
+		writeOWSException(w, http.StatusBadRequest, "InvalidParameterValue", "tilematrix", "tile matrix, row and col must be integers")
+		return
+	}
+	minCol, minRow, maxCol, maxRow := tms.TileLimits(z, info.Bounds)
+	if z < info.MinZoom || z > info.MaxZoom || x < minCol || x > maxCol || y < minRow || y > maxRow {
+		writeOWSException(w, http.StatusBadRequest, "TileOutOfRange", "tilerow", "tile is outside the layer limits")
+		return
+	}
+
+	data, err := s.readTile(layer, ts, z, x, y)
+	s.writeLayerTile(w, r, layer, z, info, data, info.Format, err)
+}
+
+type kvpContext struct{}
+
+// kvpSingleKeys 只能出现一次的参数,重复时无法确定访问的图层
+var kvpSingleKeys = map[string]bool{"layer": true, "layers": true}
+
+// parseKVP OGC 的 KVP 参数名不区分大小写,同一参数有大小写不同的写法或 layer/layers 重复时返回错误
+func parseKVP(query url.Values) (map[string]string, error) {
+	params := make(map[string]string, len(query))
+	keys := make(map[string]string, len(query))
+	for key, values := range query {
+		lower := strings.ToLower(key)
+		if other, ok := keys[lower]; ok {
+			return nil, fmt.Errorf("%w: %s, %s", ErrDuplicateParam, other, key)
+		}
+		keys[lower] = key
+		if len(values) > 1 && kvpSingleKeys[lower] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateParam, key)
+		}
+		if len(values) > 0 {
+			params[lower] = values[0]
+		}
+	}
+	return params, nil
+}
+
+// kvp 解析 /wmts 和 /wms 的 KVP 参数放入请求上下文,密钥校验和接口读取同一份参数
+func (s *Server) kvp() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/wmts" && r.URL.Path != "/wms" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			params, err := parseKVP(r.URL.Query())
+			if err != nil {
+				s.reject(w, r, http.StatusBadRequest, "duplicate_parameter", "error", err.Error())
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), kvpContext{}, params)))
+		})
+	}
+}
+
+// kvpParams kvp 中间件解析的参数
+func kvpParams(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(kvpContext{}).(map[string]string)
+	return params
+}
+
+// baseURL 生成能力文档中的服务地址,支持反向代理的 X-Forwarded-Proto
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+func writeOWSException(w http.ResponseWriter, status int, code, locator, text string) {
+	report := owsExceptionReport{
+		XmlnsOws:  "http://www.opengis.net/ows/1.1",
+		Version:   "2.0.0",
+		Exception: owsException{Code: code, Locator: locator, Text: text},
+	}
+	data, _ := xml.MarshalIndent(report, "", "  ")
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/server"
+)
+
+func TestParseTilePath(t *testing.T) {
+	z, x, y, format, err := server.ParseTilePath("/12/3423/1763.png")
+	if err != nil || z != 12 || x != 3423 || y != 1763 || format != "png" {
+		t.Errorf("ParseTilePath = %d %d %d %s %v", z, x, y, format, err)
+	}
+	if _, _, _, format, err := server.ParseTilePath("3/1/2"); err != nil || format != "" {
+		t.Errorf("ParseTilePath without format = %s %v", format, err)
+	}
+	for _, path := range []string{"", "1/2", "1/2/3/4.png", "a/1/2.png", "1/-1/2.png"} {
+		if _, _, _, _, err := server.ParseTilePath(path); err != server.ErrTilePath {
+			t.Errorf("ParseTilePath(%q) err = %v", path, err)
+		}
+	}
+}
+
+func TestServerCOGRequests(t *testing.T) {
+	root := t.TempDir()
+	// data root 内指向外部文件的符号链接
+	if err := os.Symlink("/etc/passwd", filepath.Join(root, "passwd.tif")); err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(server.WithDataRoot(root))
+	defer s.Close()
+
+	for _, c := range []struct {
+		url  string
+		code int
+	}{
+		{"/cog/1/2.png?path=a.tif", http.StatusBadRequest},
+		{"/cog/1/0/0.png?path=../a.tif", http.StatusForbidden},
+		{"/cog/1/0/0.png?path=/etc/passwd", http.StatusForbidden},
+		{"/cog/1/0/0.png?path=passwd.tif", http.StatusForbidden},
+		{"/cog/1/0/0.png", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.url, nil))
+		if rec.Code != c.code {
+			t.Errorf("GET %s = %d, want %d", c.url, rec.Code, c.code)
+		}
+	}
+}
+
+// 未设置 data root 时 /cog 不能读取任意文件
+func TestServerCOGWithoutDataRoot(t *testing.T) {
+	s := server.New()
+	defer s.Close()
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cog/1/0/0.png?path=/etc/passwd", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET /cog without data root = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
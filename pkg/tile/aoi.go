@@ -0,0 +1,155 @@
+package tile
+
+import (
+	"math"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// AreaOfInterest 按层级限定生成范围
+// Bbox 为经纬度 minx,miny,maxx,maxy,Filename 为 GeoJSON/Shapefile,都为空时表示整幅影像
+type AreaOfInterest struct {
+	ZoomMin  int
+	ZoomMax  int
+	Bbox     []float64
+	Filename string
+	polygon  *pkgGdal.Cutline
+}
+
+// Whole 未配置 bbox 和多边形文件,表示整幅影像
+func (a *AreaOfInterest) Whole() bool {
+	return a.Filename == "" && len(a.Bbox) == 0
+}
+
+// Covers 规则是否作用于该层级
+func (a *AreaOfInterest) Covers(z int) bool {
+	return a.ZoomMin <= z && z <= a.ZoomMax
+}
+
+// Validate bbox 必须为 4 个数且 min < max,经纬度不超出范围
+func (a *AreaOfInterest) Validate() error {
+	if a.Filename != "" || len(a.Bbox) == 0 {
+		return nil
+	}
+	if len(a.Bbox) != 4 {
+		return pkgGdal.ErrAreaOfInterest
+	}
+	minx, miny, maxx, maxy := a.Bbox[0], a.Bbox[1], a.Bbox[2], a.Bbox[3]
+	if minx >= maxx || miny >= maxy || minx < -180 || maxx > 180 || miny < -90 || maxy > 90 {
+		return pkgGdal.ErrAreaOfInterest
+	}
+	return nil
+}
+
+// AreasOfInterest 全部兴趣区规则,为空时每个层级都生成整幅影像
+type AreasOfInterest []*AreaOfInterest
+
+// Covering 覆盖该层级的规则
+func (areas AreasOfInterest) Covering(z int) AreasOfInterest {
+	var covering AreasOfInterest
+	for _, aoi := range areas {
+		if aoi.Covers(z) {
+			covering = append(covering, aoi)
+		}
+	}
+	return covering
+}
+
+// WholeRaster 该层级是否生成整幅影像
+func (areas AreasOfInterest) WholeRaster(z int) bool {
+	if len(areas) == 0 {
+		return true
+	}
+	for _, aoi := range areas.Covering(z) {
+		if aoi.Whole() {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFromSource 下一层级的范围与当前层级不同时,当前层级不能由子瓦片合成,直接从源影像读取
+func (areas AreasOfInterest) ReadFromSource(z, zoomMax int) bool {
+	if z >= zoomMax {
+		return true
+	}
+	if areas.WholeRaster(z + 1) {
+		return false
+	}
+	current, child := areas.Covering(z), areas.Covering(z+1)
+	if len(current) != len(child) {
+		return true
+	}
+	for i := range current {
+		if current[i] != child[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// IntersectBounds 两个 minx,miny,maxx,maxy 范围的交集,没有交集时 ok 为 false
+func IntersectBounds(a, b [4]float64) ([4]float64, bool) {
+	out := [4]float64{math.Max(a[0], b[0]), math.Max(a[1], b[1]), math.Min(a[2], b[2]), math.Min(a[3], b[3])}
+	return out, out[0] < out[2] && out[1] < out[3]
+}
+
+// loadAreaOfInterest 读取各规则的多边形,统一转换到切片方案的坐标系
+func (tile *Tile) loadAreaOfInterest() error {
+	for _, aoi := range tile.aoi {
+		if err := aoi.Validate(); err != nil {
+			return err
+		}
+		var err error
+		switch {
+		case aoi.Filename != "":
+			aoi.polygon, err = pkgGdal.NewCutline(aoi.Filename, tile.Profile.EPSG())
+		case len(aoi.Bbox) == 4:
+			aoi.polygon, err = pkgGdal.NewCutlineFromBBox(aoi.Bbox[0], aoi.Bbox[1], aoi.Bbox[2], aoi.Bbox[3], 4326, tile.Profile.EPSG())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// intersectsAreaOfInterest 瓦片范围(米)是否落在该层级的兴趣区内
+func (tile *Tile) intersectsAreaOfInterest(z int, minx, miny, maxx, maxy float64) bool {
+	if tile.aoi.WholeRaster(z) {
+		return true
+	}
+	for _, aoi := range tile.aoi.Covering(z) {
+		if aoi.polygon.Intersects(minx, miny, maxx, maxy) {
+			return true
+		}
+	}
+	return false
+}
+
+// areaOfInterestBounds 该层级兴趣区与影像范围的交集,没有交集时 ok 为 false
+func (tile *Tile) areaOfInterestBounds(z int, minx, miny, maxx, maxy float64) (float64, float64, float64, float64, bool) {
+	if tile.aoi.WholeRaster(z) {
+		return minx, miny, maxx, maxy, true
+	}
+	areas := tile.aoi.Covering(z)
+	if len(areas) == 0 {
+		return 0, 0, 0, 0, false
+	}
+
+	union := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, aoi := range areas {
+		pminx, pminy, pmaxx, pmaxy := aoi.polygon.Bounds()
+		union = [4]float64{math.Min(union[0], pminx), math.Min(union[1], pminy), math.Max(union[2], pmaxx), math.Max(union[3], pmaxy)}
+	}
+	bounds, ok := IntersectBounds([4]float64{minx, miny, maxx, maxy}, union)
+	return bounds[0], bounds[1], bounds[2], bounds[3], ok
+}
+
+func (tile *Tile) closeAreaOfInterest() {
+	for _, aoi := range tile.aoi {
+		if aoi.polygon != nil {
+			aoi.polygon.Close()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package tile
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+
+	"github.com/pdxrlj/tile_server/pkg/arcgis"
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// ArcGISFolder 切片输出目录下的 ArcGIS 紧凑缓存目录
+const ArcGISFolder = "arcgis"
+
+// WriteArcGIS 切片结束后把瓦片导出为 ArcGIS compact cache v2
+func WriteArcGIS() NextTileOverviewFn {
+	return func(next TileOverviewFn) TileOverviewFn {
+		return func(tile *Tile) error {
+			if !tile.arcgis {
+				return next(tile)
+			}
+			fmt.Printf("导出 ArcGIS 紧凑缓存\n")
+
+			var tiles []arcgis.Tile
+			for z := tile.ZoomMin; z <= tile.ZoomMax; z++ {
+				for _, tileId := range tile.ZoomTileIds[z] {
+					_, row := tile.Profile.GoogleTile(tileId.Z, tileId.X, tileId.Y)
+					tiles = append(tiles, arcgis.Tile{Level: tileId.Z, Row: row, Col: tileId.X, Filename: tileId.Filename})
+				}
+			}
+
+			minx, miny, maxx, maxy := tile.Gdal.GetBoundsByTransform()
+			info, err := arcgis.NewCacheInfo(tile.Profile.EPSG(), tile.tileSize, resolutions(tile.Profile, tile.ZoomMax), minx, miny, maxx, maxy)
+			if err != nil {
+				return err
+			}
+			if err := arcgis.Export(filepath.Join(tile.outFolder, ArcGISFolder), info, tiles); err != nil {
+				return err
+			}
+
+			return next(tile)
+		}
+	}
+}
+
+// ExportArcGISFolder 把已有的瓦片目录按布局解析后导出为 ArcGIS compact cache v2
+func ExportArcGISFolder(tilesFolder, outFolder string, layout *Layout, profile pkgGdal.Profile, tileSize int) error {
+	var tiles []arcgis.Tile
+	maxZoom := 0
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	err := filepath.WalkDir(tilesFolder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(tilesFolder, path)
+		if err != nil {
+			return err
+		}
+		z, x, y, retina, err := layout.Parse(rel)
+		if err != nil || retina {
+			// 跳过元数据、预览页面等非瓦片文件
+			return nil
+		}
+		_, row := profile.GoogleTile(z, x, y)
+		tiles = append(tiles, arcgis.Tile{Level: z, Row: row, Col: x, Filename: path})
+
+		maxZoom = max(maxZoom, z)
+		tminx, tminy, tmaxx, tmaxy := profile.TileMetersBounds(z, x, y)
+		minx, miny = math.Min(minx, tminx), math.Min(miny, tminy)
+		maxx, maxy = math.Max(maxx, tmaxx), math.Max(maxy, tmaxy)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(tiles) == 0 {
+		return fmt.Errorf("no tiles matching layout %s in %s", layout.Template(), tilesFolder)
+	}
+
+	info, err := arcgis.NewCacheInfo(profile.EPSG(), tileSize, resolutions(profile, maxZoom), minx, miny, maxx, maxy)
+	if err != nil {
+		return err
+	}
+	return arcgis.Export(outFolder, info, tiles)
+}
+
+// resolutions 0 级到 maxZoom 的分辨率,ArcGIS 层级号与 zoom 一致
+func resolutions(profile pkgGdal.Profile, maxZoom int) []float64 {
+	res := make([]float64, 0, maxZoom+1)
+	for z := 0; z <= maxZoom; z++ {
+		res = append(res, profile.Resolution(z))
+	}
+	return res
+}
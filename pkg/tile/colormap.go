@@ -0,0 +1,49 @@
+package tile
+
+import (
+	"sort"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// colormapStops 色带的控制点,位置 0-255 之间线性插值
+var colormapStops = map[string][][4]int{
+	"greys":   {{0, 0, 0, 0}, {255, 255, 255, 255}},
+	"viridis": {{0, 68, 1, 84}, {64, 59, 82, 139}, {128, 33, 145, 140}, {191, 94, 201, 98}, {255, 253, 231, 37}},
+	"magma":   {{0, 0, 0, 4}, {64, 81, 18, 124}, {128, 183, 55, 121}, {191, 252, 137, 97}, {255, 252, 253, 191}},
+	"inferno": {{0, 0, 0, 4}, {64, 87, 16, 110}, {128, 188, 55, 84}, {191, 249, 142, 9}, {255, 252, 255, 164}},
+	"jet":     {{0, 0, 0, 128}, {32, 0, 0, 255}, {96, 0, 255, 255}, {160, 255, 255, 0}, {224, 255, 0, 0}, {255, 128, 0, 0}},
+	"terrain": {{0, 51, 51, 153}, {38, 0, 153, 255}, {64, 0, 204, 102}, {128, 255, 255, 153}, {191, 128, 92, 84}, {255, 255, 255, 255}},
+	"rdylgn":  {{0, 165, 0, 38}, {64, 244, 109, 67}, {128, 255, 255, 191}, {191, 102, 189, 99}, {255, 0, 104, 55}},
+}
+
+// ColormapNames 支持的色带名称
+func ColormapNames() []string {
+	names := make([]string, 0, len(colormapStops))
+	for name := range colormapStops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Colormap 256 级 RGB 查找表
+func Colormap(name string) ([256][3]byte, error) {
+	var lut [256][3]byte
+	stops, ok := colormapStops[name]
+	if !ok {
+		return lut, pkgGdal.ErrColormap
+	}
+	for i := 0; i < 256; i++ {
+		s := 1
+		for s < len(stops)-1 && stops[s][0] < i {
+			s++
+		}
+		lo, hi := stops[s-1], stops[s]
+		t := float64(i-lo[0]) / float64(hi[0]-lo[0])
+		for c := 0; c < 3; c++ {
+			lut[i][c] = byte(float64(lo[c+1]) + t*float64(hi[c+1]-lo[c+1]) + 0.5)
+		}
+	}
+	return lut, nil
+}
@@ -0,0 +1,71 @@
+package tile
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/lukeroth/gdal"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// ContentType 瓦片格式对应的 MIME 类型
+func ContentType(format string) string {
+	switch format {
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// EncodeTile 把瓦片数据集编码为 png/jpg,1 波段灰度、2 波段灰度+alpha、3 波段 RGB、4 波段 RGBA
+func EncodeTile(ds gdal.Dataset, format string) ([]byte, error) {
+	width, height := ds.RasterXSize(), ds.RasterYSize()
+	bandCount := ds.RasterCount()
+	bands := make([][]byte, bandCount)
+	for i := range bands {
+		bands[i] = make([]byte, width*height)
+		if err := ds.RasterBand(i+1).IO(gdal.Read, 0, 0, width, height, bands[i], width, height, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+	return encodeBands(bands, width, height, format)
+}
+
+// encodeBands 把按波段存放的像素编码为图片
+func encodeBands(bands [][]byte, width, height int, format string) ([]byte, error) {
+	bandCount := len(bands)
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for p := 0; p < width*height; p++ {
+		c := color.NRGBA{A: 255}
+		switch bandCount {
+		case 1:
+			c.R, c.G, c.B = bands[0][p], bands[0][p], bands[0][p]
+		case 2:
+			c.R, c.G, c.B, c.A = bands[0][p], bands[0][p], bands[0][p], bands[1][p]
+		case 3:
+			c.R, c.G, c.B = bands[0][p], bands[1][p], bands[2][p]
+		default:
+			c.R, c.G, c.B, c.A = bands[0][p], bands[1][p], bands[2][p], bands[3][p]
+		}
+		img.SetNRGBA(p%width, p/width, c)
+	}
+
+	buf := bytes.Buffer{}
+	switch format {
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case "jpg", "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, pkgGdal.ErrTileFormat
+	}
+	return buf.Bytes(), nil
+}
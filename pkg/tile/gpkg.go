@@ -0,0 +1,94 @@
+package tile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pdxrlj/tile_server/pkg/gpkg"
+)
+
+var tableNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// WriteGeoPackage 切片结束后把瓦片写入 {name}.gpkg,矩阵集与切片方案一致(EPSG:3857 / EPSG:4326)
+func WriteGeoPackage() NextTileOverviewFn {
+	return func(next TileOverviewFn) TileOverviewFn {
+		return func(tile *Tile) error {
+			if !tile.gpkg {
+				return next(tile)
+			}
+			filename := filepath.Join(tile.outFolder, tile.Name()+".gpkg")
+			fmt.Printf("导出 GeoPackage:%s\n", filename)
+
+			minx, miny, maxx, maxy := tile.Gdal.GetBoundsByTransform()
+			set := tile.tileMatrixSet()
+			set.ContentsBounds = [4]float64{minx, miny, maxx, maxy}
+			g, err := gpkg.Create(filename, set, tile.tileMatrices())
+			if err != nil {
+				return err
+			}
+
+			for z := tile.ZoomMin; z <= tile.ZoomMax; z++ {
+				for _, tileId := range tile.ZoomTileIds[z] {
+					data, err := os.ReadFile(tileId.Filename)
+					if err != nil {
+						_ = g.Close()
+						return err
+					}
+					// GeoPackage 行号从上往下
+					_, row := tile.Profile.GoogleTile(tileId.Z, tileId.X, tileId.Y)
+					if err := g.WriteTile(tileId.Z, tileId.X, row, data); err != nil {
+						_ = g.Close()
+						return err
+					}
+				}
+			}
+			if err := g.Close(); err != nil {
+				return err
+			}
+
+			return next(tile)
+		}
+	}
+}
+
+// tileMatrixSet 0 级瓦片网格覆盖的范围
+func (tile *Tile) tileMatrixSet() gpkg.TileMatrixSet {
+	originX, originY := tile.Profile.Origin()
+	width, height := tile.Profile.MaxTile(0)
+	size := tile.Profile.Resolution(0) * float64(tile.tileSize)
+
+	table := tableNameInvalid.ReplaceAllString(tile.Name(), "_")
+	if table == "" || (table[0] >= '0' && table[0] <= '9') {
+		table = "tiles_" + table
+	}
+	return gpkg.TileMatrixSet{
+		TableName:  table,
+		Identifier: tile.Name(),
+		SRSID:      tile.Profile.EPSG(),
+		MinX:       originX,
+		MinY:       originY,
+		MaxX:       originX + float64(width+1)*size,
+		MaxY:       originY + float64(height+1)*size,
+	}
+}
+
+// tileMatrices 每个层级的矩阵行列数与分辨率
+func (tile *Tile) tileMatrices() []gpkg.TileMatrix {
+	matrices := make([]gpkg.TileMatrix, 0, tile.ZoomMax-tile.ZoomMin+1)
+	for z := tile.ZoomMin; z <= tile.ZoomMax; z++ {
+		maxX, maxY := tile.Profile.MaxTile(z)
+		res := tile.Profile.Resolution(z)
+		matrices = append(matrices, gpkg.TileMatrix{
+			ZoomLevel:    z,
+			MatrixWidth:  maxX + 1,
+			MatrixHeight: maxY + 1,
+			TileWidth:    tile.tileSize,
+			TileHeight:   tile.tileSize,
+			PixelXSize:   res,
+			PixelYSize:   res,
+		})
+	}
+	return matrices
+}
@@ -0,0 +1,127 @@
+package tile
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const KMLFilename = "doc.kml"
+
+// WriteKML 生成 Google Earth 的 KML super-overlay: doc.kml 链接最小层级瓦片,
+// 每个瓦片的 {y}.kml 通过 Region/Lod 显示自己并链接下一层级的 4 个子瓦片
+func WriteKML() NextTileOverviewFn {
+	return func(next TileOverviewFn) TileOverviewFn {
+		return func(tile *Tile) error {
+			if !tile.kml {
+				return next(tile)
+			}
+			fmt.Printf("写入 KML super-overlay\n")
+
+			for z := tile.ZoomMin; z <= tile.ZoomMax; z++ {
+				for _, tileId := range tile.ZoomTileIds[z] {
+					if err := tile.writeTileKML(tileId); err != nil {
+						return err
+					}
+				}
+			}
+
+			buf := strings.Builder{}
+			kmlHeader(&buf, tile.Name())
+			for _, tileId := range tile.ZoomTileIds[tile.ZoomMin] {
+				tile.kmlNetworkLink(&buf, tile.outFolder, tileId.Z, tileId.X, tileId.Y)
+			}
+			kmlFooter(&buf)
+			if err := tile.writeFile(KMLFilename, []byte(buf.String())); err != nil {
+				return err
+			}
+
+			return next(tile)
+		}
+	}
+}
+
+// kmlFilename 瓦片 KML 与 png 同目录同名
+func (tile *Tile) kmlFilename(z, x, y int) string {
+	png := tile.tileFilename(z, x, y, false)
+	return strings.TrimSuffix(png, filepath.Ext(png)) + ".kml"
+}
+
+func (tile *Tile) writeTileKML(tileId *Id) error {
+	z, x, y := tileId.Z, tileId.X, tileId.Y
+	kmlFilename := tile.kmlFilename(z, x, y)
+	dir := filepath.Dir(kmlFilename)
+	west, south, east, north := tile.Profile.TileLatLonBounds(z, x, y)
+
+	// 最大层级不再隐藏
+	maxLodPixels := 8 * tile.tileSize
+	if z == tile.ZoomMax {
+		maxLodPixels = -1
+	}
+
+	buf := strings.Builder{}
+	kmlHeader(&buf, fmt.Sprintf("%d/%d/%d", z, x, y))
+	kmlRegion(&buf, west, south, east, north, tile.tileSize/2, maxLodPixels)
+	fmt.Fprintf(&buf, `    <GroundOverlay>
+      <drawOrder>%d</drawOrder>
+      <Icon><href>%s</href></Icon>
+      <LatLonBox><north>%.14f</north><south>%.14f</south><east>%.14f</east><west>%.14f</west></LatLonBox>
+    </GroundOverlay>
+`, z, KMLHref(dir, tileId.Filename), north, south, east, west)
+
+	if z < tile.ZoomMax {
+		for cx := 2 * x; cx < 2*x+2; cx++ {
+			for cy := 2 * y; cy < 2*y+2; cy++ {
+				// 只链接实际生成的子瓦片
+				if _, err := os.Stat(tile.tileFilename(z+1, cx, cy, false)); err != nil {
+					continue
+				}
+				tile.kmlNetworkLink(&buf, dir, z+1, cx, cy)
+			}
+		}
+	}
+	kmlFooter(&buf)
+
+	return os.WriteFile(kmlFilename, []byte(buf.String()), 0o644)
+}
+
+// kmlNetworkLink 链接瓦片 KML,进入该瓦片 Region 时加载
+func (tile *Tile) kmlNetworkLink(buf *strings.Builder, dir string, z, x, y int) {
+	west, south, east, north := tile.Profile.TileLatLonBounds(z, x, y)
+	fmt.Fprintf(buf, "    <NetworkLink>\n      <name>%d/%d/%d</name>\n", z, x, y)
+	kmlRegion(buf, west, south, east, north, tile.tileSize/2, -1)
+	fmt.Fprintf(buf, `      <Link><href>%s</href><viewRefreshMode>onRegion</viewRefreshMode></Link>
+    </NetworkLink>
+`, KMLHref(dir, tile.kmlFilename(z, x, y)))
+}
+
+func kmlRegion(buf *strings.Builder, west, south, east, north float64, minLodPixels, maxLodPixels int) {
+	fmt.Fprintf(buf, `    <Region>
+      <LatLonAltBox><north>%.14f</north><south>%.14f</south><east>%.14f</east><west>%.14f</west></LatLonAltBox>
+      <Lod><minLodPixels>%d</minLodPixels><maxLodPixels>%d</maxLodPixels></Lod>
+    </Region>
+`, north, south, east, west, minLodPixels, maxLodPixels)
+}
+
+func kmlHeader(buf *strings.Builder, name string) {
+	fmt.Fprintf(buf, `<?xml version="1.0" encoding="utf-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <name>%s</name>
+`, html.EscapeString(name))
+}
+
+func kmlFooter(buf *strings.Builder) {
+	buf.WriteString("  </Document>\n</kml>\n")
+}
+
+// kmlHref KML 中使用相对路径引用
+func KMLHref(dir, target string) string {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,227 @@
+package tile
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+const (
+	LayoutXYZ     = "{z}/{x}/{y}"
+	LayoutZYX     = "{z}/{y}/{x}"
+	LayoutQuadKey = "{quadkey}"
+	// LayoutArcGIS ArcGIS exploded cache,行号从北往南
+	LayoutArcGIS = "L{z:02}/R{y:hex8}/C{x:hex8}"
+)
+
+var (
+	ErrLayout     = errors.New("invalid tile layout template")
+	ErrLayoutPath = errors.New("tile path does not match layout")
+
+	layoutPlaceholder = regexp.MustCompile(`\{(z|x|y|quadkey)(?::(0\d+|hex\d+))?\}`)
+)
+
+// layoutPresets 布局名称到模板的映射
+var layoutPresets = map[string]string{
+	"":        LayoutXYZ,
+	"xyz":     LayoutXYZ,
+	"zyx":     LayoutZYX,
+	"quadkey": LayoutQuadKey,
+	"arcgis":  LayoutArcGIS,
+}
+
+// Layout 瓦片路径模板,支持 {z} {x} {y} {quadkey},可带格式 {z:02} {y:hex8}
+// 瓦片号按 TMS 传入,scheme 为 xyz 时 {y} 翻转;{quadkey} 和 ArcGIS 布局始终按从北往南计算
+type Layout struct {
+	template string
+	xyz      bool
+	ext      string
+	profile  pkgGdal.Profile
+	mercator *pkgGdal.Mercator
+	pattern  *regexp.Regexp
+	fields   []string
+}
+
+// NewLayout 创建瓦片路径布局,template 可以是预设名称 xyz/zyx/quadkey/arcgis 或自定义模板
+func NewLayout(template, scheme string, profile pkgGdal.Profile) (*Layout, error) {
+	if preset, ok := layoutPresets[template]; ok {
+		template = preset
+	}
+	layout := &Layout{
+		template: template,
+		xyz:      scheme == "xyz" || template == LayoutArcGIS,
+		ext:      "png",
+		profile:  profile,
+		mercator: pkgGdal.NewMercator(),
+	}
+
+	matches := layoutPlaceholder.FindAllStringSubmatchIndex(template, -1)
+	if err := validateLayout(template, matches); err != nil {
+		return nil, err
+	}
+	pattern := strings.Builder{}
+	pattern.WriteString("^")
+	last := 0
+	for _, match := range matches {
+		pattern.WriteString(regexp.QuoteMeta(template[last:match[0]]))
+		name := template[match[2]:match[3]]
+		spec := ""
+		if match[4] >= 0 {
+			spec = template[match[4]:match[5]]
+		}
+		switch {
+		case name == "quadkey":
+			if profile.Name() != pkgGdal.ProfileMercator {
+				return nil, fmt.Errorf("%w: quadkey only supports the mercator profile", ErrLayout)
+			}
+			pattern.WriteString("([0-3]*)")
+		case strings.HasPrefix(spec, "hex"):
+			pattern.WriteString("([0-9a-fA-F]+)")
+		default:
+			pattern.WriteString("([0-9]+)")
+		}
+		layout.fields = append(layout.fields, name+":"+spec)
+		last = match[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	// 只匹配瓦片格式的文件,跳过元数据、KML、预览页面
+	pattern.WriteString(`(@2x)?\.` + regexp.QuoteMeta(layout.ext) + `$`)
+	layout.pattern = regexp.MustCompile(pattern.String())
+	return layout, nil
+}
+
+// validateLayout 模板必须包含 {quadkey},或 {z} {x} {y} 各一次
+func validateLayout(template string, matches [][]int) error {
+	count := make(map[string]int)
+	for _, match := range matches {
+		count[template[match[2]:match[3]]]++
+	}
+	switch {
+	case count["quadkey"] == 1 && len(matches) == 1:
+		return nil
+	case count["quadkey"] == 0 && count["z"] == 1 && count["x"] == 1 && count["y"] == 1:
+		return nil
+	}
+	return fmt.Errorf("%w: %s needs {quadkey} or each of {z} {x} {y} once", ErrLayout, template)
+}
+
+// Template 布局模板,不带扩展名
+func (l *Layout) Template() string {
+	return l.template
+}
+
+// FileTemplate 带扩展名的布局模板
+func (l *Layout) FileTemplate() string {
+	return l.template + "." + l.ext
+}
+
+// Scheme 实际输出的行号方式,{quadkey} 和 ArcGIS 布局始终为 xyz
+func (l *Layout) Scheme() string {
+	if l.xyz || strings.Contains(l.template, "{quadkey}") {
+		return "xyz"
+	}
+	return "tms"
+}
+
+// TileJSONTemplate TileJSON 客户端只认识不带格式的 {z} {x} {y},其余布局返回 false
+func (l *Layout) TileJSONTemplate() (string, bool) {
+	for _, field := range l.fields {
+		if field != "z:" && field != "x:" && field != "y:" {
+			return "", false
+		}
+	}
+	return l.FileTemplate(), true
+}
+
+// Path 瓦片相对路径,retina 瓦片在扩展名前加 @2x
+// z, x, y: TMS 瓦片号
+func (l *Layout) Path(z, x, y int, retina bool) string {
+	tmsY := y
+	if l.xyz {
+		_, y = l.profile.GoogleTile(z, x, y)
+	}
+	path := layoutPlaceholder.ReplaceAllStringFunc(l.template, func(placeholder string) string {
+		match := layoutPlaceholder.FindStringSubmatch(placeholder)
+		switch match[1] {
+		case "z":
+			return formatLayoutValue(z, match[2])
+		case "x":
+			return formatLayoutValue(x, match[2])
+		case "y":
+			return formatLayoutValue(y, match[2])
+		}
+		return l.mercator.QuadKey(z, x, tmsY)
+	})
+	if retina {
+		path += "@2x"
+	}
+	return filepath.FromSlash(path + "." + l.ext)
+}
+
+// Parse 从瓦片相对路径解析出 TMS 瓦片号
+func (l *Layout) Parse(path string) (int, int, int, bool, error) {
+	match := l.pattern.FindStringSubmatch(filepath.ToSlash(path))
+	if match == nil {
+		return 0, 0, 0, false, fmt.Errorf("%w: %s", ErrLayoutPath, path)
+	}
+
+	z, x, y := -1, -1, -1
+	for i, field := range l.fields {
+		name, spec, _ := strings.Cut(field, ":")
+		if name == "quadkey" {
+			qz, qx, qy, err := l.mercator.QuadKeyToTile(match[i+1])
+			if err != nil {
+				return 0, 0, 0, false, err
+			}
+			z, x, y = qz, qx, qy
+			continue
+		}
+		base := 10
+		if strings.HasPrefix(spec, "hex") {
+			base = 16
+		}
+		value, err := strconv.ParseInt(match[i+1], base, 64)
+		if err != nil {
+			return 0, 0, 0, false, fmt.Errorf("%w: %s", ErrLayoutPath, path)
+		}
+		switch name {
+		case "z":
+			z = int(value)
+		case "x":
+			x = int(value)
+		case "y":
+			y = int(value)
+		}
+	}
+	if z < 0 || x < 0 || y < 0 {
+		return 0, 0, 0, false, fmt.Errorf("%w: %s", ErrLayoutPath, path)
+	}
+	if l.xyz && !strings.Contains(l.template, "{quadkey}") {
+		y = l.tmsY(z, y)
+	}
+	retina := match[len(match)-1] != ""
+	return z, x, y, retina, nil
+}
+
+// tmsY XYZ 行号转换为 TMS 行号
+func (l *Layout) tmsY(z, y int) int {
+	_, y = l.profile.TMSTile(z, 0, y)
+	return y
+}
+
+func formatLayoutValue(value int, spec string) string {
+	switch {
+	case strings.HasPrefix(spec, "hex"):
+		width, _ := strconv.Atoi(strings.TrimPrefix(spec, "hex"))
+		return fmt.Sprintf("%0*x", width, value)
+	case spec != "":
+		width, _ := strconv.Atoi(spec)
+		return fmt.Sprintf("%0*d", width, value)
+	}
+	return strconv.Itoa(value)
+}
@@ -0,0 +1,319 @@
+package tile
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+const (
+	TileJSONFilename        = "tilejson.json"
+	TileMapResourceFilename = "tilemapresource.xml"
+	MetadataFilename        = "metadata.json"
+)
+
+// TileJSON TileJSON 3.0.0 https://github.com/mapbox/tilejson-spec/tree/master/3.0.0
+type TileJSON struct {
+	TileJSON    string    `json:"tilejson"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	Attribution string    `json:"attribution,omitempty"`
+	Scheme      string    `json:"scheme"`
+	Tiles       []string  `json:"tiles"`
+	MinZoom     int       `json:"minzoom"`
+	MaxZoom     int       `json:"maxzoom"`
+	Bounds      []float64 `json:"bounds"`
+	Center      []float64 `json:"center"`
+	Format      string    `json:"format,omitempty"`
+	TileSize    int       `json:"tileSize,omitempty"`
+}
+
+// Metadata gdal2tiles / mbtiles 风格的 metadata.json,值均为字符串
+type Metadata struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	Attribution string `json:"attribution"`
+	Type        string `json:"type"`
+	Format      string `json:"format"`
+	Bounds      string `json:"bounds"`
+	Center      string `json:"center"`
+	MinZoom     string `json:"minzoom"`
+	MaxZoom     string `json:"maxzoom"`
+	Scheme      string `json:"scheme"`
+	// Layout 瓦片路径模板,TileJSON 不支持的布局(quadkey、arcgis 等)只能从这里读取
+	Layout string `json:"layout,omitempty"`
+	// TileSize、Profile 切片参数,PMTiles 等不带 tilemapresource.xml 的输出从这里读取
+	TileSize string `json:"tile_size,omitempty"`
+	Profile  string `json:"profile,omitempty"`
+}
+
+// TileMapResource TMS tilemapresource.xml
+type TileMapResource struct {
+	XMLName        xml.Name `xml:"TileMap"`
+	Version        string   `xml:"version,attr"`
+	TileMapService string   `xml:"tilemapservice,attr"`
+	Title          string   `xml:"Title"`
+	Abstract       string   `xml:"Abstract"`
+	SRS            string   `xml:"SRS"`
+	BoundingBox    struct {
+		MinX float64 `xml:"minx,attr"`
+		MinY float64 `xml:"miny,attr"`
+		MaxX float64 `xml:"maxx,attr"`
+		MaxY float64 `xml:"maxy,attr"`
+	} `xml:"BoundingBox"`
+	Origin struct {
+		X float64 `xml:"x,attr"`
+		Y float64 `xml:"y,attr"`
+	} `xml:"Origin"`
+	TileFormat struct {
+		Width     int    `xml:"width,attr"`
+		Height    int    `xml:"height,attr"`
+		MimeType  string `xml:"mime-type,attr"`
+		Extension string `xml:"extension,attr"`
+	} `xml:"TileFormat"`
+	TileSets struct {
+		Profile string    `xml:"profile,attr"`
+		TileSet []TileSet `xml:"TileSet"`
+	} `xml:"TileSets"`
+}
+
+type TileSet struct {
+	Href          string  `xml:"href,attr"`
+	UnitsPerPixel float64 `xml:"units-per-pixel,attr"`
+	Order         int     `xml:"order,attr"`
+}
+
+// MetadataInfo 生成 TileJSON、metadata.json、tilemapresource.xml 需要的切片结果信息
+type MetadataInfo struct {
+	Name string
+	// Scheme 输出的行号方式 tms/xyz
+	Scheme string
+	// Template 瓦片路径模板,不带扩展名
+	Template string
+	MinZoom  int
+	MaxZoom  int
+	TileSize int
+	Profile  pkgGdal.Profile
+	// Bounds 切片方案坐标系下的影像范围 minx, miny, maxx, maxy
+	Bounds [4]float64
+}
+
+// Name 图层名称,取输入文件名
+func (tile *Tile) Name() string {
+	base := filepath.Base(tile.inputFilename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (tile *Tile) metadataInfo() *MetadataInfo {
+	minx, miny, maxx, maxy := tile.Gdal.GetBoundsByTransform()
+	return &MetadataInfo{
+		Name:     tile.Name(),
+		Scheme:   tile.layout.Scheme(),
+		Template: tile.layout.Template(),
+		MinZoom:  tile.ZoomMin,
+		MaxZoom:  tile.ZoomMax,
+		TileSize: tile.tileSize,
+		Profile:  tile.Profile,
+		Bounds:   [4]float64{minx, miny, maxx, maxy},
+	}
+}
+
+// LonLatBounds 影像范围(经纬度) west, south, east, north
+func (tile *Tile) LonLatBounds() (float64, float64, float64, float64) {
+	return tile.metadataInfo().LonLatBounds()
+}
+
+func (tile *Tile) TileJSON() *TileJSON {
+	return tile.metadataInfo().TileJSON()
+}
+
+func (tile *Tile) Metadata() *Metadata {
+	return tile.metadataInfo().Metadata()
+}
+
+func (tile *Tile) TileMapResource() *TileMapResource {
+	return tile.metadataInfo().TileMapResource()
+}
+
+// LonLatBounds 影像范围(经纬度) west, south, east, north,墨卡托方案的纬度限制在 ±85.05
+func (m *MetadataInfo) LonLatBounds() (float64, float64, float64, float64) {
+	west, south := m.Profile.MetersToLonLat(m.Bounds[0], m.Bounds[1])
+	east, north := m.Profile.MetersToLonLat(m.Bounds[2], m.Bounds[3])
+	if m.Profile.Name() == pkgGdal.ProfileMercator {
+		south, north = clampLat(south), clampLat(north)
+	}
+	return west, south, east, north
+}
+
+func (m *MetadataInfo) TileJSON() *TileJSON {
+	west, south, east, north := m.LonLatBounds()
+	return &TileJSON{
+		TileJSON: "3.0.0",
+		Name:     m.Name,
+		Version:  "1.0.0",
+		Scheme:   m.Scheme,
+		Tiles:    []string{m.Template + ".png"},
+		MinZoom:  m.MinZoom,
+		MaxZoom:  m.MaxZoom,
+		Bounds:   []float64{west, south, east, north},
+		Center:   []float64{(west + east) / 2, (south + north) / 2, float64(m.MinZoom)},
+		Format:   "png",
+		TileSize: m.TileSize,
+	}
+}
+
+func (m *MetadataInfo) Metadata() *Metadata {
+	west, south, east, north := m.LonLatBounds()
+	return &Metadata{
+		Name:     m.Name,
+		Version:  "1.0.0",
+		Type:     "overlay",
+		Format:   "png",
+		Bounds:   fmt.Sprintf("%f,%f,%f,%f", west, south, east, north),
+		Center:   fmt.Sprintf("%f,%f,%d", (west+east)/2, (south+north)/2, m.MinZoom),
+		MinZoom:  fmt.Sprint(m.MinZoom),
+		MaxZoom:  fmt.Sprint(m.MaxZoom),
+		Scheme:   m.Scheme,
+		TileSize: fmt.Sprint(m.TileSize),
+		Profile:  m.Profile.Name(),
+	}
+}
+
+// TileMapResource TMS 描述,BoundingBox 和 Origin 为切片方案坐标系;TMS 规范的行号从南往北,
+// 输出为 xyz 行号时 Abstract 中注明
+func (m *MetadataInfo) TileMapResource() *TileMapResource {
+	resource := &TileMapResource{
+		Version:        "1.0.0",
+		TileMapService: "http://tms.osgeo.org/1.0.0",
+		Title:          m.Name,
+		SRS:            fmt.Sprintf("EPSG:%d", m.Profile.EPSG()),
+	}
+	if m.Scheme == "xyz" {
+		resource.Abstract = "tile rows are numbered from the north (xyz scheme)"
+	}
+	resource.BoundingBox.MinX, resource.BoundingBox.MinY = m.Bounds[0], m.Bounds[1]
+	resource.BoundingBox.MaxX, resource.BoundingBox.MaxY = m.Bounds[2], m.Bounds[3]
+	resource.Origin.X, resource.Origin.Y = m.Profile.Origin()
+	resource.TileFormat.Width, resource.TileFormat.Height = m.TileSize, m.TileSize
+	resource.TileFormat.MimeType, resource.TileFormat.Extension = "image/png", "png"
+	resource.TileSets.Profile = "mercator"
+	if m.Profile.Name() == pkgGdal.ProfileGeodetic {
+		resource.TileSets.Profile = "global-geodetic"
+	}
+	for z := m.MinZoom; z <= m.MaxZoom; z++ {
+		resource.TileSets.TileSet = append(resource.TileSets.TileSet, TileSet{
+			Href:          fmt.Sprint(z),
+			UnitsPerPixel: m.Profile.Resolution(z),
+			Order:         z,
+		})
+	}
+	return resource
+}
+
+// WriteMetadata 切片结束后在输出目录写入 tilejson.json、tilemapresource.xml、metadata.json
+func WriteMetadata() NextTileOverviewFn {
+	return func(next TileOverviewFn) TileOverviewFn {
+		return func(tile *Tile) error {
+			fmt.Printf("写入瓦片元数据\n")
+			if _, ok := tile.layout.TileJSONTemplate(); ok {
+				tileJSON, err := json.MarshalIndent(tile.TileJSON(), "", "  ")
+				if err != nil {
+					return err
+				}
+				if err := tile.writeFile(TileJSONFilename, tileJSON); err != nil {
+					return err
+				}
+			} else {
+				fmt.Printf("布局 %s 不是 {z}/{x}/{y} 模板,不写入 %s\n", tile.layout.Template(), TileJSONFilename)
+			}
+
+			info := tile.Metadata()
+			info.Layout = tile.layout.FileTemplate()
+			metadata, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := tile.writeFile(MetadataFilename, metadata); err != nil {
+				return err
+			}
+
+			resource, err := xml.MarshalIndent(tile.TileMapResource(), "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := tile.writeFile(TileMapResourceFilename, append([]byte(xml.Header), resource...)); err != nil {
+				return err
+			}
+
+			return next(tile)
+		}
+	}
+}
+
+// TileJSON 从 metadata.json 还原 TileJSON,tiles 为 layout 模板,TileSize 未记录时为 0
+func (m *Metadata) TileJSON() (*TileJSON, error) {
+	tileJSON := &TileJSON{
+		TileJSON: "3.0.0",
+		Name:     m.Name,
+		Version:  m.Version,
+		Scheme:   m.Scheme,
+		Format:   m.Format,
+	}
+	if m.Layout != "" {
+		tileJSON.Tiles = []string{m.Layout}
+	}
+	var err error
+	if tileJSON.Bounds, err = parseFloats(m.Bounds, 4); err != nil {
+		return nil, fmt.Errorf("metadata bounds %q: %w", m.Bounds, err)
+	}
+	if m.Center != "" {
+		if tileJSON.Center, err = parseFloats(m.Center, 3); err != nil {
+			return nil, fmt.Errorf("metadata center %q: %w", m.Center, err)
+		}
+	}
+	if tileJSON.MinZoom, err = strconv.Atoi(m.MinZoom); err != nil {
+		return nil, fmt.Errorf("metadata minzoom %q: %w", m.MinZoom, err)
+	}
+	if tileJSON.MaxZoom, err = strconv.Atoi(m.MaxZoom); err != nil {
+		return nil, fmt.Errorf("metadata maxzoom %q: %w", m.MaxZoom, err)
+	}
+	return tileJSON, nil
+}
+
+func parseFloats(value string, n int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("want %d numbers", n)
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (tile *Tile) writeFile(name string, data []byte) error {
+	filename := filepath.Join(tile.outFolder, name)
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// clampLat Web 墨卡托的纬度范围
+func clampLat(lat float64) float64 {
+	return math.Max(-85.0511287798066, math.Min(85.0511287798066, lat))
+}
@@ -0,0 +1,104 @@
+package tile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lukeroth/gdal"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// zoomOverview 低层级直接读取的源影像 overview
+type zoomOverview struct {
+	level    int
+	filename string
+	gdal     *pkgGdal.Gdal
+	// 预处理的 COG 与切片共用同一个数据集,不需要单独关闭
+	shared bool
+}
+
+// wrapOptions 重投影 VRT 的 warp 参数
+func (tile *Tile) wrapOptions(options ...pkgGdal.WrapOption) []pkgGdal.WrapOption {
+	return append([]pkgGdal.WrapOption{
+		pkgGdal.WithSrcSRS(tile.srcSRS),
+		pkgGdal.WithGeoreference(tile.georeference),
+		pkgGdal.WithCutline(tile.cutline),
+	}, options...)
+}
+
+// loadOverviews 按层级分辨率选择源影像上最合适的 overview,选中的层级不再由下一层级的瓦片合成
+func (tile *Tile) loadOverviews(src gdal.Dataset) error {
+	tile.overviews = make(map[int]*zoomOverview)
+	// 预处理为重投影后的 COG 时,overview 已经在目标坐标系下,直接由 Read() 按窗口选择
+	if tile.cog == pkgGdal.COGVrt {
+		src = tile.Gdal.Dataset
+	}
+	if src.RasterCount() == 0 {
+		return nil
+	}
+	factors := pkgGdal.OverviewFactors(src.RasterBand(1))
+	if len(factors) == 0 {
+		return nil
+	}
+	res := tile.Gdal.GetGeoTransform()[1]
+
+	byLevel := make(map[int]*zoomOverview)
+	for z := tile.ZoomMin; z < tile.ZoomMax; z++ {
+		level := pkgGdal.SelectOverview(factors, tile.Profile.Resolution(z)/res)
+		if level < 0 {
+			continue
+		}
+		if ov, ok := byLevel[level]; ok {
+			tile.overviews[z] = ov
+			continue
+		}
+
+		ov := &zoomOverview{level: level, filename: tile.tempFileVrt, gdal: tile.Gdal, shared: true}
+		if tile.cog != pkgGdal.COGVrt {
+			vrt, err := pkgGdal.WrapGdalVrt(src, tile.Profile.EPSG(), tile.wrapOptions(pkgGdal.WithOverviewLevel(level))...)
+			if err != nil {
+				return err
+			}
+			vrt.Ds.Close()
+			g, err := pkgGdal.NewGdal(vrt.Filename)
+			if err != nil {
+				_ = os.Remove(vrt.Filename)
+				return err
+			}
+			ov = &zoomOverview{level: level, filename: vrt.Filename, gdal: g.AdvanceCalculate()}
+		}
+		fmt.Printf("当前层级:%d,读取源影像 overview %d(缩小 %.0f 倍)\n", z, level, factors[level])
+		byLevel[level] = ov
+		tile.overviews[z] = ov
+	}
+	return nil
+}
+
+// zoomGdal 计算该层级读取窗口所用的数据集
+func (tile *Tile) zoomGdal(z int) *pkgGdal.Gdal {
+	if ov, ok := tile.overviews[z]; ok {
+		return ov.gdal
+	}
+	return tile.Gdal
+}
+
+// zoomSource 该层级直接读取的数据集文件
+func (tile *Tile) zoomSource(z int) string {
+	if ov, ok := tile.overviews[z]; ok {
+		return ov.filename
+	}
+	return tile.tempFileVrt
+}
+
+func (tile *Tile) closeOverviews() {
+	closed := make(map[*zoomOverview]bool)
+	for _, ov := range tile.overviews {
+		if ov.shared || closed[ov] {
+			continue
+		}
+		closed[ov] = true
+		ov.gdal.Close()
+		_ = os.Remove(ov.filename)
+	}
+}
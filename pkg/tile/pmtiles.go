@@ -0,0 +1,79 @@
+package tile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/pmtiles"
+)
+
+// WritePMTiles 切片结束后把瓦片按 Hilbert 顺序打包为 {name}.pmtiles
+func WritePMTiles() NextTileOverviewFn {
+	return func(next TileOverviewFn) TileOverviewFn {
+		return func(tile *Tile) error {
+			if !tile.pmtiles {
+				return next(tile)
+			}
+			// PMTiles 只支持 Web 墨卡托瓦片
+			if tile.Profile.Name() != pkgGdal.ProfileMercator {
+				fmt.Printf("PMTiles 只支持 mercator 切片方案,跳过导出\n")
+				return next(tile)
+			}
+			filename := filepath.Join(tile.outFolder, tile.Name()+".pmtiles")
+			fmt.Printf("导出 PMTiles:%s\n", filename)
+
+			type pmTile struct {
+				id       uint64
+				filename string
+			}
+			var tiles []pmTile
+			for z := tile.ZoomMin; z <= tile.ZoomMax; z++ {
+				for _, tileId := range tile.ZoomTileIds[z] {
+					x, y := tile.Profile.GoogleTile(tileId.Z, tileId.X, tileId.Y)
+					tiles = append(tiles, pmTile{
+						id:       pmtiles.ZxyToID(uint8(tileId.Z), uint32(x), uint32(y)),
+						filename: tileId.Filename,
+					})
+				}
+			}
+			sort.Slice(tiles, func(i, j int) bool {
+				return tiles[i].id < tiles[j].id
+			})
+
+			tileJSON := tile.TileJSON()
+			writer, err := pmtiles.NewWriter(filename, pmtiles.Header{
+				TileCompression: pmtiles.CompressionNone,
+				TileType:        pmtiles.TileTypePng,
+				MinZoom:         uint8(tile.ZoomMin),
+				MaxZoom:         uint8(tile.ZoomMax),
+				MinLon:          tileJSON.Bounds[0],
+				MinLat:          tileJSON.Bounds[1],
+				MaxLon:          tileJSON.Bounds[2],
+				MaxLat:          tileJSON.Bounds[3],
+				CenterZoom:      uint8(tileJSON.Center[2]),
+				CenterLon:       tileJSON.Center[0],
+				CenterLat:       tileJSON.Center[1],
+			})
+			if err != nil {
+				return err
+			}
+			for _, t := range tiles {
+				data, err := os.ReadFile(t.filename)
+				if err != nil {
+					return err
+				}
+				if err := writer.Add(t.id, data); err != nil {
+					return err
+				}
+			}
+			if err := writer.Close(tile.Metadata()); err != nil {
+				return err
+			}
+
+			return next(tile)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package tile
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lukeroth/gdal"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+// resamplings 请求参数与 GDAL RegenerateOverviews 重采样方式的对应
+var resamplings = map[string]string{
+	"nearest":     "NEAREST",
+	"bilinear":    "BILINEAR",
+	"cubic":       "CUBIC",
+	"cubicspline": "CUBICSPLINE",
+	"lanczos":     "LANCZOS",
+	"average":     "AVERAGE",
+	"mode":        "MODE",
+	"gauss":       "GAUSS",
+}
+
+// renderKeys ParseRenderOptions 识别的参数
+var renderKeys = []string{"bidx", "rescale", "colormap_name", "nodata", "resampling", "return_mask"}
+
+// RenderOptions 实时渲染的请求参数,与 titiler 一致
+type RenderOptions struct {
+	// Bidx 读取的波段,从 1 开始
+	Bidx []int
+	// Rescale 拉伸范围,只有一组时所有波段共用
+	Rescale      [][2]float64
+	ColormapName string
+	Nodata       *float64
+	Resampling   string
+	// ReturnMask 输出 alpha 波段,nodata 像素和瓦片中读取窗口外的部分透明
+	// 重投影 VRT 不带 alpha,窗口内影像边缘外的像素只有源影像带 alpha 或设置了 nodata 时透明
+	ReturnMask bool
+}
+
+// ParseRenderOptions 解析 bidx、rescale、colormap_name、nodata、resampling、return_mask 参数
+func ParseRenderOptions(values url.Values) (*RenderOptions, error) {
+	options := &RenderOptions{ReturnMask: true}
+
+	for _, value := range values["bidx"] {
+		for _, v := range strings.Split(value, ",") {
+			b, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || b < 1 {
+				return nil, pkgGdal.ErrBandIndex
+			}
+			options.Bidx = append(options.Bidx, b)
+		}
+	}
+	for _, value := range values["rescale"] {
+		minValue, maxValue, ok := strings.Cut(value, ",")
+		if !ok {
+			return nil, pkgGdal.ErrRescale
+		}
+		lo, err1 := strconv.ParseFloat(strings.TrimSpace(minValue), 64)
+		hi, err2 := strconv.ParseFloat(strings.TrimSpace(maxValue), 64)
+		if err1 != nil || err2 != nil || lo >= hi {
+			return nil, pkgGdal.ErrRescale
+		}
+		options.Rescale = append(options.Rescale, [2]float64{lo, hi})
+	}
+	if name := strings.ToLower(values.Get("colormap_name")); name != "" {
+		if _, err := Colormap(name); err != nil {
+			return nil, err
+		}
+		options.ColormapName = name
+	}
+	if value := values.Get("nodata"); value != "" {
+		nodata, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, pkgGdal.ErrNodata
+		}
+		options.Nodata = &nodata
+	}
+	if value := strings.ToLower(values.Get("resampling")); value != "" {
+		if _, ok := resamplings[value]; !ok {
+			return nil, pkgGdal.ErrResampling
+		}
+		options.Resampling = value
+	}
+	if value := values.Get("return_mask"); value != "" {
+		returnMask, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, pkgGdal.ErrReturnMask
+		}
+		options.ReturnMask = returnMask
+	}
+	return options, nil
+}
+
+// HasRenderOptions 是否带有渲染参数,api_key、防缓存的 v 等其他参数不影响渲染结果
+func HasRenderOptions(values url.Values) bool {
+	for _, key := range renderKeys {
+		if _, ok := values[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Key 规范化的渲染参数,参数顺序和写法不同但结果相同的请求得到同一个 key,用作缓存 key
+func (o *RenderOptions) Key() string {
+	values := url.Values{}
+	if len(o.Bidx) > 0 {
+		bidx := make([]string, len(o.Bidx))
+		for i, b := range o.Bidx {
+			bidx[i] = strconv.Itoa(b)
+		}
+		values.Set("bidx", strings.Join(bidx, ","))
+	}
+	for _, r := range o.Rescale {
+		values.Add("rescale", strconv.FormatFloat(r[0], 'g', -1, 64)+","+strconv.FormatFloat(r[1], 'g', -1, 64))
+	}
+	if o.ColormapName != "" {
+		values.Set("colormap_name", o.ColormapName)
+	}
+	if o.Nodata != nil {
+		values.Set("nodata", strconv.FormatFloat(*o.Nodata, 'g', -1, 64))
+	}
+	if o.Resampling != "" {
+		values.Set("resampling", o.Resampling)
+	}
+	values.Set("return_mask", strconv.FormatBool(o.ReturnMask))
+	return values.Encode()
+}
+
+// ReadFuncs 在 Read() 前后插入渲染参数对应的中间件,直到 TileToPNG()
+func (o *RenderOptions) ReadFuncs(dataset gdal.Dataset) []NextTileReadFunc {
+	return append(o.bandFuncs(dataset, 0), TileToPNG())
+}
+
+// bandFuncs 读取并处理波段数据,结果留在 imgBuf 中;alphaBand 大于 0 时由该波段得到掩膜
+func (o *RenderOptions) bandFuncs(dataset gdal.Dataset, alphaBand int) []NextTileReadFunc {
+	return []NextTileReadFunc{
+		initTileRead(dataset),
+		SelectBands(o.Bidx, len(o.Rescale) > 0),
+		Resampling(o.Resampling),
+		Read(),
+		NodataMask(o.Nodata),
+		AlphaMask(alphaBand),
+		Rescale(o.Rescale),
+		ColormapBand(o.ColormapName),
+		ReturnMask(o.ReturnMask),
+	}
+}
+
+// SelectBands 设置读取的波段,需要拉伸时按浮点读取原始值
+func SelectBands(bidx []int, readFloat bool) NextTileReadFunc {
+	return func(next ReadFunc) ReadFunc {
+		return func(info *Id) error {
+			info.bands = bidx
+			info.readFloat = readFloat
+			return next(info)
+		}
+	}
+}
+
+// Resampling 设置查询数据集缩放为瓦片时的重采样方式
+func Resampling(resampling string) NextTileReadFunc {
+	return func(next ReadFunc) ReadFunc {
+		return func(info *Id) error {
+			if r, ok := resamplings[resampling]; ok {
+				info.resampling = r
+			}
+			return next(info)
+		}
+	}
+}
+
+// NodataMask 所有波段都等于 nodata 的像素为无效像素;未指定时使用第一个波段的 nodata
+func NodataMask(nodata *float64) NextTileReadFunc {
+	return func(next ReadFunc) ReadFunc {
+		return func(info *Id) error {
+			value, ok := 0.0, false
+			if nodata != nil {
+				value, ok = *nodata, true
+			} else if len(info.imgBuf) > 0 {
+				b := 1
+				if len(info.bands) > 0 {
+					b = info.bands[0]
+				}
+				value, ok = info.dataset.RasterBand(b).NoDataValue()
+			}
+			if !ok {
+				return next(info)
+			}
+
+			size := info.Windows.WxSize * info.Windows.WySize
+			info.mask = make([]byte, size)
+			for p := 0; p < size; p++ {
+				for i := range info.imgBuf {
+					if !isNodata(info.pixel(i, p), value) {
+						info.mask[p] = 255
+						break
+					}
+				}
+			}
+			return next(info)
+		}
+	}
+}
+
+// AlphaMask 读取 warp -dstalpha 追加的 alpha 波段,与 nodata 掩膜合并;band 为 0 时跳过
+func AlphaMask(band int) NextTileReadFunc {
+	return func(next ReadFunc) ReadFunc {
+		return func(info *Id) error {
+			if band == 0 {
+				return next(info)
+			}
+			if band > info.dataset.RasterCount() {
+				return pkgGdal.ErrBandIndex
+			}
+			alphaBand, window := overviewWindow(info.dataset.RasterBand(band), info.Windows)
+			alpha := make([]byte, info.Windows.WxSize*info.Windows.WySize)
+			err := alphaBand.IO(gdal.Read, window.Rx, window.Ry, window.RxSize,
+				window.RySize, alpha, window.WxSize, window.WySize, 0, 0)
+			if err != nil {
+				return err
+			}
+			if info.mask != nil {
+				for p := range alpha {
+					alpha[p] = min(alpha[p], info.mask[p])
+				}
+			}
+			info.mask = alpha
+			return next(info)
+		}
+	}
+}
+
+func isNodata(v, nodata float64) bool {
+	if math.IsNaN(nodata) {
+		return math.IsNaN(v)
+	}
+	return v == nodata
+}
+
+// pixel 第 i 个波段第 p 个像素的数值
+func (t *Id) pixel(i, p int) float64 {
+	if t.values != nil {
+		return float64(t.values[i][p])
+	}
+	return float64(t.imgBuf[i][p])
+}
+
+// Rescale 把原始数值线性拉伸到 0-255
+func Rescale(ranges [][2]float64) NextTileReadFunc {
+	return func(next ReadFunc) ReadFunc {
+		return func(info *Id) error {
+			if info.values == nil {
+				return next(info)
+			}
+			for i, values := range info.values {
+				r := ranges[0]
+				if i < len(ranges) {
+					r = ranges[i]
+				}
+				data := make([]byte, len(values))
+				for p, v := range values {
+					scaled := (float64(v) - r[0]) / (r[1] - r[0]) * 255
+					data[p] = byte(math.Max(0, math.Min(255, math.Round(scaled))))
+				}
+				info.imgBuf[i] = data
+			}
+			info.values = nil
+			return next(info)
+		}
+	}
+}
+
+// ColormapBand 单波段按色带映射为 RGB
+func ColormapBand(name string) NextTileReadFunc {
+	return func(next ReadFunc) ReadFunc {
+		return func(info *Id) error {
+			if name == "" {
+				return next(info)
+			}
+			lut, err := Colormap(name)
+			if err != nil {
+				return err
+			}
+			if len(info.imgBuf) != 1 {
+				return pkgGdal.ErrColormap
+			}
+			gray := info.imgBuf[0]
+			rgb := [][]byte{make([]byte, len(gray)), make([]byte, len(gray)), make([]byte, len(gray))}
+			for p, v := range gray {
+				rgb[0][p], rgb[1][p], rgb[2][p] = lut[v][0], lut[v][1], lut[v][2]
+			}
+			info.imgBuf = rgb
+			return next(info)
+		}
+	}
+}
+
+// ReturnMask 追加 alpha 波段;读取的最后一个波段是 alpha 波段时与掩膜合并
+func ReturnMask(returnMask bool) NextTileReadFunc {
+	return func(next ReadFunc) ReadFunc {
+		return func(info *Id) error {
+			if !returnMask {
+				return next(info)
+			}
+			size := info.Windows.WxSize * info.Windows.WySize
+			mask := info.mask
+			if mask == nil {
+				mask = make([]byte, size)
+				for p := range mask {
+					mask[p] = 255
+				}
+			}
+			if !info.lastBandIsAlpha() {
+				info.imgBuf = append(info.imgBuf, mask)
+				return next(info)
+			}
+			alpha := info.imgBuf[len(info.imgBuf)-1]
+			for p := range alpha {
+				alpha[p] = min(alpha[p], mask[p])
+			}
+			return next(info)
+		}
+	}
+}
+
+// lastBandIsAlpha 读取的最后一个波段的颜色解释是否为 alpha,按波段数判断会把 RGBN 的近红外当作 alpha
+// 色带映射后的 RGB 不对应数据集的波段
+func (t *Id) lastBandIsAlpha() bool {
+	band := len(t.imgBuf)
+	if len(t.bands) > 0 {
+		if len(t.bands) != len(t.imgBuf) {
+			return false
+		}
+		band = t.bands[len(t.bands)-1]
+	} else if band != t.dataset.RasterCount() {
+		return false
+	}
+	return band > 0 && t.dataset.RasterBand(band).ColorInterp() == gdal.CI_AlphaBand
+}
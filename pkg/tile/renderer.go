@@ -0,0 +1,341 @@
+package tile
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lukeroth/gdal"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/metrics"
+)
+
+// MaxMapSize WMS GetMap 输出图片的最大宽高
+const MaxMapSize = 4096
+
+// Renderer 按请求从源影像实时渲染瓦片,复用切片流程的 VRT、读取窗口和 Read()/TileToPNG() 中间件
+type Renderer struct {
+	filename     string
+	modTime      time.Time
+	tileSize     int
+	workers      int
+	profileName  string
+	srcSRS       string
+	georeference string
+	Profile      pkgGdal.Profile
+	vrtFilename  string
+	geoTransform [6]float64
+	width        int
+	height       int
+	// 影像范围,单位为切片方案坐标系
+	Minx, Miny, Maxx, Maxy float64
+	// 每个 worker 独占一个 GDAL 数据集句柄,句柄不能跨 goroutine 共用
+	handles chan *rendererHandle
+}
+
+type rendererHandle struct {
+	dataset gdal.Dataset
+	opened  bool
+	// source 源影像句柄,WMS GetMap 从它按请求范围 warp
+	source       gdal.Dataset
+	sourceOpened bool
+}
+
+type RendererOption func(*Renderer)
+
+func WithRendererTileSize(tileSize int) RendererOption {
+	return func(r *Renderer) {
+		r.tileSize = tileSize
+	}
+}
+
+// WithRendererWorkers 同时渲染的请求数,即打开的 GDAL 句柄数
+func WithRendererWorkers(workers int) RendererOption {
+	return func(r *Renderer) {
+		if workers > 0 {
+			r.workers = workers
+		}
+	}
+}
+
+func WithRendererProfile(profile string) RendererOption {
+	return func(r *Renderer) {
+		r.profileName = profile
+	}
+}
+
+// WithRendererSrcSRS 覆盖源影像坐标系,支持 WKT、PROJ、EPSG
+func WithRendererSrcSRS(srs string) RendererOption {
+	return func(r *Renderer) {
+		r.srcSRS = srs
+	}
+}
+
+// WithRendererGeoreference 地理参考方式 auto/gcp/tps/rpc
+func WithRendererGeoreference(method string) RendererOption {
+	return func(r *Renderer) {
+		r.georeference = method
+	}
+}
+
+func NewRenderer(filename string, options ...RendererOption) (*Renderer, error) {
+	r := &Renderer{
+		filename: filename,
+		tileSize: 256,
+		workers:  4,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	profile, err := pkgGdal.NewProfile(r.profileName, r.tileSize)
+	if err != nil {
+		return nil, err
+	}
+	r.Profile = profile
+	// /vsicurl 等虚拟路径无法 stat,修改时间为零值时不返回 Last-Modified
+	if stat, err := os.Stat(filename); err == nil {
+		r.modTime = stat.ModTime()
+	}
+
+	dataset, err := gdal.Open(filename, gdal.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer dataset.Close()
+	vrt, err := pkgGdal.WrapGdalVrt(dataset, profile.EPSG(), r.wrapOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	vrt.Ds.Close()
+	r.vrtFilename = vrt.Filename
+
+	g, err := pkgGdal.NewGdal(vrt.Filename)
+	if err != nil {
+		_ = os.Remove(vrt.Filename)
+		return nil, err
+	}
+	g.AdvanceCalculate()
+	r.geoTransform, r.width, r.height = g.GetGeoTransform(), g.GetWidth(), g.GetHeight()
+	r.Minx, r.Miny, r.Maxx, r.Maxy = g.GetBoundsByTransform()
+	g.Close()
+
+	r.handles = make(chan *rendererHandle, r.workers)
+	for i := 0; i < r.workers; i++ {
+		r.handles <- &rendererHandle{}
+	}
+	return r, nil
+}
+
+// wrapOptions 瓦片和 WMS GetMap 共用的 warp 参数
+func (r *Renderer) wrapOptions(options ...pkgGdal.WrapOption) []pkgGdal.WrapOption {
+	return append([]pkgGdal.WrapOption{
+		pkgGdal.WithSrcSRS(r.srcSRS),
+		pkgGdal.WithGeoreference(r.georeference),
+	}, options...)
+}
+
+func (r *Renderer) Filename() string {
+	return r.filename
+}
+
+// ModTime 打开时源文件的修改时间,用作瓦片的 Last-Modified
+func (r *Renderer) ModTime() time.Time {
+	return r.modTime
+}
+
+func (r *Renderer) TileSize() int {
+	return r.tileSize
+}
+
+// NativeZoom 分辨率不低于源影像的最小层级
+func (r *Renderer) NativeZoom() int {
+	for z := 0; z < pkgGdal.MaxZoomLevel; z++ {
+		if r.Profile.Resolution(z) <= r.geoTransform[1] {
+			return z
+		}
+	}
+	return pkgGdal.MaxZoomLevel - 1
+}
+
+// acquire 取出一个空闲句柄,首次使用时才打开数据集
+func (r *Renderer) acquire() (*rendererHandle, error) {
+	handle := <-r.handles
+	if !handle.opened {
+		dataset, err := gdal.Open(r.vrtFilename, gdal.ReadOnly)
+		if err != nil {
+			r.handles <- handle
+			return nil, err
+		}
+		handle.dataset, handle.opened = dataset, true
+	}
+	metrics.GDALHandles.Inc()
+	return handle, nil
+}
+
+// acquireSource 取出一个空闲句柄,首次使用时才打开源影像
+func (r *Renderer) acquireSource() (*rendererHandle, error) {
+	handle := <-r.handles
+	if !handle.sourceOpened {
+		source, err := gdal.Open(r.filename, gdal.ReadOnly)
+		if err != nil {
+			r.handles <- handle
+			return nil, err
+		}
+		handle.source, handle.sourceOpened = source, true
+	}
+	metrics.GDALHandles.Inc()
+	return handle, nil
+}
+
+func (r *Renderer) release(handle *rendererHandle) {
+	metrics.GDALHandles.Dec()
+	r.handles <- handle
+}
+
+// Render 渲染 XYZ 瓦片,y 从北往南;瓦片在影像范围外时返回 ErrOutsideFootprint
+// options 为空时与切片流程的读取一致,否则按请求参数组装读取中间件
+func (r *Renderer) Render(z, x, y int, format string, options *RenderOptions) ([]byte, error) {
+	if format != "png" && format != "jpg" && format != "jpeg" {
+		return nil, pkgGdal.ErrTileFormat
+	}
+	maxX, maxY := r.Profile.MaxTile(z)
+	if z < 0 || x < 0 || y < 0 || x > maxX || y > maxY {
+		return nil, pkgGdal.ErrOutsideFootprint
+	}
+	// 内部按 TMS 计算,行号从南往北
+	_, ty := r.Profile.TMSTile(z, x, y)
+	minx, miny, maxx, maxy := r.Profile.TileMetersBounds(z, x, ty)
+	if maxx <= r.Minx || minx >= r.Maxx || maxy <= r.Miny || miny >= r.Maxy {
+		return nil, pkgGdal.ErrOutsideFootprint
+	}
+	windows := NewWindows().ReadBox(&WindowsReadBox{
+		Minx:         minx,
+		Maxy:         maxy,
+		Maxx:         maxx,
+		Miny:         miny,
+		TileSize:     r.tileSize,
+		GeoTransform: r.geoTransform,
+		Height:       r.height,
+		Width:        r.width,
+	})
+	if windows.RxSize <= 0 || windows.RySize <= 0 || windows.WxSize <= 0 || windows.WySize <= 0 {
+		return nil, pkgGdal.ErrOutsideFootprint
+	}
+
+	handle, err := r.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer r.release(handle)
+
+	readFuncs := []NextTileReadFunc{initTileRead(handle.dataset), Read(), TileToPNG()}
+	if options != nil {
+		readFuncs = options.ReadFuncs(handle.dataset)
+	}
+
+	var data []byte
+	tileId := &Id{Z: z, X: x, Y: ty, Windows: windows, TileSize: r.tileSize}
+	err = ReadExec(tileId, func(info *Id) error {
+		dsTile, err := info.downsample()
+		if err != nil {
+			return err
+		}
+		defer dsTile.Close()
+		data, err = EncodeTile(dsTile, format)
+		return err
+	}, readFuncs...)
+	if err != nil {
+		return nil, fmt.Errorf("render %s %d/%d/%d: %w", r.filename, z, x, y, err)
+	}
+	return data, nil
+}
+
+func (r *Renderer) Close() {
+	for i := 0; i < r.workers; i++ {
+		handle := <-r.handles
+		if handle.opened {
+			handle.dataset.Close()
+		}
+		if handle.sourceOpened {
+			handle.source.Close()
+		}
+	}
+	_ = os.Remove(r.vrtFilename)
+}
+
+// warpResamplings 请求参数与 gdalwarp -r 的对应,gdalwarp 不支持 gauss
+var warpResamplings = map[string]string{
+	"nearest":     "near",
+	"bilinear":    "bilinear",
+	"cubic":       "cubic",
+	"cubicspline": "cubicspline",
+	"lanczos":     "lanczos",
+	"average":     "average",
+	"mode":        "mode",
+	"gauss":       "average",
+}
+
+// RenderMap 按 WrapGdalVrt 的参数把源影像 warp 为 epsg 坐标系 bbox 范围的内存 VRT,输出 width*height 的图片,用于 WMS GetMap
+// bbox 为 minx,miny,maxx,maxy,单位为目标坐标系
+func (r *Renderer) RenderMap(epsg int, bbox [4]float64, width, height int, format string, options *RenderOptions) ([]byte, error) {
+	if format != "png" && format != "jpg" && format != "jpeg" {
+		return nil, pkgGdal.ErrTileFormat
+	}
+	if width <= 0 || height <= 0 || width > MaxMapSize || height > MaxMapSize {
+		return nil, pkgGdal.ErrMapSize
+	}
+	if bbox[0] >= bbox[2] || bbox[1] >= bbox[3] {
+		return nil, pkgGdal.ErrMapBBox
+	}
+	if options == nil {
+		options = &RenderOptions{}
+	}
+
+	handle, err := r.acquireSource()
+	if err != nil {
+		return nil, err
+	}
+	defer r.release(handle)
+	// 内存 VRT,不写临时文件;return_mask 时追加 alpha 波段,影像范围外透明
+	warped, err := pkgGdal.WarpDataset(handle.source, epsg, r.wrapOptions(
+		pkgGdal.WithTargetExtent(bbox[0], bbox[1], bbox[2], bbox[3]),
+		pkgGdal.WithTargetSize(width, height),
+		pkgGdal.WithResampling(warpResamplings[options.Resampling]),
+		pkgGdal.WithDstAlpha(options.ReturnMask),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	metrics.GDALHandles.Inc()
+	defer func() {
+		warped.Close()
+		metrics.GDALHandles.Dec()
+	}()
+
+	// alpha 为最后一个波段,不参与 bidx 的默认波段
+	alphaBand := 0
+	if options.ReturnMask {
+		alphaBand = warped.RasterCount()
+		if len(options.Bidx) == 0 {
+			mapOptions := *options
+			for b := 1; b < alphaBand; b++ {
+				mapOptions.Bidx = append(mapOptions.Bidx, b)
+			}
+			options = &mapOptions
+		}
+	}
+
+	// 输出与 VRT 同样大小,读取窗口即整幅 VRT
+	windows := &Window{RxSize: width, RySize: height, WxSize: width, WySize: height}
+	var data []byte
+	err = ReadExec(&Id{Windows: windows, TileSize: max(width, height)}, func(info *Id) error {
+		encoded, err := encodeBands(info.imgBuf, width, height, format)
+		data = encoded
+		return err
+	}, options.bandFuncs(warped, alphaBand)...)
+	if err != nil {
+		return nil, fmt.Errorf("render map %s EPSG:%d %v: %w", r.filename, epsg, bbox, err)
+	}
+	return data, nil
+}
@@ -2,41 +2,66 @@ package tile
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/lukeroth/gdal"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/metrics"
 )
 
 type Id struct {
-	Z, X, Y   int
-	Windows   *Window
-	Filename  string
-	querySize int
-	dataset   gdal.Dataset
-	imgBuf    [][]byte
-	dsQuery   gdal.Dataset
+	Z, X, Y  int
+	Windows  *Window
+	Filename string
+	TileSize int
+	// retina 瓦片,以两倍分辨率写入 {y}@2x.png
+	RetinaWindows  *Window
+	RetinaFilename string
+	querySize      int
+	dataset        gdal.Dataset
+	imgBuf         [][]byte
+	dsQuery        gdal.Dataset
+	// 实时渲染的参数:读取的波段(从 1 开始)、按浮点读取原始值、有效像素掩膜、缩放重采样方式
+	bands      []int
+	readFloat  bool
+	values     [][]float32
+	mask       []byte
+	resampling string
 }
 
 func (t *Id) String() string {
 	return fmt.Sprintf("Z:%d X:%d Y:%d", t.Z, t.X, t.Y)
 }
 
+// ReadTile 写出瓦片及其 retina 瓦片,每个瓦片号只计数一次
 func (t *Id) ReadTile(dataset gdal.Dataset) error {
+	if err := t.readTile(dataset); err != nil {
+		return err
+	}
+	metrics.TileGenerated(t.Z)
+	if t.RetinaFilename == "" {
+		return nil
+	}
+
+	retina := *t
+	retina.Windows = t.RetinaWindows
+	retina.Filename = t.RetinaFilename
+	retina.TileSize = 2 * t.TileSize
+	return retina.readTile(dataset)
+}
+
+func (t *Id) readTile(dataset gdal.Dataset) error {
 	return ReadExec(t, func(info *Id) error {
-		memDrv, err := gdal.GetDriverByName("MEM")
+		dsTile, err := info.downsample()
 		if err != nil {
 			return err
 		}
-		bandCount := info.dsQuery.RasterCount()
-		dsTile := memDrv.Create("", 256, 256, bandCount, gdal.Byte, nil)
-		for i := 0; i < bandCount; i++ {
-			dsQueryBand := info.dsQuery.RasterBand(i + 1)
-			dstBand := dsTile.RasterBand(i + 1)
-			err := dsQueryBand.RegenerateOverviews(1, &dstBand, "average", gdal.DummyProgress, nil)
-			if err != nil {
-				return err
-			}
-		}
+		defer dsTile.Close()
 		outDrv, err := gdal.GetDriverByName("PNG")
+		if err != nil {
+			return err
+		}
 		outDrv.CreateCopy(info.Filename, dsTile, 0, nil, nil, nil)
 
 		return nil
@@ -44,6 +69,28 @@ func (t *Id) ReadTile(dataset gdal.Dataset) error {
 	}, initTileRead(dataset), Read(), TileToPNG())
 }
 
+// downsample 把 4 倍大小的查询数据集缩放为一张瓦片
+func (t *Id) downsample() (gdal.Dataset, error) {
+	memDrv, err := gdal.GetDriverByName("MEM")
+	if err != nil {
+		return gdal.Dataset{}, err
+	}
+	defer t.dsQuery.Close()
+	defer metrics.ObserveStage(metrics.StageRegenerateOverviews, time.Now())
+	bandCount := t.dsQuery.RasterCount()
+	dsTile := memDrv.Create("", t.TileSize, t.TileSize, bandCount, gdal.Byte, nil)
+	for i := 0; i < bandCount; i++ {
+		dsQueryBand := t.dsQuery.RasterBand(i + 1)
+		dstBand := dsTile.RasterBand(i + 1)
+		err := dsQueryBand.RegenerateOverviews(1, &dstBand, t.resampling, gdal.DummyProgress, nil)
+		if err != nil {
+			dsTile.Close()
+			return gdal.Dataset{}, err
+		}
+	}
+	return dsTile, nil
+}
+
 type ReadFunc func(*Id) error
 
 type NextTileReadFunc func(next ReadFunc) ReadFunc
@@ -58,9 +105,9 @@ func ReadExec(info *Id, readFunc ReadFunc, next ...NextTileReadFunc) error {
 func initTileRead(dataset gdal.Dataset) NextTileReadFunc {
 	return func(next ReadFunc) ReadFunc {
 		return func(info *Id) error {
-			info.querySize = 256 * 4
+			info.querySize = info.TileSize * 4
 			info.dataset = dataset
-			info.imgBuf = make([][]byte, info.dataset.RasterCount())
+			info.resampling = "average"
 			return next(info)
 		}
 	}
@@ -69,22 +116,50 @@ func initTileRead(dataset gdal.Dataset) NextTileReadFunc {
 func Read() NextTileReadFunc {
 	return func(next ReadFunc) ReadFunc {
 		return func(info *Id) error {
-			bandCount := info.dataset.RasterCount()
+			start := time.Now()
+			bands := info.bands
+			if len(bands) == 0 {
+				for i := 1; i <= info.dataset.RasterCount(); i++ {
+					bands = append(bands, i)
+				}
+			}
+			info.imgBuf = make([][]byte, len(bands))
+			if info.readFloat {
+				info.values = make([][]float32, len(bands))
+			}
 
-			for i := 0; i < bandCount; i++ {
-				data := make([]byte, info.Windows.RxSize*info.Windows.RySize)
+			for i, b := range bands {
+				if b < 1 || b > info.dataset.RasterCount() {
+					return pkgGdal.ErrBandIndex
+				}
+				// 有 overview 时从对应级别读取,避免解码全分辨率数据
+				band, window := overviewWindow(info.dataset.RasterBand(b), info.Windows)
+				if info.readFloat {
+					// 按原始数值读取,由 Rescale() 拉伸到 0-255
+					values := make([]float32, window.WxSize*window.WySize)
+					err := band.IO(gdal.Read, window.Rx, window.Ry, window.RxSize,
+						window.RySize, values, window.WxSize, window.WySize, 0, 0)
+					if err != nil {
+						return err
+					}
+					info.values[i] = values
+					continue
+				}
+
+				// 缓冲区按输出窗口大小分配,超出源分辨率放大读取时输出比读取窗口大
+				data := make([]byte, info.Windows.WxSize*info.Windows.WySize)
 				for d := range data {
 					data[d] = 255
 				}
-				band := info.dataset.RasterBand(i + 1)
-				err := band.IO(gdal.Read, info.Windows.Rx, info.Windows.Ry, info.Windows.RxSize,
-					info.Windows.RySize, data, info.Windows.WxSize, info.Windows.WySize, 0, 0)
+				err := band.IO(gdal.Read, window.Rx, window.Ry, window.RxSize,
+					window.RySize, data, window.WxSize, window.WySize, 0, 0)
 				if err != nil {
 					return err
 				}
 
 				info.imgBuf[i] = data
 			}
+			metrics.ObserveStage(metrics.StageRead, start)
 
 			return next(info)
 		}
@@ -94,12 +169,13 @@ func Read() NextTileReadFunc {
 func TileToPNG() NextTileReadFunc {
 	return func(next ReadFunc) ReadFunc {
 		return func(info *Id) error {
+			start := time.Now()
 			imgData := info.imgBuf
 			memDrv, err := gdal.GetDriverByName("MEM")
 			if err != nil {
 				return err
 			}
-			bandCount := info.dataset.RasterCount()
+			bandCount := len(imgData)
 			dsQuery := memDrv.Create("", info.querySize, info.querySize, bandCount, gdal.Byte, nil)
 
 			for i := 0; i < bandCount; i++ {
@@ -111,6 +187,7 @@ func TileToPNG() NextTileReadFunc {
 			}
 
 			info.dsQuery = dsQuery
+			metrics.ObserveStage(metrics.StageTileToPNG, start)
 
 			return next(info)
 		}
@@ -14,24 +14,48 @@ import (
 )
 
 type Tile struct {
-	outFolder     string
-	tempFileVrt   string
-	vrt           gdal.Dataset
+	outFolder   string
+	tempFileVrt string
+	// datasets NewTile 打开的源影像、COG 和 VRT,Close 时关闭
+	datasets      []gdal.Dataset
 	err           []error
 	tileSize      int
+	retina        bool
 	inputFilename string
+	srcSRS        string
+	georeference  string
+	cutline       string
+	Cutline       *pkgGdal.Cutline
+	aoi           AreasOfInterest
+	webViewer     []string
 	style         string
 	bandCount     int
 	querySize     int
 	ZoomTileIds   [][]*Id
 	ZoomMax       int
 	ZoomMin       int
-	Mercator      *pkgGdal.Mercator
-	Gdal          *pkgGdal.Gdal
-	Concurrency   int
-	wg            *errgroup.Group
-	TZMinMax      [][]int
-	TzCount       map[int]int
+	Profile       pkgGdal.Profile
+	// Deprecated: 使用 Profile;mercator 方案时与 Profile 相同,geodetic 方案时为 nil
+	Mercator    *pkgGdal.Mercator
+	profile     string
+	layoutName  string
+	layout      *Layout
+	arcgis      bool
+	pmtiles     bool
+	gpkg        bool
+	cog         string
+	cogFilename string
+	// 切片过程中创建的临时文件(重投影 VRT、COG),Close 时删除
+	tempFiles []string
+	// 构建源影像外部 .ovr 金字塔
+	buildOverviews bool
+	overviews      map[int]*zoomOverview
+	kml            bool
+	Gdal           *pkgGdal.Gdal
+	Concurrency    int
+	wg             *errgroup.Group
+	TZMinMax       [][]int
+	TzCount        map[int]int
 }
 
 func NewTile(options ...TileOption) *Tile {
@@ -43,49 +67,128 @@ func NewTile(options ...TileOption) *Tile {
 	if defaultTile.inputFilename == "" {
 		defaultTile.err = append(defaultTile.err, pkgGdal.ErrInputFilename)
 	}
+	if defaultTile.tileSize != 256 && defaultTile.tileSize != 512 {
+		defaultTile.err = append(defaultTile.err, pkgGdal.ErrTileSize)
+	}
+	if defaultTile.cog != "" && defaultTile.cog != pkgGdal.COGInput && defaultTile.cog != pkgGdal.COGVrt {
+		defaultTile.err = append(defaultTile.err, pkgGdal.ErrCOG)
+	}
+	profile, err := pkgGdal.NewProfile(defaultTile.profile, defaultTile.tileSize)
+	if err != nil {
+		defaultTile.err = append(defaultTile.err, err)
+	}
+	defaultTile.Profile = profile
+	defaultTile.Mercator, _ = profile.(*pkgGdal.Mercator)
 	if len(defaultTile.err) > 0 {
 		return defaultTile
 	}
+	defaultTile.layout, err = NewLayout(defaultTile.layoutName, defaultTile.Scheme(), defaultTile.Profile)
+	if err != nil {
+		defaultTile.err = append(defaultTile.err, err)
+		return defaultTile
+	}
 	fmt.Printf("输入文件:%s\n", defaultTile.inputFilename)
 
+	if defaultTile.buildOverviews {
+		if err := pkgGdal.BuildExternalOverviews(defaultTile.inputFilename, "average", defaultTile.tileSize); err != nil {
+			defaultTile.err = append(defaultTile.err, err)
+			return defaultTile
+		}
+	}
+
 	dataset, err := gdal.Open(defaultTile.inputFilename, gdal.ReadOnly)
 	if err != nil {
 		defaultTile.err = append(defaultTile.err, err)
 		return defaultTile
 	}
+	defaultTile.datasets = append(defaultTile.datasets, dataset)
+	if defaultTile.cog == pkgGdal.COGInput {
+		dataset, err = defaultTile.translateCOG(dataset)
+		if err != nil {
+			defaultTile.err = append(defaultTile.err, err)
+			return defaultTile
+		}
+		defaultTile.datasets = append(defaultTile.datasets, dataset)
+	}
 
-	vrt, err := pkgGdal.WrapGdalVrt(dataset, 3857)
+	vrt, err := pkgGdal.WrapGdalVrt(dataset, defaultTile.Profile.EPSG(), defaultTile.wrapOptions()...)
 	if err != nil {
 		defaultTile.err = append(defaultTile.err, err)
 		return defaultTile
 	}
+	defaultTile.tempFiles = append(defaultTile.tempFiles, vrt.Filename)
+	defaultTile.datasets = append(defaultTile.datasets, vrt.Ds)
+	if defaultTile.cog == pkgGdal.COGVrt {
+		// 重投影后的 VRT 转为 COG,之后的窗口读取都落在 COG 的分块和 overview 上
+		ds, err := defaultTile.translateCOG(vrt.Ds)
+		if err != nil {
+			defaultTile.err = append(defaultTile.err, err)
+			return defaultTile
+		}
+		defaultTile.datasets = append(defaultTile.datasets, ds)
+		vrt = &pkgGdal.VrtInfo{Filename: defaultTile.cogFilename, Ds: ds}
+	}
+
+	if defaultTile.cutline != "" {
+		defaultTile.Cutline, err = pkgGdal.NewCutline(defaultTile.cutline, defaultTile.Profile.EPSG())
+		if err != nil {
+			defaultTile.err = append(defaultTile.err, err)
+			return defaultTile
+		}
+	}
+
+	if err := defaultTile.loadAreaOfInterest(); err != nil {
+		defaultTile.err = append(defaultTile.err, err)
+		return defaultTile
+	}
 
-	defaultTile.vrt = vrt.Ds
 	defaultTile.tempFileVrt = vrt.Filename
-	defaultTile.Mercator = pkgGdal.NewMercator()
+	defaultTile.querySize = 4 * defaultTile.tileSize
 	defaultTile.Gdal, err = pkgGdal.NewGdal(defaultTile.tempFileVrt)
 	if err != nil {
 		defaultTile.err = append(defaultTile.err, err)
 		return defaultTile
 	}
 	defaultTile.Gdal.AdvanceCalculate()
+	if !defaultTile.Gdal.IsNorthUp() {
+		defaultTile.err = append(defaultTile.err, pkgGdal.ErrNotNorthUp)
+		return defaultTile
+	}
+	if err := defaultTile.loadOverviews(dataset); err != nil {
+		defaultTile.err = append(defaultTile.err, err)
+		return defaultTile
+	}
 	defaultTile.wg = &errgroup.Group{}
-	defaultTile.wg.SetLimit(defaultTile.Concurrency)
+	// 限制为 0 时 errgroup 无法启动任何任务
+	defaultTile.wg.SetLimit(max(defaultTile.Concurrency, 1))
 	defaultTile.TzCount = make(map[int]int, defaultTile.ZoomMax-defaultTile.ZoomMin+1)
-	defaultTile.bandCount = dataset.RasterCount()
+	// 裁切时 warp 会增加 alpha 波段,以 VRT 的波段数为准
+	defaultTile.bandCount = vrt.Ds.RasterCount()
 	return defaultTile
 }
 
 func (tile *Tile) GenerateGdalReadWindows() *Tile {
+	if len(tile.err) > 0 {
+		return tile
+	}
 	minx, miny, maxx, maxy := tile.Gdal.GetBoundsByTransform()
 	tile.ZoomTileIds = make([][]*Id, tile.ZoomMax+1)
 	tile.TZMinMax = make([][]int, tile.ZoomMax+1)
 
 	for z := tile.ZoomMin; z <= tile.ZoomMax; z++ {
-		tminx, tminy := tile.Mercator.MeterToTile(z, minx, miny)
-		tmaxx, tmaxy := tile.Mercator.MeterToTile(z, maxx, maxy)
+		aminx, aminy, amaxx, amaxy, ok := tile.areaOfInterestBounds(z, minx, miny, maxx, maxy)
+		if !ok {
+			fmt.Printf("当前层级:%d,不在兴趣区范围内\n", z)
+			tile.ZoomTileIds[z] = nil
+			tile.TZMinMax[z] = []int{0, 0, -1, -1}
+			tile.TzCount[z] = 0
+			continue
+		}
+		tminx, tminy := tile.Profile.MeterToTile(z, aminx, aminy)
+		tmaxx, tmaxy := tile.Profile.MeterToTile(z, amaxx, amaxy)
+		maxTileX, maxTileY := tile.Profile.MaxTile(z)
 		tminx, tminy = int(math.Max(0, float64(tminx))), int(math.Max(0, float64(tminy)))
-		tmaxx, tmaxy = int(math.Min(math.Pow(2, float64(z))-1, float64(tmaxx))), int(math.Min(math.Pow(2, float64(z))-1, float64(tmaxy)))
+		tmaxx, tmaxy = int(math.Min(float64(maxTileX), float64(tmaxx))), int(math.Min(float64(maxTileY), float64(tmaxy)))
 		//fmt.Printf("当前层级:%d,最小瓦片号:%d,%d,最大瓦片号:%d,%d\n", z, tminx, tminy, tmaxx, tmaxy)
 		tile.windows(z, tminx, tminy, tmaxx, tmaxy)
 		tile.TZMinMax[z] = []int{tminx, tminy, tmaxx, tmaxy}
@@ -95,51 +198,66 @@ func (tile *Tile) GenerateGdalReadWindows() *Tile {
 
 func (tile *Tile) windows(tz, tminx, tminy, tmaxx, tmaxy int) *Tile {
 	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
 	tcount := int((1.0 + math.Abs(float64(tmaxx-tminx))) * (1 + math.Abs(float64(tmaxy-tminy))))
 
 	tile.TzCount[tz] = tcount
 
 	tile.ZoomTileIds[tz] = make([]*Id, 0, tcount)
+	// 读取 overview 的层级按 overview 的网格计算窗口
+	src := tile.zoomGdal(tz)
 	fmt.Printf("当前层级:%d,最小瓦片号:%d,%d,最大瓦片号:%d,%d,总瓦片数:%d\n", tz, tminx, tminy, tmaxx, tmaxy, tcount)
 
 	for x := tminx; x <= tmaxx; x++ {
 		for y := tminy; y <= tmaxy; y++ {
+			if !tile.inArea(tz, x, y) {
+				continue
+			}
 			xCopy := x
 			yCopy := y
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				tmsY := yCopy
-				if tile.style == "tms" {
-					tmsY = (1 << tz) - yCopy - 1
-				}
-
-				filename := fmt.Sprintf("%s/%d/%d/%d.png", tile.outFolder, tz, xCopy, tmsY)
-				if tile.outFolder == "" {
-					filename = fmt.Sprintf("%d/%d/%d.png", tz, xCopy, tmsY)
-				}
+				filename := tile.tileFilename(tz, xCopy, yCopy, false)
 				if _, err := os.Stat(filename); err != nil {
 					_ = os.MkdirAll(filepath.Dir(filename), os.ModePerm)
 				}
 
-				minx, miny, maxx, maxy := tile.Mercator.TileMetersBounds(tz, xCopy, yCopy)
+				minx, miny, maxx, maxy := tile.Profile.TileMetersBounds(tz, xCopy, yCopy)
 				windows := NewWindows().ReadBox(&WindowsReadBox{
 					Minx:         minx,
 					Maxy:         maxy,
 					Maxx:         maxx,
 					Miny:         miny,
 					TileSize:     tile.tileSize,
-					GeoTransform: tile.Gdal.GetGeoTransform(),
-					Height:       tile.Gdal.GetHeight(),
-					Width:        tile.Gdal.GetWidth(),
+					GeoTransform: src.GetGeoTransform(),
+					Height:       src.GetHeight(),
+					Width:        src.GetWidth(),
 				})
-				tile.ZoomTileIds[tz] = append(tile.ZoomTileIds[tz], &Id{
+				tileId := &Id{
 					Z:        tz,
 					X:        xCopy,
 					Y:        yCopy,
 					Filename: filename,
 					Windows:  windows,
-				})
+					TileSize: tile.tileSize,
+				}
+				if tile.retina {
+					tileId.RetinaFilename = tile.tileFilename(tz, xCopy, yCopy, true)
+					tileId.RetinaWindows = NewWindows().ReadBox(&WindowsReadBox{
+						Minx:         minx,
+						Maxy:         maxy,
+						Maxx:         maxx,
+						Miny:         miny,
+						TileSize:     2 * tile.tileSize,
+						GeoTransform: src.GetGeoTransform(),
+						Height:       src.GetHeight(),
+						Width:        src.GetWidth(),
+					})
+				}
+				mu.Lock()
+				tile.ZoomTileIds[tz] = append(tile.ZoomTileIds[tz], tileId)
+				mu.Unlock()
 
 			}()
 
@@ -147,17 +265,84 @@ func (tile *Tile) windows(tz, tminx, tminy, tmaxx, tmaxy int) *Tile {
 	}
 
 	wg.Wait()
+	tile.TzCount[tz] = len(tile.ZoomTileIds[tz])
 	return tile
 }
 
+// inArea 瓦片是否与裁切多边形、兴趣区相交,不相交的瓦片不生成
+func (tile *Tile) inArea(z, x, y int) bool {
+	minx, miny, maxx, maxy := tile.Profile.TileMetersBounds(z, x, y)
+	if tile.Cutline != nil && !tile.Cutline.Intersects(minx, miny, maxx, maxy) {
+		return false
+	}
+	return tile.intersectsAreaOfInterest(z, minx, miny, maxx, maxy)
+}
+
+// Scheme 输出的瓦片行号方式,瓦片号按 TMS 从南往北计算
+func (tile *Tile) Scheme() string {
+	return StyleScheme(tile.style)
+}
+
+// StyleScheme 瓦片风格对应的行号方式:与最初的切片输出一致,tms 风格按 (1<<z)-y-1 翻转,
+// 即从北往南的 xyz 行号;默认(google 或为空)不翻转,输出 TMS 行号
+func StyleScheme(style string) string {
+	if style == "tms" {
+		return "xyz"
+	}
+	return "tms"
+}
+
+// tileFilename 瓦片输出路径,由瓦片布局生成
+func (tile *Tile) tileFilename(z, x, y int, retina bool) string {
+	return filepath.Join(tile.outFolder, tile.layout.Path(z, x, y, retina))
+}
+
+// Close 关闭所有句柄、删除临时文件,切片出错时同样清理,之后返回第一个错误
 func (tile *Tile) Close() error {
+	defer tile.removeTempFiles()
+	tile.closeOverviews()
+	if tile.Gdal != nil {
+		tile.Gdal.Close()
+		tile.Gdal = nil
+	}
+	if tile.Cutline != nil {
+		tile.Cutline.Close()
+		tile.Cutline = nil
+	}
+	tile.closeAreaOfInterest()
+	for i := len(tile.datasets) - 1; i >= 0; i-- {
+		tile.datasets[i].Close()
+	}
+	tile.datasets = nil
 	if len(tile.err) > 0 {
 		return tile.err[0]
 	}
-	tile.Gdal.Close()
 	return nil
 }
 
+func (tile *Tile) removeTempFiles() {
+	for _, filename := range tile.tempFiles {
+		_ = os.Remove(filename)
+	}
+	tile.tempFiles = nil
+}
+
+// translateCOG 预处理为带内部分块和 overview 的临时 COG
+func (tile *Tile) translateCOG(src gdal.Dataset) (gdal.Dataset, error) {
+	tempFile, err := os.CreateTemp("", "*.cog.tif")
+	if err != nil {
+		return gdal.Dataset{}, err
+	}
+	_ = tempFile.Close()
+	tile.cogFilename = tempFile.Name()
+	tile.tempFiles = append(tile.tempFiles, tile.cogFilename)
+
+	fmt.Printf("预处理为 COG:%s\n", tile.cogFilename)
+	return pkgGdal.TranslateCOG(src, tile.cogFilename,
+		pkgGdal.WithCOGBlockSize(2*tile.tileSize),
+	)
+}
+
 // CuttingToImg 裁切影像
 func (tile *Tile) CuttingToImg() *Tile {
 	if len(tile.err) > 0 {
@@ -3,11 +3,12 @@ package tile
 import (
 	"fmt"
 	"os"
-	"path/filepath"
-	"sync"
+	"time"
 
 	"github.com/lukeroth/gdal"
 	"github.com/pkg/errors"
+
+	"github.com/pdxrlj/tile_server/pkg/metrics"
 )
 
 type TileOverviewFn func(*Tile) error
@@ -25,36 +26,34 @@ func BuildMapTiles(data *Tile) error {
 	return Interceptor(data, func(tile *Tile) error {
 		fmt.Printf("瓦片切片完成")
 		return nil
-	}, OverviewTile())
+	}, BaseTile(), OverviewTile(), WriteMetadata(), WriteViewer(), WriteKML(), WriteArcGIS(), WritePMTiles(), WriteGeoPackage())
 }
 
-// BaseTile 生成基础瓦片
+// BaseTile 生成基础瓦片,同时处理的瓦片数由 Concurrency 限制
 func BaseTile() NextTileOverviewFn {
 	return func(next TileOverviewFn) TileOverviewFn {
 		return func(data *Tile) error {
-			sg := sync.WaitGroup{}
 			baseZoom := data.ZoomMax
 
 			fmt.Printf("[1/2] 开始生成底图瓦片数据 zoom=%d count=%d\n", baseZoom, data.TzCount[baseZoom])
 			for _, tileId := range data.ZoomTileIds[baseZoom] {
 				tileIdCopy := tileId
-				sg.Add(1)
-				go func() {
-					defer sg.Done()
+				data.wg.Go(func() error {
 					dataset, err := gdal.Open(data.tempFileVrt, gdal.ReadOnly)
 					if err != nil {
-						data.err = append(data.err, err)
-					}
-					err = tileIdCopy.ReadTile(dataset)
-					if err != nil {
-						data.err = append(data.err, err)
+						return err
 					}
-				}()
+					metrics.GDALHandles.Inc()
+					defer func() {
+						dataset.Close()
+						metrics.GDALHandles.Dec()
+					}()
+					return tileIdCopy.ReadTile(dataset)
+				})
 			}
 
-			sg.Wait()
-			if len(data.err) > 0 {
-				return errors.WithStack(data.err[0])
+			if err := data.wg.Wait(); err != nil {
+				return errors.WithStack(err)
 			}
 
 			return next(data)
@@ -62,6 +61,26 @@ func BaseTile() NextTileOverviewFn {
 	}
 }
 
+// sourceTiles 从 VRT 或源影像 overview 直接读取瓦片
+func (tile *Tile) sourceTiles(filename string, tileIds []*Id) error {
+	dataset, err := gdal.Open(filename, gdal.ReadOnly)
+	if err != nil {
+		return err
+	}
+	metrics.GDALHandles.Inc()
+	defer func() {
+		dataset.Close()
+		metrics.GDALHandles.Dec()
+	}()
+
+	for _, tileId := range tileIds {
+		if err := tileId.ReadTile(dataset); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 // OverviewTile 生成缩略图瓦片数据
 func OverviewTile() NextTileOverviewFn {
 	return func(next TileOverviewFn) TileOverviewFn {
@@ -75,84 +94,96 @@ func OverviewTile() NextTileOverviewFn {
 			for overview := overviewMaxZoom; overview >= tile.ZoomMin; overview-- {
 				fmt.Printf("[2/2] 开始生成缩略图瓦片数据 zoom=%d count=%d\n", overview, tile.TzCount[overview])
 				zoomTileIds := tile.ZoomTileIds[overview]
-				for _, tileId := range zoomTileIds {
-
-					tileIdCopy := tileId
-					x := tileIdCopy.X
-					y := tileIdCopy.Y
-					z := tileIdCopy.Z
-
-					dsQuery := memDriver.Create("", 2*256, 2*256, tile.bandCount, gdal.Byte, nil)
-				SUB:
-					for tx := 2 * x; tx < 2*x+2; tx++ {
-						for ty := y * 2; ty < y*2+2; ty++ {
-							tMinMax := tile.TZMinMax[z+1]
-							minx, miny, maxx, maxy := tMinMax[0], tMinMax[1], tMinMax[2], tMinMax[3]
-							if minx <= tx && tx <= maxx && miny <= ty && ty <= maxy {
-								tyCopy := ty
-								if tile.style == "tms" {
-									tyCopy = (1 << (z + 1)) - ty - 1
-								}
-
-								baseTile := filepath.Join(tile.outFolder, fmt.Sprintf("%d/%d/%d.png", z+1, tx, tyCopy))
-								if _, err := os.Stat(filepath.Dir(baseTile)); err != nil {
-									tile.err = append(tile.err, err)
-									break SUB
-								}
-
-								dataset, err := gdal.Open(baseTile, gdal.ReadOnly)
-								if err != nil {
-									tile.err = append(tile.err, err)
-									break SUB
-								}
-								tilePoxY := 256
-								if (y == 0 && ty == 1) || (y != 0 && (ty%(2*y) != 0)) {
-									tilePoxY = 0
-								}
-
-								tilePoxX := 0
-								if x != 0 {
-									tilePoxX = tx % (2 * x) * 256
-								} else if x == 0 && tx == 1 {
-									tilePoxX = 256
-								}
-
-								for i := 0; i < dataset.RasterCount(); i++ {
-									readTmp := make([]byte, 256*256)
-									err = dataset.RasterBand(i+1).IO(gdal.Read, 0, 0, 256, 256, readTmp, 256, 256, 0, 0)
-									if err != nil {
-										tile.err = append(tile.err, errors.WithStack(err))
-										break SUB
-									}
-
-									err = dsQuery.RasterBand(i+1).IO(gdal.Write, tilePoxX, tilePoxY, 256, 256, readTmp, 256, 256, 0, 0)
-									if err != nil {
-										tile.err = append(tile.err, errors.WithStack(err))
-										break SUB
-									}
-								}
-							}
-						}
+				_, hasOverview := tile.overviews[overview]
+				if hasOverview || tile.aoi.ReadFromSource(overview, tile.ZoomMax) {
+					// 源影像有匹配的 overview,或下一层级只覆盖兴趣区,该层级直接读源影像
+					if err := tile.sourceTiles(tile.zoomSource(overview), zoomTileIds); err != nil {
+						tile.err = append(tile.err, err)
 					}
-					if err := RegenerateOverviews(tileIdCopy.Filename, &dsQuery); err != nil {
+					continue
+				}
+				for _, tileId := range zoomTileIds {
+					if err := tile.overviewTile(memDriver, tileId, tile.tileSize, tileId.Filename, false); err != nil {
 						tile.err = append(tile.err, errors.WithStack(err))
 						continue
 					}
+					metrics.TileGenerated(tileId.Z)
+					if tileId.RetinaFilename == "" {
+						continue
+					}
+					if err := tile.overviewTile(memDriver, tileId, 2*tile.tileSize, tileId.RetinaFilename, true); err != nil {
+						tile.err = append(tile.err, errors.WithStack(err))
+					}
 				}
 			}
+			// 缩略图不完整时不再导出元数据和瓦片包
+			if len(tile.err) > 0 {
+				return errors.WithStack(tile.err[0])
+			}
 
 			return next(tile)
 		}
 	}
 }
 
-func RegenerateOverviews(outFilename string, dst *gdal.Dataset) error {
+// overviewTile 把下一层级的 4 个子瓦片拼接到 2*tileSize 的画布上,再缩放为一张瓦片
+func (tile *Tile) overviewTile(memDriver gdal.Driver, tileId *Id, tileSize int, outFilename string, retina bool) error {
+	x, y, z := tileId.X, tileId.Y, tileId.Z
+	dsQuery := memDriver.Create("", 2*tileSize, 2*tileSize, tile.bandCount, gdal.Byte, nil)
+	defer dsQuery.Close()
+
+	tMinMax := tile.TZMinMax[z+1]
+	minx, miny, maxx, maxy := tMinMax[0], tMinMax[1], tMinMax[2], tMinMax[3]
+	for tx := 2 * x; tx < 2*x+2; tx++ {
+		for ty := y * 2; ty < y*2+2; ty++ {
+			// 影像范围、裁切多边形和兴趣区外的子瓦片没有生成,保持透明
+			if tx < minx || tx > maxx || ty < miny || ty > maxy || !tile.inArea(z+1, tx, ty) {
+				continue
+			}
+
+			// 其余子瓦片都应已生成,缺失说明生成失败
+			baseTile := tile.tileFilename(z+1, tx, ty, retina)
+			if _, err := os.Stat(baseTile); err != nil {
+				return err
+			}
+
+			dataset, err := gdal.Open(baseTile, gdal.ReadOnly)
+			if err != nil {
+				return err
+			}
+			// y 方向从南往北,北边的子瓦片在画布上方
+			tilePoxX := (tx - 2*x) * tileSize
+			tilePoxY := (2*y + 1 - ty) * tileSize
+
+			readTmp := make([]byte, tileSize*tileSize)
+			for i := 0; i < dataset.RasterCount(); i++ {
+				err = dataset.RasterBand(i+1).IO(gdal.Read, 0, 0, tileSize, tileSize, readTmp, tileSize, tileSize, 0, 0)
+				if err != nil {
+					dataset.Close()
+					return err
+				}
+
+				err = dsQuery.RasterBand(i+1).IO(gdal.Write, tilePoxX, tilePoxY, tileSize, tileSize, readTmp, tileSize, tileSize, 0, 0)
+				if err != nil {
+					dataset.Close()
+					return err
+				}
+			}
+			dataset.Close()
+		}
+	}
+
+	return RegenerateOverviews(outFilename, &dsQuery, tileSize)
+}
+
+func RegenerateOverviews(outFilename string, dst *gdal.Dataset, tileSize int) error {
+	defer metrics.ObserveStage(metrics.StageRegenerateOverviews, time.Now())
 	memDrv, err := gdal.GetDriverByName("MEM")
 	if err != nil {
 		return err
 	}
 	bands := dst.RasterCount()
-	dsTile := memDrv.Create("", 256, 256, bands, gdal.Byte, nil)
+	dsTile := memDrv.Create("", tileSize, tileSize, bands, gdal.Byte, nil)
 	for i := 0; i < bands; i++ {
 		dstBand := dsTile.RasterBand(i + 1)
 		err := dst.RasterBand(i+1).RegenerateOverviews(1, &dstBand, "average", gdal.DummyProgress, nil)
@@ -8,6 +8,13 @@ func SetTileSize(tileSize int) TileOption {
 	}
 }
 
+// SetRetina 同时生成两倍分辨率的 {y}@2x.png 瓦片
+func SetRetina(retina bool) TileOption {
+	return func(r *Tile) {
+		r.retina = retina
+	}
+}
+
 func SetConcurrency(concurrency int) TileOption {
 	return func(r *Tile) {
 		r.Concurrency = concurrency
@@ -32,6 +39,99 @@ func SetInputFilename(inputFilename string) TileOption {
 	}
 }
 
+// SetSrcSRS 覆盖源影像坐标系,支持 WKT、PROJ、EPSG
+func SetSrcSRS(srs string) TileOption {
+	return func(r *Tile) {
+		r.srcSRS = srs
+	}
+}
+
+// SetGeoreference 设置地理参考方式 auto/gcp/tps/rpc
+func SetGeoreference(method string) TileOption {
+	return func(r *Tile) {
+		r.georeference = method
+	}
+}
+
+// SetCutline 设置裁切多边形(GeoJSON/Shapefile),只输出多边形内的瓦片和像素
+func SetCutline(cutline string) TileOption {
+	return func(r *Tile) {
+		r.cutline = cutline
+	}
+}
+
+// SetAreaOfInterest 按层级限定生成范围,未覆盖的层级不生成瓦片
+func SetAreaOfInterest(areas ...AreaOfInterest) TileOption {
+	return func(r *Tile) {
+		for i := range areas {
+			r.aoi = append(r.aoi, &areas[i])
+		}
+	}
+}
+
+// SetWebViewer 生成预览页面 leaflet/openlayers/maplibre/all
+func SetWebViewer(viewers ...string) TileOption {
+	return func(r *Tile) {
+		r.webViewer = viewers
+	}
+}
+
+// SetProfile 设置切片方案 mercator/geodetic
+func SetProfile(profile string) TileOption {
+	return func(r *Tile) {
+		r.profile = profile
+	}
+}
+
+// SetKML 生成 Google Earth KML super-overlay
+func SetKML(kml bool) TileOption {
+	return func(r *Tile) {
+		r.kml = kml
+	}
+}
+
+// SetLayout 设置瓦片路径布局,预设 xyz/zyx/quadkey/arcgis 或自定义模板如 {z}/{x}/{y}
+func SetLayout(layout string) TileOption {
+	return func(r *Tile) {
+		r.layoutName = layout
+	}
+}
+
+// SetArcGIS 切片结束后导出 ArcGIS compact cache v2
+func SetArcGIS(arcgis bool) TileOption {
+	return func(r *Tile) {
+		r.arcgis = arcgis
+	}
+}
+
+// SetPMTiles 切片结束后打包为 PMTiles v3 单文件
+func SetPMTiles(pmtiles bool) TileOption {
+	return func(r *Tile) {
+		r.pmtiles = pmtiles
+	}
+}
+
+// SetGeoPackage 切片结束后写入 GeoPackage 瓦片表
+func SetGeoPackage(gpkg bool) TileOption {
+	return func(r *Tile) {
+		r.gpkg = gpkg
+	}
+}
+
+// SetCOG 切片前预处理为 COG,input 转换输入影像,vrt 转换重投影后的 VRT,为空时不处理
+func SetCOG(cog string) TileOption {
+	return func(r *Tile) {
+		r.cog = cog
+	}
+}
+
+// SetBuildOverviews 源影像没有 overview 时先生成外部 .ovr 金字塔
+func SetBuildOverviews(build bool) TileOption {
+	return func(r *Tile) {
+		r.buildOverviews = build
+	}
+}
+
 func SetZoomMaxMin(zoomMax, zoomMin int) TileOption {
 	return func(r *Tile) {
 		r.ZoomMax = zoomMax
@@ -0,0 +1,124 @@
+package tile
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+const (
+	ViewerLeaflet    = "leaflet"
+	ViewerOpenLayers = "openlayers"
+	ViewerMapLibre   = "maplibre"
+	ViewerAll        = "all"
+)
+
+//go:embed viewer/*.html
+var viewerTemplates embed.FS
+
+// viewerData 预览页面模板参数
+type viewerData struct {
+	Name                     string
+	Tiles                    string
+	Scheme                   string
+	TMS                      bool
+	TileSize                 int
+	MinZoom, MaxZoom         int
+	West, South, East, North float64
+	// Leaflet 按 256 计算层级,512 瓦片需要偏移一级
+	ZoomOffset                   int
+	ViewerMinZoom, ViewerMaxZoom int
+}
+
+// Viewers 展开 all 并去重
+func Viewers(names []string) []string {
+	var viewers []string
+	seen := make(map[string]bool)
+	for _, viewer := range names {
+		expanded := []string{viewer}
+		if viewer == ViewerAll {
+			expanded = []string{ViewerLeaflet, ViewerOpenLayers, ViewerMapLibre}
+		}
+		for _, name := range expanded {
+			if !seen[name] {
+				seen[name] = true
+				viewers = append(viewers, name)
+			}
+		}
+	}
+	return viewers
+}
+
+func newViewerData(tileJSON *TileJSON) *viewerData {
+	zoomOffset := 0
+	if tileJSON.TileSize == 512 {
+		zoomOffset = -1
+	}
+	return &viewerData{
+		Name:          tileJSON.Name,
+		Tiles:         tileJSON.Tiles[0],
+		Scheme:        tileJSON.Scheme,
+		TMS:           tileJSON.Scheme == "tms",
+		TileSize:      tileJSON.TileSize,
+		MinZoom:       tileJSON.MinZoom,
+		MaxZoom:       tileJSON.MaxZoom,
+		West:          tileJSON.Bounds[0],
+		South:         tileJSON.Bounds[1],
+		East:          tileJSON.Bounds[2],
+		North:         tileJSON.Bounds[3],
+		ZoomOffset:    zoomOffset,
+		ViewerMinZoom: tileJSON.MinZoom - zoomOffset,
+		ViewerMaxZoom: tileJSON.MaxZoom - zoomOffset,
+	}
+}
+
+// RenderViewer 按 TileJSON 生成 leaflet/openlayers/maplibre 预览页面
+func RenderViewer(viewer string, tileJSON *TileJSON) ([]byte, error) {
+	tmpl, err := template.ParseFS(viewerTemplates, fmt.Sprintf("viewer/%s.html", viewer))
+	if err != nil {
+		return nil, fmt.Errorf("unknown web viewer %q: %w", viewer, err)
+	}
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, newViewerData(tileJSON)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteViewer 在输出目录写入 leaflet.html / openlayers.html / maplibre.html 预览页面
+func WriteViewer() NextTileOverviewFn {
+	return func(next TileOverviewFn) TileOverviewFn {
+		return func(tile *Tile) error {
+			viewers := Viewers(tile.webViewer)
+			if len(viewers) == 0 {
+				return next(tile)
+			}
+			if _, ok := tile.layout.TileJSONTemplate(); !ok {
+				fmt.Printf("预览页面只支持 {z}/{x}/{y} 布局,跳过\n")
+				return next(tile)
+			}
+			if tile.Profile.Name() != pkgGdal.ProfileMercator {
+				// 预览页面的底图为 Web 墨卡托
+				fmt.Printf("预览页面只支持 mercator 切片方案,跳过\n")
+				return next(tile)
+			}
+
+			tileJSON := tile.TileJSON()
+			for _, viewer := range viewers {
+				page, err := RenderViewer(viewer, tileJSON)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("写入预览页面 %s.html\n", viewer)
+				if err := tile.writeFile(viewer+".html", page); err != nil {
+					return err
+				}
+			}
+
+			return next(tile)
+		}
+	}
+}
@@ -2,6 +2,10 @@ package tile
 
 import (
 	"math"
+
+	"github.com/lukeroth/gdal"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
 )
 
 type Window struct {
@@ -28,15 +32,10 @@ func NewWindows() *Window {
 }
 
 func (t *Window) ReadBox(box *WindowsReadBox) *Window {
-	// 计算该瓦片的左上角在源图上的 x/y 像素坐标
-	geoTransform := box.GeoTransform
+	// 计算该瓦片的左上角在源图上的 x/y 像素坐标及读取宽高
 	RasterXSize := box.Width
 	RasterYSize := box.Height
-	rx := int((box.Minx-geoTransform[0])/geoTransform[1] + 0.001)
-	ry := int((box.Maxy-geoTransform[3])/geoTransform[5] + 0.001)
-	// 计算该瓦片在源图读取瓦片的宽高
-	rxSize := int((box.Maxx-box.Minx)/geoTransform[1] + 0.5)
-	rySize := int((box.Miny-box.Maxy)/geoTransform[5] + 0.5)
+	rx, ry, rxSize, rySize := pixelBox(box)
 
 	// 写入文件宽高
 	wxSize, wySize := 4*box.TileSize, 4*box.TileSize
@@ -82,3 +81,54 @@ func (t *Window) ReadBox(box *WindowsReadBox) *Window {
 		WySize: wySize,
 	}
 }
+
+// pixelBox 计算瓦片地理范围在源图上的像素窗口(左上角及宽高)
+// 正北朝上时只用 GeoTransform[0,1,3,5];存在旋转/错切时用逆变换换算四个角点,取其外包窗口
+func pixelBox(box *WindowsReadBox) (int, int, int, int) {
+	geoTransform := box.GeoTransform
+	if pkgGdal.IsNorthUp(geoTransform) {
+		rx := int((box.Minx-geoTransform[0])/geoTransform[1] + 0.001)
+		ry := int((box.Maxy-geoTransform[3])/geoTransform[5] + 0.001)
+		// 计算该瓦片在源图读取瓦片的宽高
+		rxSize := int((box.Maxx-box.Minx)/geoTransform[1] + 0.5)
+		rySize := int((box.Miny-box.Maxy)/geoTransform[5] + 0.5)
+		return rx, ry, rxSize, rySize
+	}
+
+	inv, ok := pkgGdal.InvertGeoTransform(geoTransform)
+	if !ok {
+		return 0, 0, 0, 0
+	}
+	minPx, minPy := math.Inf(1), math.Inf(1)
+	maxPx, maxPy := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{box.Minx, box.Maxy}, {box.Maxx, box.Maxy}, {box.Minx, box.Miny}, {box.Maxx, box.Miny}} {
+		px, py := pkgGdal.ApplyGeoTransform(inv, corner[0], corner[1])
+		minPx, maxPx = math.Min(minPx, px), math.Max(maxPx, px)
+		minPy, maxPy = math.Min(minPy, py), math.Max(maxPy, py)
+	}
+	rx := int(math.Floor(minPx + 0.001))
+	ry := int(math.Floor(minPy + 0.001))
+	return rx, ry, int(maxPx - float64(rx) + 0.5), int(maxPy - float64(ry) + 0.5)
+}
+
+// overviewWindow 按读取窗口的缩小倍数选择 overview,并把窗口换算到 overview 的像素坐标
+func overviewWindow(band gdal.RasterBand, window *Window) (gdal.RasterBand, *Window) {
+	if window.WxSize <= 0 || band.OverviewCount() == 0 {
+		return band, window
+	}
+	factor := float64(window.RxSize) / float64(window.WxSize)
+	level := pkgGdal.SelectOverview(pkgGdal.OverviewFactors(band), factor)
+	if level < 0 {
+		return band, window
+	}
+
+	ov := band.Overview(level)
+	sx := float64(band.XSize()) / float64(ov.XSize())
+	sy := float64(band.YSize()) / float64(ov.YSize())
+	w := *window
+	w.Rx = int(float64(window.Rx) / sx)
+	w.Ry = int(float64(window.Ry) / sy)
+	w.RxSize = min(max(1, int(float64(window.RxSize)/sx+0.5)), ov.XSize()-w.Rx)
+	w.RySize = min(max(1, int(float64(window.RySize)/sy+0.5)), ov.YSize()-w.Ry)
+	return ov, &w
+}
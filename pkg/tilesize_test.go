@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestMercatorTileSize(t *testing.T) {
+	tests := []struct {
+		tileSize   int
+		resolution float64
+	}{
+		{256, 156543.03392804097},
+		{512, 78271.51696402048},
+	}
+	for _, tt := range tests {
+		m := pkgGdal.NewMercator(pkgGdal.WithTileSize(tt.tileSize))
+		if !almostEqual(m.Resolution(0), tt.resolution, 1e-6) {
+			t.Errorf("tile size %d: Resolution(0) = %f, want %f", tt.tileSize, m.Resolution(0), tt.resolution)
+		}
+		// 瓦片的地理范围与瓦片大小无关,512 瓦片只是分辨率加倍
+		minx, _, maxx, _ := m.TileMetersBounds(0, 0, 0)
+		if !almostEqual(minx, -m.OriginShift, 1e-6) || !almostEqual(maxx, m.OriginShift, 1e-6) {
+			t.Errorf("tile size %d: TileMetersBounds(0, 0, 0) = %f, %f", tt.tileSize, minx, maxx)
+		}
+	}
+}
+
+func TestTileSizeValidation(t *testing.T) {
+	tests := []struct {
+		tileSize int
+		err      error
+	}{
+		{128, pkgGdal.ErrTileSize},
+		{300, pkgGdal.ErrTileSize},
+		{1024, pkgGdal.ErrTileSize},
+	}
+	for _, tt := range tests {
+		err := tile.NewTile(tile.SetInputFilename("input.tif"), tile.SetTileSize(tt.tileSize)).Close()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("tile size %d: err = %v, want %v", tt.tileSize, err, tt.err)
+		}
+	}
+}
+
+func TestRetinaWindow(t *testing.T) {
+	box := tile.WindowsReadBox{Minx: 0, Maxy: 0, Maxx: 64, Miny: -64, Width: 1000, Height: 1000, GeoTransform: [6]float64{0, 1, 0, 0, 0, -1}}
+	for _, tileSize := range []int{256, 512} {
+		box.TileSize = tileSize
+		window := tile.NewWindows().ReadBox(&box)
+		box.TileSize = 2 * tileSize
+		retina := tile.NewWindows().ReadBox(&box)
+		// @2x 瓦片读取同样的源像素,写入尺寸加倍
+		if retina.Rx != window.Rx || retina.RxSize != window.RxSize || retina.WxSize != 2*window.WxSize || window.WxSize != 4*tileSize {
+			t.Errorf("tile size %d: window %+v retina %+v", tileSize, *window, *retina)
+		}
+	}
+}
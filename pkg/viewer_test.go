@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+func TestViewers(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, nil},
+		{[]string{"leaflet"}, []string{"leaflet"}},
+		{[]string{"all"}, []string{"leaflet", "openlayers", "maplibre"}},
+		{[]string{"maplibre", "all", "leaflet"}, []string{"maplibre", "leaflet", "openlayers"}},
+	}
+	for _, tt := range tests {
+		if got := tile.Viewers(tt.names); !slices.Equal(got, tt.want) {
+			t.Errorf("Viewers(%v) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestRenderViewer(t *testing.T) {
+	tileJSON := func(scheme string, tileSize int) *tile.TileJSON {
+		return &tile.TileJSON{
+			Name:     "dom",
+			Scheme:   scheme,
+			Tiles:    []string{"{z}/{x}/{y}.png"},
+			MinZoom:  3,
+			MaxZoom:  8,
+			Bounds:   []float64{116, 39, 117, 40},
+			TileSize: tileSize,
+		}
+	}
+	tests := []struct {
+		viewer   string
+		tileJSON *tile.TileJSON
+		contains []string
+	}{
+		{"leaflet", tileJSON("tms", 256), []string{"tms: true", "zoomOffset: 0", "minZoom: 3", "maxZoom: 8"}},
+		// Leaflet 按 256 计算层级,512 瓦片偏移一级
+		{"leaflet", tileJSON("xyz", 512), []string{"tms: false", "tileSize: 512", "zoomOffset: -1", "minZoom: 4", "maxZoom: 9"}},
+		{"openlayers", tileJSON("tms", 256), []string{"url: true ?", "'{-y}'", "minZoom: 3"}},
+		{"maplibre", tileJSON("xyz", 512), []string{`scheme: "xyz"`, "tileSize: 512", "bounds: [116, 39, 117, 40]"}},
+	}
+	for _, tt := range tests {
+		page, err := tile.RenderViewer(tt.viewer, tt.tileJSON)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.viewer, err)
+		}
+		// html/template 在 JS 值两侧加空格,比较时去掉空格
+		compact := strings.ReplaceAll(string(page), " ", "")
+		for _, want := range tt.contains {
+			if !strings.Contains(compact, strings.ReplaceAll(want, " ", "")) {
+				t.Errorf("%s %s/%d: page does not contain %q", tt.viewer, tt.tileJSON.Scheme, tt.tileJSON.TileSize, want)
+			}
+		}
+	}
+	if _, err := tile.RenderViewer("cesium", tileJSON("xyz", 256)); err == nil {
+		t.Error("unknown viewer should fail")
+	}
+}
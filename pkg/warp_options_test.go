@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	pkgGdal "github.com/pdxrlj/tile_server/pkg/gdal"
+)
+
+func TestWarpArgs(t *testing.T) {
+	geoTransform := pkgGdal.SourceGeoreference{GeoTransform: true}
+	gcp := pkgGdal.SourceGeoreference{GCP: true}
+	rpc := pkgGdal.SourceGeoreference{RPC: true}
+
+	tests := []struct {
+		name    string
+		src     pkgGdal.SourceGeoreference
+		options []pkgGdal.WrapOption
+		want    []string
+		absent  []string
+		err     error
+	}{
+		{name: "geotransform", src: geoTransform, absent: []string{"-rpc", "-tps", "-order", "-ovr", "-cutline", "-dstalpha"}},
+		{name: "dstalpha", src: geoTransform, options: []pkgGdal.WrapOption{pkgGdal.WithDstAlpha(true)}, want: []string{"-dstalpha"}, absent: []string{"-cutline"}},
+		{name: "auto gcp", src: gcp, absent: []string{"-rpc", "-tps", "-order"}},
+		{name: "auto rpc", src: rpc, want: []string{"-rpc"}},
+		{name: "no georeference", src: pkgGdal.SourceGeoreference{}, err: pkgGdal.ErrNoGeoreference},
+		{name: "gcp", src: gcp, options: []pkgGdal.WrapOption{pkgGdal.WithGeoreference(pkgGdal.GeoreferenceGCP)}, want: []string{"-order", "1"}},
+		{name: "gcp missing", src: geoTransform, options: []pkgGdal.WrapOption{pkgGdal.WithGeoreference(pkgGdal.GeoreferenceGCP)}, err: pkgGdal.ErrNoGCP},
+		{name: "tps", src: gcp, options: []pkgGdal.WrapOption{pkgGdal.WithGeoreference(pkgGdal.GeoreferenceTPS)}, want: []string{"-tps"}},
+		{name: "tps missing", src: rpc, options: []pkgGdal.WrapOption{pkgGdal.WithGeoreference(pkgGdal.GeoreferenceTPS)}, err: pkgGdal.ErrNoGCP},
+		{name: "rpc", src: rpc, options: []pkgGdal.WrapOption{pkgGdal.WithGeoreference(pkgGdal.GeoreferenceRPC)}, want: []string{"-rpc"}},
+		{name: "rpc missing", src: gcp, options: []pkgGdal.WrapOption{pkgGdal.WithGeoreference(pkgGdal.GeoreferenceRPC)}, err: pkgGdal.ErrNoRPC},
+		{name: "unknown", src: geoTransform, options: []pkgGdal.WrapOption{pkgGdal.WithGeoreference("affine")}, err: pkgGdal.ErrGeoreference},
+		{
+			name:    "cutline",
+			src:     geoTransform,
+			options: []pkgGdal.WrapOption{pkgGdal.WithCutline("aoi.geojson")},
+			want:    []string{"-cutline", "aoi.geojson", "-crop_to_cutline", "-dstalpha"},
+		},
+		{
+			name:    "overview and resampling",
+			src:     geoTransform,
+			options: []pkgGdal.WrapOption{pkgGdal.WithOverviewLevel(2), pkgGdal.WithResampling("bilinear")},
+			want:    []string{"-r", "bilinear", "-wo", "UNIFIED_SRC_NODATA=YES", "-ovr", "2"},
+		},
+		{
+			name:    "target extent",
+			src:     geoTransform,
+			options: []pkgGdal.WrapOption{pkgGdal.WithTargetExtent(-1.5, -2, 3, 4.25), pkgGdal.WithTargetSize(256, 128)},
+			want:    []string{"-te", "-1.5", "-2", "3", "4.25", "-ts", "256", "128"},
+		},
+	}
+	for _, tt := range tests {
+		options := pkgGdal.DefaultWrapOptions()
+		for _, option := range tt.options {
+			option(options)
+		}
+		args, err := options.WarpArgs(tt.src, "SRC", "DST")
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// s_srs 使用覆盖后的源坐标系
+		if !containsRun(args, []string{"-s_srs", "SRC", "-t_srs", "DST"}) || !containsRun(args, tt.want) {
+			t.Errorf("%s: args %v, want %v", tt.name, args, tt.want)
+		}
+		for _, arg := range tt.absent {
+			if slices.Contains(args, arg) {
+				t.Errorf("%s: args %v contains %s", tt.name, args, arg)
+			}
+		}
+	}
+}
+
+// containsRun args 中是否有连续的 run
+func containsRun(args, run []string) bool {
+	if len(run) == 0 {
+		return true
+	}
+	for i := 0; i+len(run) <= len(args); i++ {
+		if slices.Equal(args[i:i+len(run)], run) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCutlineWarpArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []pkgGdal.WrapOption
+		src     pkgGdal.SourceGeoreference
+		want    [][]string
+	}{
+		{
+			name:    "geotransform",
+			options: []pkgGdal.WrapOption{pkgGdal.WithCutline("aoi.shp")},
+			src:     pkgGdal.SourceGeoreference{GeoTransform: true},
+			want:    [][]string{{"-cutline", "aoi.shp", "-crop_to_cutline", "-dstalpha"}},
+		},
+		{
+			// 裁切与 RPC 变换同时生效
+			name:    "rpc",
+			options: []pkgGdal.WrapOption{pkgGdal.WithCutline("aoi.geojson")},
+			src:     pkgGdal.SourceGeoreference{RPC: true},
+			want:    [][]string{{"-cutline", "aoi.geojson", "-crop_to_cutline", "-dstalpha"}, {"-rpc"}},
+		},
+		{
+			name:    "overview",
+			options: []pkgGdal.WrapOption{pkgGdal.WithCutline("aoi.geojson"), pkgGdal.WithOverviewLevel(1)},
+			src:     pkgGdal.SourceGeoreference{GeoTransform: true},
+			want:    [][]string{{"-ovr", "1"}, {"-cutline", "aoi.geojson", "-crop_to_cutline", "-dstalpha"}},
+		},
+	}
+	for _, tt := range tests {
+		options := pkgGdal.DefaultWrapOptions()
+		for _, option := range tt.options {
+			option(options)
+		}
+		args, err := options.WarpArgs(tt.src, "SRC", "DST")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.want {
+			if !containsRun(args, want) {
+				t.Errorf("%s: args %v, want %v", tt.name, args, want)
+			}
+		}
+	}
+
+	// 未设置裁切时不增加 alpha 波段
+	args, err := pkgGdal.DefaultWrapOptions().WarpArgs(pkgGdal.SourceGeoreference{GeoTransform: true}, "SRC", "DST")
+	if err != nil || slices.Contains(args, "-dstalpha") || slices.Contains(args, "-cutline") {
+		t.Errorf("no cutline: args %v, err %v", args, err)
+	}
+}
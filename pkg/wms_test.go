@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/server"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// mapTileset 记录 GetMap 请求参数的实时渲染瓦片集
+type mapTileset struct {
+	epsg          int
+	bbox          [4]float64
+	width, height int
+	options       *tile.RenderOptions
+}
+
+func (m *mapTileset) Info() server.TilesetInfo {
+	return server.TilesetInfo{Name: "raster", Format: "png", MaxZoom: 10, Bounds: [4]float64{100, 20, 120, 40}, TileSize: 256}
+}
+
+func (m *mapTileset) Tile(z, x, y int) ([]byte, error) {
+	return nil, server.ErrTileNotFound
+}
+
+func (m *mapTileset) RenderMap(epsg int, bbox [4]float64, width, height int, format string, options *tile.RenderOptions) ([]byte, error) {
+	m.epsg, m.bbox, m.width, m.height, m.options = epsg, bbox, width, height, options
+	return []byte("map-" + format), nil
+}
+
+func (m *mapTileset) Close() error {
+	return nil
+}
+
+func TestWMSCapabilities(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+	s.AddTileset("raster", &mapTileset{})
+
+	status, body := get(t, s, "/wms?SERVICE=WMS&REQUEST=GetCapabilities")
+	if status != http.StatusOK || !strings.Contains(body, "<WMS_Capabilities") || !strings.Contains(body, "<CRS>CRS:84</CRS>") {
+		t.Fatalf("1.3.0 capabilities status %d: %s", status, body)
+	}
+	// 只发布可以按任意范围渲染的瓦片集
+	if !strings.Contains(body, "<Name>raster</Name>") || strings.Contains(body, "<Name>dom</Name>") {
+		t.Fatalf("1.3.0 layers: %s", body)
+	}
+	if !strings.Contains(body, `CRS="EPSG:4326" minx="20" miny="100" maxx="40" maxy="120"`) {
+		t.Fatalf("1.3.0 EPSG:4326 axis order: %s", body)
+	}
+
+	status, body = get(t, s, "/wms?service=WMS&request=GetCapabilities&version=1.1.1")
+	if status != http.StatusOK || !strings.Contains(body, "<WMT_MS_Capabilities") || !strings.Contains(body, `<LatLonBoundingBox minx="100" miny="20" maxx="120" maxy="40">`) {
+		t.Fatalf("1.1.1 capabilities status %d: %s", status, body)
+	}
+}
+
+func TestWMSGetMap(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+	raster := &mapTileset{}
+	s.AddTileset("raster", raster)
+
+	status, body := get(t, s, "/wms?SERVICE=WMS&VERSION=1.3.0&REQUEST=GetMap&LAYERS=raster&STYLES=&CRS=EPSG:4326&BBOX=20,100,40,120&WIDTH=400&HEIGHT=300&FORMAT=image/jpeg")
+	if status != http.StatusOK || body != "map-jpg" {
+		t.Fatalf("GetMap 1.3.0 status %d: %s", status, body)
+	}
+	if raster.epsg != 4326 || raster.bbox != [4]float64{100, 20, 120, 40} || raster.width != 400 || raster.height != 300 || raster.options.ReturnMask {
+		t.Fatalf("GetMap 1.3.0 request %+v", raster)
+	}
+
+	status, _ = get(t, s, "/wms?SERVICE=WMS&VERSION=1.1.1&REQUEST=GetMap&LAYERS=raster&SRS=EPSG:3857&BBOX=0,0,100,50&WIDTH=256&HEIGHT=128&FORMAT=image/png&TRANSPARENT=TRUE&bidx=1&colormap_name=viridis")
+	if status != http.StatusOK || raster.epsg != 3857 || raster.bbox != [4]float64{0, 0, 100, 50} {
+		t.Fatalf("GetMap 1.1.1 status %d request %+v", status, raster)
+	}
+	if !raster.options.ReturnMask || raster.options.ColormapName != "viridis" || len(raster.options.Bidx) != 1 {
+		t.Fatalf("GetMap render options %+v", raster.options)
+	}
+
+	for _, c := range []struct {
+		url  string
+		code string
+	}{
+		{"/wms?REQUEST=GetMap&VERSION=1.3.0&LAYERS=dom&CRS=EPSG:3857&BBOX=0,0,1,1&WIDTH=1&HEIGHT=1&FORMAT=image/png", "LayerNotDefined"},
+		{"/wms?REQUEST=GetMap&VERSION=1.3.0&LAYERS=raster&CRS=EPSG:2000&BBOX=0,0,1,1&WIDTH=1&HEIGHT=1&FORMAT=image/png", "InvalidCRS"},
+		{"/wms?REQUEST=GetMap&VERSION=1.1.1&LAYERS=raster&SRS=EPSG:2000&BBOX=0,0,1,1&WIDTH=1&HEIGHT=1&FORMAT=image/png", "InvalidSRS"},
+		{"/wms?REQUEST=GetMap&VERSION=1.3.0&LAYERS=raster&CRS=EPSG:3857&BBOX=0,0,1&WIDTH=1&HEIGHT=1&FORMAT=image/png", "InvalidParameterValue"},
+		{"/wms?REQUEST=GetMap&VERSION=1.3.0&LAYERS=raster&CRS=EPSG:3857&BBOX=0,0,1,1&WIDTH=1&HEIGHT=1&FORMAT=image/gif", "InvalidFormat"},
+		{"/wms?REQUEST=GetMap&VERSION=1.3.0&LAYERS=raster&BBOX=0,0,1,1&WIDTH=1&HEIGHT=1&FORMAT=image/png", "MissingParameterValue"},
+	} {
+		status, body := get(t, s, c.url)
+		if status != http.StatusBadRequest || !strings.Contains(body, `code="`+c.code+`"`) {
+			t.Errorf("%s: status %d body %s", c.url, status, body)
+		}
+	}
+}
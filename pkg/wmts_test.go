@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pdxrlj/tile_server/pkg/server"
+	"github.com/pdxrlj/tile_server/pkg/tile"
+)
+
+// writeDirTileset 写入一个只有 2/3/1 瓦片(XYZ)的切片目录
+func writeDirTileset(t *testing.T) string {
+	folder := t.TempDir()
+	tileJSON, _ := json.Marshal(tile.TileJSON{
+		TileJSON: "3.0.0",
+		Name:     "dom",
+		Scheme:   "xyz",
+		Tiles:    []string{"{z}/{x}/{y}.png"},
+		MinZoom:  1,
+		MaxZoom:  2,
+		Bounds:   []float64{100, 20, 120, 40},
+		Format:   "png",
+		TileSize: 256,
+	})
+	if err := os.WriteFile(filepath.Join(folder, tile.TileJSONFilename), tileJSON, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(folder, "2", "3"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "2", "3", "1.png"), []byte("dir-tile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return folder
+}
+
+// writeMBTiles 写入一个只有 1/1/0 瓦片(XYZ)的 MBTiles
+func writeMBTiles(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "dem.mbtiles")
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range []string{
+		`CREATE TABLE metadata (name TEXT, value TEXT)`,
+		`CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)`,
+		`INSERT INTO metadata VALUES ('name', 'dem'), ('format', 'png'), ('bounds', '0,0,170,80')`,
+		`INSERT INTO tiles VALUES (1, 1, 1, 'mbtiles-tile')`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filename
+}
+
+func newTilesetServer(t *testing.T) *server.Server {
+	s := server.New()
+	for _, source := range []server.TilesetSource{
+		{Name: "dom", Type: server.TilesetDir, Path: writeDirTileset(t)},
+		{Name: "dem", Type: server.TilesetMBTiles, Path: writeMBTiles(t)},
+	} {
+		tileset, err := s.OpenTileset(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.AddTileset(source.Name, tileset)
+	}
+	return s
+}
+
+// 瓦片表为空且 metadata 没有 minzoom/maxzoom 时也能打开
+func TestEmptyMBTiles(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "empty.mbtiles")
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		`CREATE TABLE metadata (name TEXT, value TEXT)`,
+		`CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = db.Close()
+
+	tileset, err := server.OpenMBTiles("empty", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tileset.Close()
+	if info := tileset.Info(); info.MinZoom != 0 || info.MaxZoom != 0 {
+		t.Errorf("info %+v", info)
+	}
+	if _, err := tileset.Tile(0, 0, 0); err != server.ErrTileNotFound {
+		t.Errorf("Tile(0, 0, 0) err = %v", err)
+	}
+}
+
+func get(t *testing.T, s *server.Server, url string) (int, string) {
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestWMTSCapabilities(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+
+	for _, url := range []string{"/wmts?SERVICE=WMTS&REQUEST=GetCapabilities", "/wmts/1.0.0/WMTSCapabilities.xml"} {
+		code, body := get(t, s, url)
+		if code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", url, code, body)
+		}
+		caps := struct {
+			Layers []struct {
+				Identifier string `xml:"Identifier"`
+				Limits     []struct {
+					TileMatrix string `xml:"TileMatrix"`
+				} `xml:"TileMatrixSetLink>TileMatrixSetLimits>TileMatrixLimits"`
+				ResourceURL struct {
+					Template string `xml:"template,attr"`
+				} `xml:"ResourceURL"`
+			} `xml:"Contents>Layer"`
+			TileMatrixSets []struct {
+				Identifier string   `xml:"Identifier"`
+				Matrices   []string `xml:"TileMatrix>Identifier"`
+			} `xml:"Contents>TileMatrixSet"`
+		}{}
+		if err := xml.Unmarshal([]byte(body), &caps); err != nil {
+			t.Fatal(err)
+		}
+		if len(caps.Layers) != 2 || caps.Layers[0].Identifier != "dem" || caps.Layers[1].Identifier != "dom" {
+			t.Fatalf("layers = %+v", caps.Layers)
+		}
+		if len(caps.Layers[1].Limits) != 2 || caps.Layers[1].Limits[0].TileMatrix != "1" {
+			t.Errorf("dom limits = %+v", caps.Layers[1].Limits)
+		}
+		if !strings.HasSuffix(caps.Layers[1].ResourceURL.Template, "/wmts/1.0.0/dom/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.png") {
+			t.Errorf("template = %s", caps.Layers[1].ResourceURL.Template)
+		}
+		if len(caps.TileMatrixSets) != 1 || caps.TileMatrixSets[0].Identifier != "WebMercatorQuad" || len(caps.TileMatrixSets[0].Matrices) != 3 {
+			t.Errorf("tile matrix sets = %+v", caps.TileMatrixSets)
+		}
+	}
+}
+
+func TestWMTSGetTile(t *testing.T) {
+	s := newTilesetServer(t)
+	defer s.Close()
+
+	for _, c := range []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"/wmts?service=WMTS&request=GetTile&layer=dom&tilematrixset=WebMercatorQuad&tilematrix=2&tilerow=1&tilecol=3&format=image/png", http.StatusOK, "dir-tile"},
+		{"/wmts/1.0.0/dom/default/WebMercatorQuad/2/1/3.png", http.StatusOK, "dir-tile"},
+		{"/wmts/1.0.0/dem/default/WebMercatorQuad/1/0/1.png", http.StatusOK, "mbtiles-tile"},
+		{"/wmts/1.0.0/dom/default/WebMercatorQuad/2/0/0.png", http.StatusBadRequest, "TileOutOfRange"},
+		{"/wmts/1.0.0/dom/default/WebMercatorQuad/0/0/0.png", http.StatusBadRequest, "TileOutOfRange"},
+		{"/wmts/1.0.0/nope/default/WebMercatorQuad/2/1/3.png", http.StatusBadRequest, "InvalidParameterValue"},
+		{"/wmts/1.0.0/dom/default/WorldCRS84Quad/2/1/3.png", http.StatusBadRequest, "InvalidParameterValue"},
+		{"/wmts?request=GetTile&layer=dom", http.StatusBadRequest, "MissingParameterValue"},
+		{"/wmts?request=GetFeatureInfo", http.StatusBadRequest, "OperationNotSupported"},
+	} {
+		code, body := get(t, s, c.url)
+		if code != c.code || !strings.Contains(body, c.body) {
+			t.Errorf("GET %s = %d %q, want %d %q", c.url, code, body, c.code, c.body)
+		}
+	}
+}